@@ -0,0 +1,405 @@
+// Package cfb builds Microsoft Compound File Binary (MS-CFB) containers.
+//
+// Reading compound files is left to github.com/richardlehane/mscfb; this
+// package only covers the write side needed to produce .msg files.
+package cfb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	sectorSize      = 512
+	miniSectorSize  = 64
+	miniStreamLimit = 4096
+	dirEntrySize    = 128
+	headerDifats    = 109
+
+	freeSect   = 0xFFFFFFFF
+	endOfChain = 0xFFFFFFFE
+	fatSect    = 0xFFFFFFFD
+	difSect    = 0xFFFFFFFC
+	noStream   = 0xFFFFFFFF
+
+	typeStorage = 0x1
+	typeStream  = 0x2
+	typeRoot    = 0x5
+
+	colorRed   = 0x0
+	colorBlack = 0x1
+)
+
+var signature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// ErrNameTooLong is returned when a storage or stream name exceeds the 31 UTF-16 code units allowed by MS-CFB
+var ErrNameTooLong = errors.New("cfb: entry name longer than 31 characters")
+
+// Storage is a directory node of a compound file under construction
+type Storage struct {
+	Name     string
+	CLSID    [16]byte
+	Created  time.Time
+	Modified time.Time
+
+	storages []*Storage
+	streams  []*stream
+}
+
+type stream struct {
+	name string
+	data []byte
+}
+
+// New returns an empty root storage
+func New() *Storage {
+	return &Storage{Name: "Root Entry"}
+}
+
+// AddStorage creates a child storage with the given name and returns it
+func (s *Storage) AddStorage(name string) *Storage {
+	child := &Storage{Name: name}
+	s.storages = append(s.storages, child)
+	return child
+}
+
+// AddStream adds a stream with the given name and content to the storage
+func (s *Storage) AddStream(name string, data []byte) {
+	s.streams = append(s.streams, &stream{name: name, data: data})
+}
+
+// dirEntry is a flattened directory entry ready to be laid out
+type dirEntry struct {
+	name     []uint16
+	kind     byte
+	color    byte
+	left     uint32
+	right    uint32
+	child    uint32
+	clsid    [16]byte
+	created  time.Time
+	modified time.Time
+	start    uint32
+	size     uint64
+	data     []byte
+}
+
+// WriteTo serializes s as the root storage of a version 3 compound file
+func (s *Storage) WriteTo(w io.Writer) (int64, error) {
+	var entries []*dirEntry
+	root := &dirEntry{name: utf16.Encode([]rune("Root Entry")), kind: typeRoot, color: colorBlack, clsid: s.CLSID,
+		modified: s.Modified, left: noStream, right: noStream, child: noStream}
+	entries = append(entries, root)
+	if err := flatten(s, 0, &entries); err != nil {
+		return 0, err
+	}
+
+	// Small streams live in the mini stream, the rest get regular sectors
+	var miniStream []byte
+	var miniFat []uint32
+	var large []*dirEntry
+	for _, e := range entries {
+		if e.kind != typeStream {
+			continue
+		}
+		switch {
+		case len(e.data) == 0:
+			e.start = endOfChain
+		case len(e.data) < miniStreamLimit:
+			e.start = uint32(len(miniFat))
+			n := (len(e.data) + miniSectorSize - 1) / miniSectorSize
+			for i := 0; i < n; i++ {
+				if i == n-1 {
+					miniFat = append(miniFat, endOfChain)
+				} else {
+					miniFat = append(miniFat, uint32(len(miniFat)+1))
+				}
+			}
+			miniStream = append(miniStream, e.data...)
+			miniStream = append(miniStream, make([]byte, n*miniSectorSize-len(e.data))...)
+		default:
+			large = append(large, e)
+		}
+	}
+
+	nDir := sectorsFor(len(entries) * dirEntrySize)
+	nMiniFat := sectorsFor(len(miniFat) * 4)
+	nMini := sectorsFor(len(miniStream))
+	data := nDir + nMiniFat + nMini
+	for _, e := range large {
+		data += sectorsFor(len(e.data))
+	}
+	nFat, nDifat := 0, 0
+	for {
+		total := data + nFat + nDifat
+		fat := (total + sectorSize/4 - 1) / (sectorSize / 4)
+		difat := 0
+		if fat > headerDifats {
+			difat = (fat - headerDifats + sectorSize/4 - 2) / (sectorSize/4 - 1)
+		}
+		if fat == nFat && difat == nDifat {
+			break
+		}
+		nFat, nDifat = fat, difat
+	}
+
+	fat := make([]uint32, nFat*sectorSize/4)
+	for i := range fat {
+		fat[i] = freeSect
+	}
+	next := 0
+	chain := func(n int) uint32 {
+		if n == 0 {
+			return endOfChain
+		}
+		start := next
+		for i := 0; i < n; i++ {
+			if i == n-1 {
+				fat[next] = endOfChain
+			} else {
+				fat[next] = uint32(next + 1)
+			}
+			next++
+		}
+		return uint32(start)
+	}
+	dirStart := chain(nDir)
+	miniFatStart := chain(nMiniFat)
+	root.start = chain(nMini)
+	root.size = uint64(len(miniStream))
+	if nMini == 0 {
+		root.start = endOfChain
+	}
+	for _, e := range large {
+		e.start = chain(sectorsFor(len(e.data)))
+	}
+	fatStart := next
+	for i := 0; i < nFat; i++ {
+		fat[next] = fatSect
+		next++
+	}
+	difatStart := next
+	for i := 0; i < nDifat; i++ {
+		fat[next] = difSect
+		next++
+	}
+
+	// Header
+	header := make([]byte, sectorSize)
+	copy(header, signature)
+	binary.LittleEndian.PutUint16(header[24:], 0x003E)
+	binary.LittleEndian.PutUint16(header[26:], 0x0003)
+	binary.LittleEndian.PutUint16(header[28:], 0xFFFE)
+	binary.LittleEndian.PutUint16(header[30:], 9)
+	binary.LittleEndian.PutUint16(header[32:], 6)
+	binary.LittleEndian.PutUint32(header[44:], uint32(nFat))
+	binary.LittleEndian.PutUint32(header[48:], dirStart)
+	binary.LittleEndian.PutUint32(header[56:], miniStreamLimit)
+	binary.LittleEndian.PutUint32(header[60:], miniFatStart)
+	binary.LittleEndian.PutUint32(header[64:], uint32(nMiniFat))
+	if nDifat > 0 {
+		binary.LittleEndian.PutUint32(header[68:], uint32(difatStart))
+	} else {
+		binary.LittleEndian.PutUint32(header[68:], endOfChain)
+	}
+	binary.LittleEndian.PutUint32(header[72:], uint32(nDifat))
+	for i := 0; i < headerDifats; i++ {
+		v := uint32(freeSect)
+		if i < nFat {
+			v = uint32(fatStart + i)
+		}
+		binary.LittleEndian.PutUint32(header[76+i*4:], v)
+	}
+
+	body := make([]byte, 0, next*sectorSize)
+	dir := make([]byte, nDir*sectorSize)
+	for i, e := range entries {
+		e.encode(dir[i*dirEntrySize:])
+	}
+	for i := len(entries); i < nDir*sectorSize/dirEntrySize; i++ {
+		b := dir[i*dirEntrySize:]
+		binary.LittleEndian.PutUint32(b[68:], noStream)
+		binary.LittleEndian.PutUint32(b[72:], noStream)
+		binary.LittleEndian.PutUint32(b[76:], noStream)
+	}
+	body = append(body, dir...)
+	mf := make([]byte, nMiniFat*sectorSize)
+	for i := range mf {
+		mf[i] = 0xFF
+	}
+	for i, v := range miniFat {
+		binary.LittleEndian.PutUint32(mf[i*4:], v)
+	}
+	body = append(body, mf...)
+	body = appendPadded(body, miniStream)
+	for _, e := range large {
+		body = appendPadded(body, e.data)
+	}
+	fb := make([]byte, nFat*sectorSize)
+	for i, v := range fat {
+		binary.LittleEndian.PutUint32(fb[i*4:], v)
+	}
+	body = append(body, fb...)
+	for i := 0; i < nDifat; i++ {
+		db := make([]byte, sectorSize)
+		for j := 0; j < sectorSize/4-1; j++ {
+			v := uint32(freeSect)
+			if k := headerDifats + i*(sectorSize/4-1) + j; k < nFat {
+				v = uint32(fatStart + k)
+			}
+			binary.LittleEndian.PutUint32(db[j*4:], v)
+		}
+		link := uint32(endOfChain)
+		if i < nDifat-1 {
+			link = uint32(difatStart + i + 1)
+		}
+		binary.LittleEndian.PutUint32(db[sectorSize-4:], link)
+		body = append(body, db...)
+	}
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(body)
+	return int64(n + m), err
+}
+
+// flatten appends the children of s to entries and links them into a red-black tree under the entry at index parent
+func flatten(s *Storage, parent int, entries *[]*dirEntry) error {
+	var children []*dirEntry
+	var subs []*Storage
+	for _, st := range s.storages {
+		name, err := encodeName(st.Name)
+		if err != nil {
+			return err
+		}
+		children = append(children, &dirEntry{name: name, kind: typeStorage, clsid: st.CLSID,
+			created: st.Created, modified: st.Modified})
+		subs = append(subs, st)
+	}
+	for _, sm := range s.streams {
+		name, err := encodeName(sm.name)
+		if err != nil {
+			return err
+		}
+		children = append(children, &dirEntry{name: name, kind: typeStream, data: sm.data, size: uint64(len(sm.data))})
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	base := len(*entries)
+	for _, c := range children {
+		c.left, c.right, c.child = noStream, noStream, noStream
+		*entries = append(*entries, c)
+	}
+	order := make([]int, len(children))
+	for i := range order {
+		order[i] = base + i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return compareNames((*entries)[order[i]].name, (*entries)[order[j]].name) < 0
+	})
+	height := 0
+	for n := len(order); n > 0; n /= 2 {
+		height++
+	}
+	perfect := len(order) == (1<<height)-1
+	(*entries)[parent].child = buildTree(*entries, order, 1, height, perfect)
+
+	for i, st := range subs {
+		if err := flatten(st, base+i, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildTree links a sorted slice of entries into a balanced tree and returns the index of its root.
+// Nodes on the deepest level of an imperfect tree are red, everything else is black, which keeps it a valid red-black tree.
+func buildTree(entries []*dirEntry, order []int, depth, height int, perfect bool) uint32 {
+	if len(order) == 0 {
+		return noStream
+	}
+	mid := len(order) / 2
+	e := entries[order[mid]]
+	e.color = colorBlack
+	if depth == height && !perfect {
+		e.color = colorRed
+	}
+	e.left = buildTree(entries, order[:mid], depth+1, height, perfect)
+	e.right = buildTree(entries, order[mid+1:], depth+1, height, perfect)
+	return uint32(order[mid])
+}
+
+// compareNames orders directory entry names the way MS-CFB requires: shorter names first, then by upper-cased code units
+func compareNames(a, b []uint16) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	for i := range a {
+		ca := utf16.Decode([]uint16{a[i]})
+		cb := utf16.Decode([]uint16{b[i]})
+		ua := []rune(strings.ToUpper(string(ca)))
+		ub := []rune(strings.ToUpper(string(cb)))
+		if ua[0] != ub[0] {
+			return int(ua[0]) - int(ub[0])
+		}
+	}
+	return 0
+}
+
+func encodeName(name string) ([]uint16, error) {
+	u := utf16.Encode([]rune(name))
+	if len(u) > 31 {
+		return nil, ErrNameTooLong
+	}
+	return u, nil
+}
+
+func (e *dirEntry) encode(b []byte) {
+	for i, c := range e.name {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	binary.LittleEndian.PutUint16(b[64:], uint16((len(e.name)+1)*2))
+	b[66] = e.kind
+	b[67] = e.color
+	binary.LittleEndian.PutUint32(b[68:], e.left)
+	binary.LittleEndian.PutUint32(b[72:], e.right)
+	binary.LittleEndian.PutUint32(b[76:], e.child)
+	copy(b[80:96], e.clsid[:])
+	binary.LittleEndian.PutUint64(b[100:], filetime(e.created))
+	binary.LittleEndian.PutUint64(b[108:], filetime(e.modified))
+	if e.kind == typeStorage {
+		binary.LittleEndian.PutUint32(b[116:], 0)
+		return
+	}
+	binary.LittleEndian.PutUint32(b[116:], e.start)
+	binary.LittleEndian.PutUint64(b[120:], e.size)
+}
+
+// filetime converts t to a Windows FILETIME, leaving the zero time as 0
+func filetime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix()+11644473600)*1e7 + uint64(t.Nanosecond()/100)
+}
+
+func sectorsFor(n int) int {
+	return (n + sectorSize - 1) / sectorSize
+}
+
+// appendPadded appends data to body followed by zeroes up to the next sector boundary
+func appendPadded(body, data []byte) []byte {
+	body = append(body, data...)
+	if rem := len(data) % sectorSize; rem != 0 {
+		body = append(body, make([]byte, sectorSize-rem)...)
+	}
+	return body
+}
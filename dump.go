@@ -0,0 +1,414 @@
+package msgparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/richardlehane/mscfb"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// DumpNode is a storage or stream of a compound file together with the raw properties decoded from it
+type DumpNode struct {
+	Name       string          `json:"name"`
+	Kind       string          `json:"kind"` // "storage" or "stream"
+	Size       int64           `json:"size"`
+	CLSID      string          `json:"clsid,omitempty"`
+	Created    *time.Time      `json:"created,omitempty"`
+	Modified   *time.Time      `json:"modified,omitempty"`
+	Properties []DumpProperty  `json:"properties,omitempty"` // Properties stored in the stream
+	Names      []DumpNamedName `json:"names,omitempty"`      // Named property map, set on the __substg1.0_00030102 stream of __nameid_version1.0
+	Children   []*DumpNode     `json:"children,omitempty"`
+}
+
+// DumpProperty is a property exactly as stored in a properties stream or a __substg1.0_ stream
+type DumpProperty struct {
+	Tag         string      `json:"tag"`
+	Name        string      `json:"name,omitempty"`
+	Type        string      `json:"type"`
+	Flags       *uint32     `json:"flags,omitempty"`       // Set for entries of a __properties_version1.0 stream
+	Size        *uint32     `json:"size,omitempty"`        // Size of the value stream, for variable length entries of a properties stream
+	Index       *int        `json:"index,omitempty"`       // Element index, for the value streams of multi-valued properties
+	PropertySet string      `json:"propertySet,omitempty"` // Named properties only
+	LID         string      `json:"lid,omitempty"`
+	StringName  string      `json:"stringName,omitempty"`
+	Value       interface{} `json:"value,omitempty"`
+}
+
+// DumpNamedName is an entry of the named property map
+type DumpNamedName struct {
+	ID          string `json:"id"`
+	PropertySet string `json:"propertySet"`
+	LID         string `json:"lid,omitempty"`
+	StringName  string `json:"stringName,omitempty"`
+}
+
+// DumpMsgFile reads every storage and stream of a msg file, see DumpReader
+func DumpMsgFile(file string) (*DumpNode, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return dumpMsg(f)
+}
+
+// DumpReader walks the whole compound file tree and decodes every property it finds with its tag, type, name and value.
+// Unlike ParseReader nothing is interpreted: values are reported as stored, without picking bodies, decoding code pages or dropping properties.
+func DumpReader(r io.Reader) (*DumpNode, error) {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		ra = bytes.NewReader(data)
+	}
+	return dumpMsg(ra)
+}
+
+func dumpMsg(ra io.ReaderAt) (*DumpNode, error) {
+	doc, err := mscfb.New(ra)
+	if err != nil {
+		return nil, err
+	}
+	root := &DumpNode{
+		Name:     "Root Entry",
+		Kind:     "storage",
+		CLSID:    dumpCLSID(doc.ID()),
+		Created:  dumpTime(doc.Created()),
+		Modified: dumpTime(doc.Modified()),
+	}
+	storages := map[string]*DumpNode{"": root}
+	nameID := make(map[string][]byte)
+	var nameEntries *DumpNode
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		parent := storages[strings.Join(entry.Path, "/")]
+		if parent == nil {
+			// Storages are listed before their children, this only happens for damaged files
+			parent = root
+		}
+		node := &DumpNode{
+			Name:     entry.Name,
+			Kind:     "stream",
+			Size:     entry.Size,
+			Created:  dumpTime(entry.Created()),
+			Modified: dumpTime(entry.Modified()),
+		}
+		parent.Children = append(parent.Children, node)
+		if entry.FileInfo().IsDir() {
+			node.Kind = "storage"
+			node.Size = 0
+			node.CLSID = dumpCLSID(entry.ID())
+			storages[strings.Join(append(append([]string{}, entry.Path...), entry.Name), "/")] = node
+			continue
+		}
+
+		data := make([]byte, entry.Size)
+		if entry.Size > 0 {
+			if _, err := io.ReadFull(entry, data); err != nil {
+				return nil, err
+			}
+		}
+		if parent.Name == NameIDStorage {
+			nameID[entry.Name] = data
+			if entry.Name == PropertyStreamPrefix+"00030102" {
+				nameEntries = node
+			}
+			continue
+		}
+		switch {
+		case entry.Name == PropsKey:
+			headerSize := 8
+			if parent == root {
+				headerSize = 32
+			} else if parent.Name == EmbeddedMessageStorage {
+				headerSize = 24
+			}
+			node.Properties = dumpPropertiesStream(data, headerSize)
+		case strings.HasPrefix(entry.Name, PropertyStreamPrefix):
+			if prop, ok := dumpPropertyStream(entry.Name, data); ok {
+				node.Properties = []DumpProperty{prop}
+			}
+		}
+	}
+
+	names := parseNameID(nameID)
+	if nameEntries != nil {
+		ids := make([]int64, 0, len(names))
+		for id := range names {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			np := names[id]
+			name := DumpNamedName{ID: fmt.Sprintf("0x%04X", id), PropertySet: np.GUID, StringName: np.Name}
+			if np.Name == "" {
+				name.LID = fmt.Sprintf("0x%04X", np.ID)
+			}
+			nameEntries.Names = append(nameEntries.Names, name)
+		}
+	}
+	root.resolveNames(names)
+	return root, nil
+}
+
+// resolveNames adds the property set and name of the named properties found below the node
+func (node *DumpNode) resolveNames(names map[int64]models.NamedProperty) {
+	for i := range node.Properties {
+		prop := &node.Properties[i]
+		id, _, err := models.ParsePropertyTag(prop.Tag)
+		if err != nil || id < 0x8000 {
+			continue
+		}
+		if np, ok := names[int64(id)]; ok {
+			prop.PropertySet = np.GUID
+			prop.StringName = np.Name
+			if np.Name == "" {
+				prop.LID = fmt.Sprintf("0x%04X", np.ID)
+			}
+		}
+	}
+	for _, child := range node.Children {
+		child.resolveNames(names)
+	}
+}
+
+// dumpPropertiesStream decodes the 16 byte entries of a __properties_version1.0 stream following its header
+func dumpPropertiesStream(data []byte, headerSize int) []DumpProperty {
+	var res []DumpProperty
+	for offset := headerSize; offset+16 <= len(data); offset += 16 {
+		tag := binary.LittleEndian.Uint32(data[offset:])
+		flags := binary.LittleEndian.Uint32(data[offset+4:])
+		prop := newDumpProperty(uint16(tag>>16), uint16(tag))
+		prop.Flags = &flags
+		if isFixedLengthType(tag & 0xFFFF) {
+			prop.Value = dumpValue(data[offset+8:offset+16], uint16(tag))
+		} else {
+			size := binary.LittleEndian.Uint32(data[offset+8:])
+			prop.Size = &size
+		}
+		res = append(res, prop)
+	}
+	return res
+}
+
+// dumpPropertyStream decodes a __substg1.0_IIIITTTT stream, or one element stream __substg1.0_IIIITTTT-XXXXXXXX of a multi-valued property
+func dumpPropertyStream(name string, data []byte) (DumpProperty, bool) {
+	val := strings.TrimPrefix(name, PropertyStreamPrefix)
+	if len(val) < 8 {
+		return DumpProperty{}, false
+	}
+	id, err1 := strconv.ParseUint(val[0:4], 16, 16)
+	typ, err2 := strconv.ParseUint(val[4:8], 16, 16)
+	if err1 != nil || err2 != nil {
+		return DumpProperty{}, false
+	}
+	prop := newDumpProperty(uint16(id), uint16(typ))
+	switch {
+	case len(val) > 9 && val[8] == '-':
+		index, err := strconv.ParseUint(val[9:], 16, 32)
+		if err != nil {
+			return DumpProperty{}, false
+		}
+		i := int(index)
+		prop.Index = &i
+		prop.Value = dumpValue(data, uint16(typ)&^models.PropTypeMultiple)
+	case typ&models.PropTypeMultiple != 0:
+		prop.Value = dumpMultiValue(data, uint16(typ))
+	case typ == models.PropTypeObject:
+		// The value is the storage of the same name
+	default:
+		prop.Value = dumpValue(data, uint16(typ))
+	}
+	return prop, true
+}
+
+func newDumpProperty(id, typ uint16) DumpProperty {
+	return DumpProperty{
+		Tag:  models.FormatPropertyTag(id, typ),
+		Name: models.PropertyName(id),
+		Type: models.PropertyTypeName(typ),
+	}
+}
+
+// dumpValue decodes a single value as stored, keeping PT_STRING8 bytes as they are
+func dumpValue(data []byte, typ uint16) interface{} {
+	size := fixedTypeSize(typ)
+	if size > len(data) {
+		return data
+	}
+	switch typ {
+	case models.PropTypeString8:
+		return string(bytes.TrimRight(data, "\x00"))
+	case models.PropTypeSysTime:
+		if t := models.FiletimeToTime(binary.LittleEndian.Uint64(data)); !t.IsZero() {
+			return t.UTC()
+		}
+		return time.Time{}
+	}
+	return extractDataFromBytes(data, uint32(typ))
+}
+
+// dumpMultiValue decodes the stream of a multi-valued property: the values of fixed length types,
+// or the lengths of the element streams for strings and binaries
+func dumpMultiValue(data []byte, typ uint16) interface{} {
+	base := typ &^ models.PropTypeMultiple
+	size := fixedTypeSize(base)
+	var values []interface{}
+	if size == 0 {
+		// Length stream: 4 bytes per string, 8 bytes (length and reserved) per binary or GUID
+		step := 4
+		if base == models.PropTypeBinary {
+			step = 8
+		}
+		for offset := 0; offset+step <= len(data); offset += step {
+			values = append(values, binary.LittleEndian.Uint32(data[offset:]))
+		}
+		return values
+	}
+	for offset := 0; offset+size <= len(data); offset += size {
+		values = append(values, dumpValue(data[offset:offset+size], base))
+	}
+	return values
+}
+
+// fixedTypeSize returns the size of a fixed length value, or 0 for variable length types
+func fixedTypeSize(typ uint16) int {
+	switch typ {
+	case models.PropTypeI2, models.PropTypeBoolean:
+		return 2
+	case models.PropTypeLong, models.PropTypeR4, models.PropTypeError:
+		return 4
+	case models.PropTypeDouble, models.PropTypeCurrency, models.PropTypeAppTime, models.PropTypeI8, models.PropTypeSysTime:
+		return 8
+	case models.PropTypeCLSID:
+		return 16
+	}
+	return 0
+}
+
+// dumpCLSID formats a storage CLSID like PT_CLSID values, returning an empty string for the null CLSID
+func dumpCLSID(id string) string {
+	id = strings.ToLower(strings.Trim(id, "{}"))
+	if strings.Trim(id, "0-") == "" {
+		return ""
+	}
+	return id
+}
+
+// dumpTime returns t in UTC, or nil when the compound file leaves the timestamp unset (a zero FILETIME)
+func dumpTime(t time.Time) *time.Time {
+	if t.IsZero() || t.Unix() == 0 || t.Year() <= 1601 {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// WriteText renders the tree with one line per storage, stream and property, indenting each level by two spaces
+func (node *DumpNode) WriteText(w io.Writer) error {
+	return node.writeText(w, 0)
+}
+
+func (node *DumpNode) writeText(w io.Writer, depth int) error {
+	indent := strings.Repeat("  ", depth)
+	line := fmt.Sprintf("%s%s (%s", indent, node.Name, node.Kind)
+	if node.Kind == "stream" {
+		line += fmt.Sprintf(", %d bytes", node.Size)
+	}
+	if node.CLSID != "" {
+		line += ", clsid " + node.CLSID
+	}
+	if node.Created != nil {
+		line += ", created " + node.Created.Format(time.RFC3339)
+	}
+	if node.Modified != nil {
+		line += ", modified " + node.Modified.Format(time.RFC3339)
+	}
+	if _, err := fmt.Fprintln(w, line+")"); err != nil {
+		return err
+	}
+	for _, prop := range node.Properties {
+		if _, err := fmt.Fprintf(w, "%s  %s\n", indent, prop.text()); err != nil {
+			return err
+		}
+	}
+	for _, name := range node.Names {
+		id := name.LID
+		if name.StringName != "" {
+			id = strconv.Quote(name.StringName)
+		}
+		if _, err := fmt.Fprintf(w, "%s  %s -> {%s} %s\n", indent, name.ID, name.PropertySet, id); err != nil {
+			return err
+		}
+	}
+	for _, child := range node.Children {
+		if err := child.writeText(w, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// text formats the property on a single line, shortening long binary values
+func (prop DumpProperty) text() string {
+	var b strings.Builder
+	b.WriteString(prop.Tag)
+	if prop.Index != nil {
+		fmt.Fprintf(&b, "[%d]", *prop.Index)
+	}
+	if prop.Name != "" {
+		b.WriteString(" " + prop.Name)
+	}
+	if prop.PropertySet != "" {
+		b.WriteString(" {" + prop.PropertySet + "}")
+		if prop.StringName != "" {
+			b.WriteString(" " + strconv.Quote(prop.StringName))
+		} else {
+			b.WriteString(" " + prop.LID)
+		}
+	}
+	b.WriteString(" " + prop.Type)
+	if prop.Flags != nil {
+		fmt.Fprintf(&b, " flags=0x%X", *prop.Flags)
+	}
+	if prop.Size != nil {
+		fmt.Fprintf(&b, " size=%d", *prop.Size)
+	}
+	if prop.Value != nil {
+		b.WriteString(" = " + formatDumpValue(prop.Value))
+	}
+	return b.String()
+}
+
+func formatDumpValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return strconv.Quote(t)
+	case []byte:
+		if len(t) > 64 {
+			return fmt.Sprintf("%s... (%d bytes)", hex.EncodeToString(t[:64]), len(t))
+		}
+		return hex.EncodeToString(t)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case []interface{}:
+		parts := make([]string, len(t))
+		for i := range t {
+			parts[i] = formatDumpValue(t[i])
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
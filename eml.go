@@ -0,0 +1,278 @@
+package msgparser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+	"golang.org/x/net/html/charset"
+)
+
+// wordDecoder decodes RFC 2047 encoded words in any charset known to golang.org/x/net/html/charset
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: charset.NewReaderLabel,
+}
+
+// ParseEML parses an RFC 5322 (.eml) message and maps it onto a models.Message,
+// so it can be handled the same way as a parsed .msg file or written back out with WriteMsg
+func ParseEML(r io.Reader) (*models.Message, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	mm, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &models.Message{
+		MessageClass:            "IPM.Note",
+		Properties:              make(map[int64]interface{}),
+		TransportMessageHeaders: rawHeader(raw),
+	}
+	h := mm.Header
+	res.Subject = decodeHeader(h.Get("Subject"))
+	res.MessageID = strings.TrimSpace(h.Get("Message-Id"))
+	if date, err := h.Date(); err == nil {
+		res.Date = date
+		res.ClientSubmitTime = date
+	}
+
+	// A received, read message; without PR_MESSAGE_FLAGS Outlook opens the item as an unsent draft
+	res.Properties[0x0E07] = int32(0x01)
+
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	if from, err := parser.Parse(h.Get("From")); err == nil {
+		res.FromName = from.Name
+		res.FromEmail = from.Address
+		res.Properties[0x0C1E] = "SMTP" // PR_SENDER_ADDRTYPE
+		res.Properties[0x0064] = "SMTP" // PR_SENT_REPRESENTING_ADDRTYPE
+	}
+	for _, field := range []struct {
+		header string
+		typ    models.RecipientType
+	}{
+		{"To", models.RecipientTo},
+		{"Cc", models.RecipientCC},
+		{"Bcc", models.RecipientBCC},
+	} {
+		if h.Get(field.header) == "" {
+			continue
+		}
+		list, err := parser.ParseList(h.Get(field.header))
+		if err != nil {
+			continue
+		}
+		var names []string
+		for _, a := range list {
+			name := a.Name
+			if name == "" {
+				name = a.Address
+			}
+			names = append(names, name)
+			res.Recipients = append(res.Recipients, models.Recipient{
+				Type:         field.typ,
+				DisplayName:  name,
+				EmailAddress: a.Address,
+				AddressType:  "SMTP",
+				SMTPAddress:  a.Address,
+				Properties:   map[int64]interface{}{},
+			})
+			res.Address = append(res.Address, a.Address)
+			switch field.typ {
+			case models.RecipientTo:
+				res.To = res.To + a.Address + "; "
+			case models.RecipientCC:
+				res.CC = res.CC + a.Address + "; "
+			case models.RecipientBCC:
+				res.BCC = res.BCC + a.Address + "; "
+			}
+		}
+		switch field.typ {
+		case models.RecipientTo:
+			res.ToDisplay = strings.Join(names, "; ")
+		case models.RecipientCC:
+			res.CCDisplay = strings.Join(names, "; ")
+		case models.RecipientBCC:
+			res.BCCDisplay = strings.Join(names, "; ")
+		}
+	}
+
+	// X- headers have no PR_* counterpart; Outlook keeps them as string named properties in PS_INTERNET_HEADERS
+	var custom []string
+	for key := range h {
+		if strings.HasPrefix(strings.ToLower(key), "x-") {
+			custom = append(custom, key)
+		}
+	}
+	sort.Strings(custom)
+	for i, key := range custom {
+		if res.NamedProperties == nil {
+			res.NamedProperties = make(map[int64]models.NamedProperty)
+		}
+		id := int64(0x8000 + i)
+		res.NamedProperties[id] = models.NamedProperty{GUID: models.PSInternetHeaders, Name: strings.ToLower(key)}
+		res.Properties[id] = decodeHeader(h.Get(key))
+	}
+
+	if err := parseMimePart(res, textproto.MIMEHeader(h), mm.Body); err != nil {
+		return nil, err
+	}
+	switch {
+	case res.BodyHTML != "":
+		res.BodySource = models.BodySourceHTML
+		if res.BodyPlainText == "" {
+			res.BodyPlainText = models.HTMLToText(res.BodyHTML)
+		}
+	case res.BodyPlainText != "":
+		res.BodySource = models.BodySourcePlainText
+	}
+	res.ApplyNamedPropertyHandlers()
+	expandTNEF(res)
+	return res, nil
+}
+
+// WriteMsg serializes msg as an Outlook .msg compound file, see models.Message.WriteMSG
+func WriteMsg(w io.Writer, msg *models.Message) error {
+	return msg.WriteMSG(w)
+}
+
+// ConvertEMLToMsg reads an RFC 5322 message from r and writes it to w as a .msg file
+func ConvertEMLToMsg(r io.Reader, w io.Writer) error {
+	msg, err := ParseEML(r)
+	if err != nil {
+		return err
+	}
+	return msg.WriteMSG(w)
+}
+
+// parseMimePart walks a MIME entity, filling the bodies and attachments of res
+func parseMimePart(res *models.Message, header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := parseMimePart(res, part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := ioutil.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+
+	if disposition != "attachment" {
+		switch {
+		case mediaType == "text/plain" && res.BodyPlainText == "":
+			res.BodyPlainText = decodeCharset(data, params["charset"])
+			return nil
+		case mediaType == "text/html" && res.BodyHTML == "":
+			res.BodyHTML = decodeCharset(data, params["charset"])
+			return nil
+		}
+	}
+
+	att := models.Attachment{
+		MimeType:   mediaType,
+		ContentID:  strings.Trim(header.Get("Content-Id"), "<> "),
+		Method:     models.AttachByValue,
+		Properties: map[int64]interface{}{0x370B: int32(-1)}, // PR_RENDERING_POSITION: not rendered inline in RTF
+	}
+	if disposition == "inline" && att.ContentID != "" {
+		// An image of the HTML body, which Outlook does not list with the attachments
+		att.Properties[0x7FFE] = true // PR_ATTACHMENT_HIDDEN
+	}
+	att.FileName = decodeHeader(dispParams["filename"])
+	if att.FileName == "" {
+		att.FileName = decodeHeader(params["name"])
+	}
+	if mediaType == "message/rfc822" {
+		embedded, err := ParseEML(bytes.NewReader(data))
+		if err == nil {
+			att.Method = models.AttachEmbeddedMsg
+			att.Embedded = embedded
+			if att.FileName == "" {
+				att.FileName = embedded.Subject
+			}
+		}
+	}
+	if att.Embedded == nil {
+		att.Data = data
+	}
+	att.Name = att.FileName
+	if att.Name == "" {
+		att.Name = fmt.Sprintf("Attachment %d", len(res.Attachments)+1)
+	}
+	res.Attachments = append(res.Attachments, att)
+	return nil
+}
+
+// decodeTransferEncoding wraps body in a decoder for the given Content-Transfer-Encoding
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// decodeCharset converts text in the given charset to UTF-8, returning it unchanged when the charset is unknown
+func decodeCharset(data []byte, label string) string {
+	if label == "" {
+		return string(data)
+	}
+	reader, err := charset.NewReaderLabel(label, bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+// decodeHeader decodes RFC 2047 encoded words, falling back to the raw value
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// rawHeader returns the header block of a raw RFC 5322 message
+func rawHeader(raw []byte) string {
+	for _, sep := range []string{"\r\n\r\n", "\n\n"} {
+		if i := bytes.Index(raw, []byte(sep)); i >= 0 {
+			return string(raw[:i+len(sep)/2])
+		}
+	}
+	return string(raw)
+}
@@ -0,0 +1,272 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Named properties of PSETID_Appointment (MS-OXOCAL)
+const (
+	lidAppointmentSequence   = 0x8201 // PidLidAppointmentSequence
+	lidBusyStatus            = 0x8205 // PidLidBusyStatus
+	lidLocation              = 0x8208 // PidLidLocation
+	lidAppointmentStartWhole = 0x820D // PidLidAppointmentStartWhole
+	lidAppointmentEndWhole   = 0x820E // PidLidAppointmentEndWhole
+	lidAppointmentDuration   = 0x8213 // PidLidAppointmentDuration
+	lidAppointmentSubType    = 0x8215 // PidLidAppointmentSubType, set for all-day events
+	lidAppointmentRecur      = 0x8216 // PidLidAppointmentRecur
+	lidAppointmentStateFlags = 0x8217 // PidLidAppointmentStateFlags
+	lidResponseStatus        = 0x8218 // PidLidResponseStatus
+	lidRecurring             = 0x8223 // PidLidRecurring
+	lidTimeZoneStruct        = 0x8233 // PidLidTimeZoneStruct
+	lidTimeZoneDescription   = 0x8234 // PidLidTimeZoneDescription
+	lidTZDefStartDisplay     = 0x825E // PidLidAppointmentTimeZoneDefinitionStartDisplay
+	lidTZDefEndDisplay       = 0x825F // PidLidAppointmentTimeZoneDefinitionEndDisplay
+	lidTZDefRecur            = 0x8260 // PidLidAppointmentTimeZoneDefinitionRecur
+)
+
+// Named properties of PSETID_Common used by calendar items
+const (
+	lidReminderDelta      = 0x8501 // PidLidReminderDelta
+	lidReminderTime       = 0x8502 // PidLidReminderTime
+	lidReminderSet        = 0x8503 // PidLidReminderSet
+	lidReminderSignalTime = 0x8560 // PidLidReminderSignalTime
+)
+
+// BusyStatus is the PidLidBusyStatus of an appointment
+type BusyStatus int32
+
+// Busy statuses
+const (
+	BusyStatusFree             BusyStatus = 0 // olFree
+	BusyStatusTentative        BusyStatus = 1 // olTentative
+	BusyStatusBusy             BusyStatus = 2 // olBusy
+	BusyStatusOutOfOffice      BusyStatus = 3 // olOutOfOffice
+	BusyStatusWorkingElsewhere BusyStatus = 4 // olWorkingElsewhere
+)
+
+// ResponseStatus is the response of an attendee (PidLidResponseStatus, PidTagRecipientTrackStatus)
+type ResponseStatus int32
+
+// Response statuses
+const (
+	ResponseNone         ResponseStatus = 0 // respNone
+	ResponseOrganized    ResponseStatus = 1 // respOrganized
+	ResponseTentative    ResponseStatus = 2 // respTentative
+	ResponseAccepted     ResponseStatus = 3 // respAccepted
+	ResponseDeclined     ResponseStatus = 4 // respDeclined
+	ResponseNotResponded ResponseStatus = 5 // respNotResponded
+)
+
+// Flags of PidLidAppointmentStateFlags
+const (
+	AppointmentMeeting  = 0x0001 // asfMeeting
+	AppointmentReceived = 0x0002 // asfReceived
+	AppointmentCanceled = 0x0004 // asfCanceled
+)
+
+// recipOrganizer marks the organizer in PidTagRecipientFlags
+const recipOrganizer = 0x0002
+
+// Appointment is a view of a calendar item (IPM.Appointment) built from its PSETID_Appointment named properties
+type Appointment struct {
+	Message *Message // The underlying message, holding subject, body, attachments and every other property
+
+	Start               time.Time           // PidLidAppointmentStartWhole
+	End                 time.Time           // PidLidAppointmentEndWhole
+	Duration            time.Duration       // PidLidAppointmentDuration
+	AllDay              bool                // PidLidAppointmentSubType
+	Location            string              // PidLidLocation
+	BusyStatus          BusyStatus          // PidLidBusyStatus
+	StateFlags          int32               // PidLidAppointmentStateFlags
+	ResponseStatus      ResponseStatus      // PidLidResponseStatus, the response of the owner of the calendar
+	Sequence            int32               // PidLidAppointmentSequence
+	Recurring           bool                // PidLidRecurring
+	Recurrence          *RecurrencePattern  // PidLidAppointmentRecur, nil unless it holds a valid pattern
+	StartTimeZone       *TimeZoneDefinition // PidLidAppointmentTimeZoneDefinitionStartDisplay, the zone the organizer entered the start in
+	EndTimeZone         *TimeZoneDefinition // PidLidAppointmentTimeZoneDefinitionEndDisplay
+	RecurrenceTimeZone  *TimeZoneDefinition // PidLidAppointmentTimeZoneDefinitionRecur or PidLidTimeZoneStruct, the zone of the Recurrence times
+	TimeZoneDescription string              // PidLidTimeZoneDescription
+	Organizer           Attendee            // The recipient flagged as organizer, or the sender
+	Attendees           []Attendee          // Recipients other than the organizer
+	Reminder            *Reminder           // Set when PidLidReminderSet is true
+}
+
+// Attendee is a recipient of a meeting
+type Attendee struct {
+	Name       string         // PR_DISPLAY_NAME
+	Email      string         // PR_SMTP_ADDRESS or PR_EMAIL_ADDRESS
+	Type       RecipientType  // To for required, CC for optional and BCC for resource attendees
+	Status     ResponseStatus // PidTagRecipientTrackStatus
+	StatusTime time.Time      // PidTagRecipientTrackStatusTime
+}
+
+// Reminder holds the reminder of a calendar item or task
+type Reminder struct {
+	MinutesBefore int32     // PidLidReminderDelta
+	Time          time.Time // PidLidReminderTime
+	SignalTime    time.Time // PidLidReminderSignalTime
+}
+
+// IsMeeting reports whether the appointment has attendees (asfMeeting)
+func (a *Appointment) IsMeeting() bool {
+	return a.StateFlags&AppointmentMeeting != 0
+}
+
+// IsCanceled reports whether the meeting was canceled (asfCanceled)
+func (a *Appointment) IsCanceled() bool {
+	return a.StateFlags&AppointmentCanceled != 0
+}
+
+// Appointment returns the calendar view of the message, or false when its class is neither IPM.Appointment
+// nor a meeting request, response or cancellation (IPM.Schedule.Meeting), which carry the same properties
+func (res *Message) Appointment() (*Appointment, bool) {
+	if !hasClass(res.MessageClass, "IPM.Appointment") && !hasClass(res.MessageClass, "IPM.Schedule.Meeting") {
+		return nil, false
+	}
+	return res.appointment(), true
+}
+
+// appointment builds the calendar view from the named properties, which meeting requests carry as well
+func (res *Message) appointment() *Appointment {
+	a := &Appointment{Message: res}
+	appt := func(lid uint32) interface{} {
+		v, _ := res.NamedValue(PSETIDAppointment, lid)
+		return v
+	}
+
+	a.Start = asTime(appt(lidAppointmentStartWhole))
+	if a.Start.IsZero() {
+		a.Start = asTime(res.Properties[0x0060]) // PR_START_DATE
+	}
+	a.End = asTime(appt(lidAppointmentEndWhole))
+	if a.End.IsZero() {
+		a.End = asTime(res.Properties[0x0061]) // PR_END_DATE
+	}
+	a.Duration = time.Duration(asInt32(appt(lidAppointmentDuration))) * time.Minute
+	if a.Duration == 0 && !a.Start.IsZero() && a.End.After(a.Start) {
+		a.Duration = a.End.Sub(a.Start)
+	}
+	a.AllDay = asBool(appt(lidAppointmentSubType))
+	a.Location = asString(appt(lidLocation))
+	a.BusyStatus = BusyStatus(asInt32(appt(lidBusyStatus)))
+	a.StateFlags = asInt32(appt(lidAppointmentStateFlags))
+	a.ResponseStatus = ResponseStatus(asInt32(appt(lidResponseStatus)))
+	a.Sequence = asInt32(appt(lidAppointmentSequence))
+	a.Recurring = asBool(appt(lidRecurring))
+	if blob := asBytes(appt(lidAppointmentRecur)); len(blob) > 0 {
+		a.Recurrence, _ = ParseRecurrencePattern(blob)
+	}
+
+	a.TimeZoneDescription = asString(appt(lidTimeZoneDescription))
+	a.RecurrenceTimeZone = timeZoneDefinition(appt(lidTZDefRecur))
+	if a.RecurrenceTimeZone == nil {
+		if blob := asBytes(appt(lidTimeZoneStruct)); len(blob) > 0 {
+			a.RecurrenceTimeZone, _ = ParseTimeZoneStruct(blob)
+		}
+	}
+	a.StartTimeZone = timeZoneDefinition(appt(lidTZDefStartDisplay))
+	if a.StartTimeZone == nil {
+		a.StartTimeZone = a.RecurrenceTimeZone
+	}
+	a.EndTimeZone = timeZoneDefinition(appt(lidTZDefEndDisplay))
+	if a.EndTimeZone == nil {
+		a.EndTimeZone = a.StartTimeZone
+	}
+	if a.RecurrenceTimeZone == nil {
+		a.RecurrenceTimeZone = a.StartTimeZone
+	}
+
+	a.Reminder = res.reminder()
+
+	organizer := -1
+	for i, recip := range res.Recipients {
+		if asInt32(recip.Properties[0x5FFD])&recipOrganizer != 0 { // PR_RECIPIENT_FLAGS
+			organizer = i
+			break
+		}
+	}
+	if organizer >= 0 {
+		a.Organizer = newAttendee(res.Recipients[organizer])
+	} else {
+		a.Organizer = Attendee{Name: res.FromName, Email: senderAddress(res), Status: ResponseOrganized}
+	}
+	for i, recip := range res.Recipients {
+		if i != organizer && recip.Type != RecipientOriginator {
+			a.Attendees = append(a.Attendees, newAttendee(recip))
+		}
+	}
+	return a
+}
+
+// reminder returns the reminder of a calendar item or task, or nil if PidLidReminderSet is not set
+func (res *Message) reminder() *Reminder {
+	common := func(lid uint32) interface{} {
+		v, _ := res.NamedValue(PSETIDCommon, lid)
+		return v
+	}
+	if !asBool(common(lidReminderSet)) {
+		return nil
+	}
+	return &Reminder{
+		MinutesBefore: asInt32(common(lidReminderDelta)),
+		Time:          asTime(common(lidReminderTime)),
+		SignalTime:    asTime(common(lidReminderSignalTime)),
+	}
+}
+
+// LocalStart returns Start in the time zone of the organizer, or unchanged if the item has none
+func (a *Appointment) LocalStart() time.Time {
+	if a.StartTimeZone == nil {
+		return a.Start
+	}
+	return a.Start.In(a.StartTimeZone.Location())
+}
+
+// LocalEnd returns End in the time zone of the organizer, or unchanged if the item has none
+func (a *Appointment) LocalEnd() time.Time {
+	if a.EndTimeZone == nil {
+		return a.End
+	}
+	return a.End.In(a.EndTimeZone.Location())
+}
+
+// timeZoneDefinition decodes a TimeZoneDefinition property, returning nil if it is missing or invalid
+func timeZoneDefinition(value interface{}) *TimeZoneDefinition {
+	blob := asBytes(value)
+	if len(blob) == 0 {
+		return nil
+	}
+	tz, err := ParseTimeZoneDefinition(blob)
+	if err != nil {
+		return nil
+	}
+	return tz
+}
+
+// newAttendee builds an attendee from a recipient table row
+func newAttendee(recip Recipient) Attendee {
+	email := recip.SMTPAddress
+	if email == "" {
+		email = recip.EmailAddress
+	}
+	return Attendee{
+		Name:       recip.DisplayName,
+		Email:      email,
+		Type:       recip.Type,
+		Status:     ResponseStatus(asInt32(recip.Properties[0x5FFF])), // PR_RECIPIENT_TRACKSTATUS
+		StatusTime: asTime(recip.Properties[0x5FFB]),                  // PR_RECIPIENT_TRACKSTATUS_TIME
+	}
+}
+
+// senderAddress returns the first address of FromEmail, which may list the sender and the represented user
+func senderAddress(res *Message) string {
+	return strings.TrimSpace(strings.Split(res.FromEmail, ",")[0])
+}
+
+// hasClass reports whether a message class is class or one of its subclasses, comparing case-insensitively as Outlook does
+func hasClass(messageClass, class string) bool {
+	messageClass = strings.ToLower(messageClass)
+	class = strings.ToLower(class)
+	return messageClass == class || strings.HasPrefix(messageClass, class+".")
+}
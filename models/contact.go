@@ -0,0 +1,333 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Named properties of PSETID_Address (MS-OXOCNTC)
+const (
+	lidFileUnder            = 0x8005 // PidLidFileUnder
+	lidHasPicture           = 0x8015 // PidLidHasPicture
+	lidHTML                 = 0x802B // PidLidHtml, the web page
+	lidWorkAddressStreet    = 0x8045 // PidLidWorkAddressStreet
+	lidWorkAddressCity      = 0x8046 // PidLidWorkAddressCity
+	lidWorkAddressState     = 0x8047 // PidLidWorkAddressState
+	lidWorkAddressPostal    = 0x8048 // PidLidWorkAddressPostalCode
+	lidWorkAddressCountry   = 0x8049 // PidLidWorkAddressCountry
+	lidWorkAddressPOBox     = 0x804A // PidLidWorkAddressPostOfficeBox
+	lidInstantMessaging     = 0x8062 // PidLidInstantMessagingAddress
+	lidEmail1DisplayName    = 0x8080 // PidLidEmail1DisplayName, followed by the email 2 and 3 properties at 0x8090 and 0x80A0
+	lidBirthdayLocal        = 0x80DE // PidLidBirthdayLocal
+	lidWeddingAnniversaryLo = 0x80DF // PidLidWeddingAnniversaryLocal
+)
+
+// Offsets of the email properties from PidLidEmail1DisplayName, PidLidEmail2DisplayName and PidLidEmail3DisplayName
+const (
+	emailDisplayName         = 0x0 // PidLidEmailNDisplayName
+	emailAddressType         = 0x2 // PidLidEmailNAddressType
+	emailAddress             = 0x3 // PidLidEmailNEmailAddress
+	emailOriginalDisplayName = 0x4 // PidLidEmailNOriginalDisplayName
+)
+
+// Contact is a view of a contact (IPM.Contact) built from its PidTag and PSETID_Address properties
+type Contact struct {
+	Message *Message // The underlying message, holding the notes in its body and every other property
+
+	DisplayName string // PR_DISPLAY_NAME
+	FileUnder   string // PidLidFileUnder
+	Prefix      string // PR_DISPLAY_NAME_PREFIX
+	GivenName   string // PR_GIVEN_NAME
+	MiddleName  string // PR_MIDDLE_NAME
+	Surname     string // PR_SURNAME
+	Suffix      string // PR_GENERATION
+	Nickname    string // PR_NICKNAME
+	Company     string // PR_COMPANY_NAME
+	Department  string // PR_DEPARTMENT_NAME
+	JobTitle    string // PR_TITLE
+	Office      string // PR_OFFICE_LOCATION
+	Emails      []ContactEmail
+	Phones      []ContactPhone
+	Addresses   []ContactAddress
+	Birthday    time.Time   // PidLidBirthdayLocal or PR_BIRTHDAY, at midnight UTC of the date
+	Anniversary time.Time   // PidLidWeddingAnniversaryLocal or PR_WEDDING_ANNIVERSARY, at midnight UTC of the date
+	WebPage     string      // PidLidHtml, PR_BUSINESS_HOME_PAGE or PR_PERSONAL_HOME_PAGE
+	IMAddress   string      // PidLidInstantMessagingAddress
+	Categories  []string    // Keywords
+	Photo       *Attachment // The attachment flagged as contact photo (PR_ATTACHMENT_CONTACTPHOTO)
+}
+
+// ContactEmail is one of the three email addresses of a contact
+type ContactEmail struct {
+	DisplayName string // PidLidEmailNDisplayName
+	Address     string // PidLidEmailNEmailAddress, or the SMTP address from PidLidEmailNOriginalDisplayName for Exchange addresses
+	AddressType string // PidLidEmailNAddressType, such as SMTP or EX
+}
+
+// ContactPhone is a phone number of a contact. Kind is one of business, business2, home, home2, mobile, business-fax,
+// home-fax, primary-fax, primary, company, other, pager, car, callback, assistant, radio, isdn or tty.
+type ContactPhone struct {
+	Kind   string
+	Number string
+}
+
+// ContactAddress is a postal address of a contact. Kind is home, business or other.
+type ContactAddress struct {
+	Kind       string
+	Street     string
+	City       string
+	State      string
+	PostalCode string
+	Country    string
+	POBox      string
+}
+
+// contactPhones lists the phone number properties in the order they are reported
+var contactPhones = []struct {
+	tag  int64
+	kind string
+}{
+	{0x3A1A, "primary"},      // PR_PRIMARY_TELEPHONE_NUMBER
+	{0x3A08, "business"},     // PR_BUSINESS_TELEPHONE_NUMBER
+	{0x3A1B, "business2"},    // PR_BUSINESS2_TELEPHONE_NUMBER
+	{0x3A57, "company"},      // PR_COMPANY_MAIN_PHONE_NUMBER
+	{0x3A1C, "mobile"},       // PR_MOBILE_TELEPHONE_NUMBER
+	{0x3A09, "home"},         // PR_HOME_TELEPHONE_NUMBER
+	{0x3A2F, "home2"},        // PR_HOME2_TELEPHONE_NUMBER
+	{0x3A24, "business-fax"}, // PR_BUSINESS_FAX_NUMBER
+	{0x3A25, "home-fax"},     // PR_HOME_FAX_NUMBER
+	{0x3A23, "primary-fax"},  // PR_PRIMARY_FAX_NUMBER
+	{0x3A1F, "other"},        // PR_OTHER_TELEPHONE_NUMBER
+	{0x3A21, "pager"},        // PR_PAGER_TELEPHONE_NUMBER
+	{0x3A1E, "car"},          // PR_CAR_TELEPHONE_NUMBER
+	{0x3A02, "callback"},     // PR_CALLBACK_TELEPHONE_NUMBER
+	{0x3A2E, "assistant"},    // PR_ASSISTANT_TELEPHONE_NUMBER
+	{0x3A1D, "radio"},        // PR_RADIO_TELEPHONE_NUMBER
+	{0x3A2D, "isdn"},         // PR_ISDN_NUMBER
+	{0x3A4B, "tty"},          // PR_TTYTDD_PHONE_NUMBER
+}
+
+// Contact returns the contact view of the message, or false when its class is not IPM.Contact
+func (res *Message) Contact() (*Contact, bool) {
+	if !hasClass(res.MessageClass, "IPM.Contact") {
+		return nil, false
+	}
+	address := func(lid uint32) string {
+		v, _ := res.NamedValue(PSETIDAddress, lid)
+		return asString(v)
+	}
+	tag := func(id int64) string {
+		return asString(res.Properties[id])
+	}
+
+	c := &Contact{
+		Message:     res,
+		DisplayName: tag(0x3001),
+		FileUnder:   address(lidFileUnder),
+		Prefix:      tag(0x3A45),
+		GivenName:   tag(0x3A06),
+		MiddleName:  tag(0x3A44),
+		Surname:     tag(0x3A11),
+		Suffix:      tag(0x3A05),
+		Nickname:    tag(0x3A4F),
+		Company:     tag(0x3A16),
+		Department:  tag(0x3A18),
+		JobTitle:    tag(0x3A17),
+		Office:      tag(0x3A19),
+		IMAddress:   address(lidInstantMessaging),
+	}
+	if c.DisplayName == "" {
+		c.DisplayName = res.Subject
+	}
+
+	for base := uint32(lidEmail1DisplayName); base <= lidEmail1DisplayName+0x20; base += 0x10 {
+		email := ContactEmail{
+			DisplayName: address(base + emailDisplayName),
+			Address:     address(base + emailAddress),
+			AddressType: address(base + emailAddressType),
+		}
+		if original := address(base + emailOriginalDisplayName); !strings.EqualFold(email.AddressType, "SMTP") && isValidEmail(original) {
+			email.Address = original
+		}
+		if email.Address != "" {
+			c.Emails = append(c.Emails, email)
+		}
+	}
+
+	for _, phone := range contactPhones {
+		if number := tag(phone.tag); number != "" {
+			c.Phones = append(c.Phones, ContactPhone{Kind: phone.kind, Number: number})
+		}
+	}
+
+	business := ContactAddress{
+		Kind:       "business",
+		Street:     address(lidWorkAddressStreet),
+		City:       address(lidWorkAddressCity),
+		State:      address(lidWorkAddressState),
+		PostalCode: address(lidWorkAddressPostal),
+		Country:    address(lidWorkAddressCountry),
+		POBox:      address(lidWorkAddressPOBox),
+	}
+	if business == (ContactAddress{Kind: "business"}) {
+		// PR_BUSINESS_ADDRESS_* holds the mailing address, which is the business one unless the user picked another
+		business = ContactAddress{Kind: "business", Street: tag(0x3A29), City: tag(0x3A27), State: tag(0x3A28), PostalCode: tag(0x3A2A), Country: tag(0x3A26), POBox: tag(0x3A2B)}
+	}
+	for _, addr := range []ContactAddress{
+		{Kind: "home", Street: tag(0x3A5D), City: tag(0x3A59), State: tag(0x3A5C), PostalCode: tag(0x3A5B), Country: tag(0x3A5A), POBox: tag(0x3A5E)},
+		business,
+		{Kind: "other", Street: tag(0x3A63), City: tag(0x3A5F), State: tag(0x3A62), PostalCode: tag(0x3A61), Country: tag(0x3A60), POBox: tag(0x3A64)},
+	} {
+		if addr != (ContactAddress{Kind: addr.Kind}) {
+			c.Addresses = append(c.Addresses, addr)
+		}
+	}
+
+	birthday, _ := res.NamedValue(PSETIDAddress, lidBirthdayLocal)
+	c.Birthday = contactDate(birthday, res.Properties[0x3A42]) // PR_BIRTHDAY
+	anniversary, _ := res.NamedValue(PSETIDAddress, lidWeddingAnniversaryLo)
+	c.Anniversary = contactDate(anniversary, res.Properties[0x3A41]) // PR_WEDDING_ANNIVERSARY
+
+	for _, page := range []string{address(lidHTML), tag(0x3A51), tag(0x3A50)} { // PR_BUSINESS_HOME_PAGE, PR_PERSONAL_HOME_PAGE
+		if page != "" {
+			c.WebPage = page
+			break
+		}
+	}
+	keywords, _ := res.NamedValueByName(PSPublicStrings, "Keywords")
+	c.Categories, _ = keywords.([]string)
+
+	hasPicture, _ := res.NamedValue(PSETIDAddress, lidHasPicture)
+	for i, att := range res.Attachments {
+		// PR_ATTACHMENT_CONTACTPHOTO, or the name Outlook gives the photo
+		if asBool(att.Properties[0x7FFF]) || asBool(hasPicture) && strings.EqualFold(att.FileName, "ContactPicture.jpg") {
+			c.Photo = &res.Attachments[i]
+			break
+		}
+	}
+	return c, true
+}
+
+// contactDate returns the date of a birthday or anniversary. The local variant is stored at midnight UTC, the PidTag one
+// at local midnight converted to UTC, which is rounded to the nearest day.
+func contactDate(local, utc interface{}) time.Time {
+	if t := asTime(local); !t.IsZero() {
+		return dateOf(t)
+	}
+	if t := asTime(utc); !t.IsZero() {
+		return dateOf(t.Add(12 * time.Hour))
+	}
+	return time.Time{}
+}
+
+// vCardPhoneTypes maps phone kinds to vCard TYPE parameters
+var vCardPhoneTypes = map[string]string{
+	"primary":      "voice;PREF=1",
+	"business":     `"work,voice"`,
+	"business2":    `"work,voice"`,
+	"company":      `"work,voice"`,
+	"mobile":       `"cell,voice"`,
+	"home":         `"home,voice"`,
+	"home2":        `"home,voice"`,
+	"business-fax": `"work,fax"`,
+	"home-fax":     `"home,fax"`,
+	"primary-fax":  "fax",
+	"pager":        "pager",
+	"tty":          "textphone",
+}
+
+// WriteVCard writes the contact as a vCard 4.0 (RFC 6350)
+func (c *Contact) WriteVCard(w io.Writer) error {
+	vc := &lineWriter{}
+	vc.line("BEGIN", "VCARD")
+	vc.line("VERSION", "4.0")
+	fn := c.DisplayName
+	if fn == "" {
+		fn = strings.Join(strings.Fields(strings.Join([]string{c.GivenName, c.MiddleName, c.Surname}, " ")), " ")
+	}
+	if fn == "" && len(c.Emails) > 0 {
+		fn = c.Emails[0].Address
+	}
+	vc.line("FN", escapeText(fn))
+	vc.line("N", structured(c.Surname, c.GivenName, c.MiddleName, c.Prefix, c.Suffix))
+	vc.text("NICKNAME", c.Nickname)
+	if c.Company != "" || c.Department != "" {
+		vc.line("ORG", structured(c.Company, c.Department))
+	}
+	vc.text("TITLE", c.JobTitle)
+	for i, email := range c.Emails {
+		name := "EMAIL"
+		if i == 0 {
+			name += ";PREF=1"
+		}
+		vc.text(name, email.Address)
+	}
+	for _, phone := range c.Phones {
+		types, ok := vCardPhoneTypes[phone.Kind]
+		if !ok {
+			types = "voice"
+		}
+		vc.text("TEL;TYPE="+types, phone.Number)
+	}
+	for _, addr := range c.Addresses {
+		name := "ADR"
+		switch addr.Kind {
+		case "home":
+			name += ";TYPE=home"
+		case "business":
+			name += ";TYPE=work"
+		}
+		vc.line(name, structured(addr.POBox, "", addr.Street, addr.City, addr.State, addr.PostalCode, addr.Country))
+	}
+	if !c.Birthday.IsZero() {
+		vc.line("BDAY", c.Birthday.Format(icsDate))
+	}
+	if !c.Anniversary.IsZero() {
+		vc.line("ANNIVERSARY", c.Anniversary.Format(icsDate))
+	}
+	vc.text("URL", c.WebPage)
+	if strings.Contains(c.IMAddress, ":") {
+		vc.text("IMPP", c.IMAddress)
+	}
+	if len(c.Categories) > 0 {
+		categories := make([]string, len(c.Categories))
+		for i, category := range c.Categories {
+			categories[i] = escapeText(category)
+		}
+		vc.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	vc.text("NOTE", c.Message.BodyPlainText)
+	if c.Photo != nil && len(c.Photo.Data) > 0 {
+		vc.line("PHOTO", "data:"+photoType(c.Photo)+";base64,"+base64.StdEncoding.EncodeToString(c.Photo.Data))
+	}
+	vc.line("END", "VCARD")
+	_, err := w.Write(vc.buf.Bytes())
+	return err
+}
+
+// structured escapes the components of a structured value and joins them with ";"
+func structured(components ...string) string {
+	for i, component := range components {
+		components[i] = escapeText(component)
+	}
+	return strings.Join(components, ";")
+}
+
+// photoType returns the media type of a contact photo, from its MIME tag or file name
+func photoType(att *Attachment) string {
+	if att.MimeType != "" {
+		return att.MimeType
+	}
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(att.FileName))); t != "" {
+		return strings.Split(t, ";")[0]
+	}
+	if bytes.HasPrefix(att.Data, []byte("\x89PNG")) {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// Named properties of PSETID_Address for distribution lists
+const (
+	lidDistListOneOffMembers = 0x8054 // PidLidDistributionListOneOffMembers
+	lidDistListMembers       = 0x8055 // PidLidDistributionListMembers
+	lidDistListName          = 0x8053 // PidLidDistributionListName
+)
+
+// Provider UIDs of entry ids (MS-OXCDATA 2.2.5)
+var (
+	oneOffProvider  = []byte{0x81, 0x2B, 0x1F, 0xA4, 0xBE, 0xA3, 0x10, 0x19, 0x9D, 0x6E, 0x00, 0xDD, 0x01, 0x0F, 0x54, 0x02}
+	wrappedProvider = []byte{0xC0, 0x91, 0xAD, 0xD3, 0x51, 0x9D, 0xCF, 0x11, 0xA4, 0xA9, 0x00, 0xAA, 0x00, 0x47, 0xFA, 0xA4}
+	galProvider     = []byte{0xDC, 0xA7, 0x40, 0xC8, 0xC0, 0x42, 0x10, 0x1A, 0xB4, 0xB9, 0x08, 0x00, 0x2B, 0x2F, 0xE1, 0x82}
+)
+
+// DistListMemberKind tells what a distribution list member refers to, from the type of its WrappedEntryId
+type DistListMemberKind int
+
+// Kinds of distribution list members
+const (
+	MemberOneOff      DistListMemberKind = 0x00 // An address that is not in any address book
+	MemberContact     DistListMemberKind = 0x03 // A contact of the mailbox
+	MemberDistList    DistListMemberKind = 0x04 // A personal distribution list of the mailbox
+	MemberGALUser     DistListMemberKind = 0x05 // A user of the global address list
+	MemberGALDistList DistListMemberKind = 0x06 // A distribution list of the global address list
+)
+
+// DistList is a view of a personal distribution list (IPM.DistList)
+type DistList struct {
+	Message *Message // The underlying message
+
+	Name    string // PidLidDistributionListName
+	Members []DistListMember
+}
+
+// DistListMember is a member of a distribution list
+type DistListMember struct {
+	DisplayName string
+	Address     string
+	AddressType string // SMTP, or EX for global address list entries
+	Kind        DistListMemberKind
+	EntryID     []byte // Entry id from PidLidDistributionListMembers
+}
+
+// IsList reports whether the member is a nested distribution list
+func (m DistListMember) IsList() bool {
+	return m.Kind == MemberDistList || m.Kind == MemberGALDistList
+}
+
+// DistList returns the distribution list view of the message, or false when its class is not IPM.DistList.
+// Names and addresses come from PidLidDistributionListOneOffMembers, which parallels the member entry ids;
+// lists too large for these properties, which Outlook keeps in PidLidDistributionListStream, are not decoded.
+func (res *Message) DistList() (*DistList, bool) {
+	if !hasClass(res.MessageClass, "IPM.DistList") {
+		return nil, false
+	}
+	d := &DistList{Message: res}
+	name, _ := res.NamedValue(PSETIDAddress, lidDistListName)
+	if d.Name = asString(name); d.Name == "" {
+		d.Name = res.Subject
+	}
+	membersValue, _ := res.NamedValue(PSETIDAddress, lidDistListMembers)
+	oneOffsValue, _ := res.NamedValue(PSETIDAddress, lidDistListOneOffMembers)
+	members, _ := membersValue.([][]byte)
+	oneOffs, _ := oneOffsValue.([][]byte)
+	if len(members) == 0 {
+		members = oneOffs
+	}
+
+	for i, entryID := range members {
+		m := DistListMember{EntryID: entryID}
+		embedded := entryID
+		if len(entryID) > 21 && bytes.Equal(entryID[4:20], wrappedProvider) {
+			m.Kind = DistListMemberKind(entryID[20] & 0x0F)
+			embedded = entryID[21:]
+		}
+		if i < len(oneOffs) {
+			m.DisplayName, m.AddressType, m.Address, _ = parseOneOffEntryID(oneOffs[i])
+		}
+		if m.Address == "" {
+			if name, addrType, addr, ok := parseOneOffEntryID(embedded); ok {
+				m.DisplayName, m.AddressType, m.Address = name, addrType, addr
+			} else if dn, ok := parseGALEntryID(embedded); ok {
+				m.AddressType, m.Address = "EX", dn
+			}
+		}
+		d.Members = append(d.Members, m)
+	}
+	return d, true
+}
+
+// parseOneOffEntryID decodes the display name, address type and address of a one-off entry id (MS-OXCDATA 2.2.5.1)
+func parseOneOffEntryID(data []byte) (name, addrType, address string, ok bool) {
+	if len(data) < 24 || !bytes.Equal(data[4:20], oneOffProvider) {
+		return "", "", "", false
+	}
+	flags := binary.LittleEndian.Uint16(data[22:24])
+	rest := data[24:]
+	next := func() string {
+		if flags&0x8000 != 0 { // MAPI_UNICODE
+			var units []uint16
+			for len(rest) >= 2 {
+				u := binary.LittleEndian.Uint16(rest)
+				rest = rest[2:]
+				if u == 0 {
+					break
+				}
+				units = append(units, u)
+			}
+			return string(utf16.Decode(units))
+		}
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			end = len(rest)
+		}
+		s := string(rest[:end])
+		rest = rest[min(end+1, len(rest)):]
+		return s
+	}
+	name, addrType, address = next(), next(), next()
+	return name, addrType, address, true
+}
+
+// parseGALEntryID returns the X500 distinguished name of an address book entry id (MS-OXCDATA 2.2.5.2)
+func parseGALEntryID(data []byte) (string, bool) {
+	if len(data) < 28 || !bytes.Equal(data[4:20], galProvider) {
+		return "", false
+	}
+	dn := data[28:]
+	if end := bytes.IndexByte(dn, 0); end >= 0 {
+		dn = dn[:end]
+	}
+	return string(dn), true
+}
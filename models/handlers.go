@@ -0,0 +1,253 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Value is a decoded property value, with the Go type the parser uses for its property type (see PropertyTypeOf)
+type Value = interface{}
+
+// PropertyHandler maps a property value read from a msg file onto a message.
+// Returning nil consumes the value; returning ErrKeepProperty, or any other error, stores it in Properties instead.
+type PropertyHandler func(msg *Message, value Value) error
+
+// ErrKeepProperty is returned by a PropertyHandler to have the value stored in Properties as if it had no handler
+var ErrKeepProperty = errors.New("keep property")
+
+var (
+	handlersMu    sync.RWMutex
+	handlers      = make(map[int64]PropertyHandler)
+	namedHandlers = make(map[NamedProperty]PropertyHandler)
+)
+
+// RegisterPropertyHandler sets the handler called by SetProperties for the property with the given tag,
+// which is the property id (the high word of a property tag) as used as key of Properties.
+// It replaces the handler registered before, including the built-in ones, and a nil handler removes it.
+func RegisterPropertyHandler(tag int64, handler PropertyHandler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	if handler == nil {
+		delete(handlers, tag)
+		return
+	}
+	handlers[tag] = handler
+}
+
+// RegisterNamedPropertyHandler sets the handler called by ApplyNamedPropertyHandlers for a named property.
+// Named properties only get their name once the whole file is read, so these handlers run after all SetProperties calls.
+// Only the message's own Properties are looked at: named properties of recipients and attachments stay in their Properties.
+func RegisterNamedPropertyHandler(np NamedProperty, handler PropertyHandler) {
+	np.GUID = strings.ToLower(np.GUID)
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	if handler == nil {
+		delete(namedHandlers, np)
+		return
+	}
+	namedHandlers[np] = handler
+}
+
+// LookupPropertyHandler returns the handler registered for a property id, or nil.
+// A custom handler can use it to fall back to the built-in one.
+func LookupPropertyHandler(tag int64) PropertyHandler {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	return handlers[tag]
+}
+
+// ApplyNamedPropertyHandlers calls the handlers registered for the named properties in Properties,
+// removing the values they consume. The Properties of Recipients and Attachments are left alone, as a
+// PropertyHandler can only map a value onto the message.
+func (res *Message) ApplyNamedPropertyHandlers() {
+	handlersMu.RLock()
+	if len(namedHandlers) == 0 {
+		handlersMu.RUnlock()
+		return
+	}
+	found := make(map[int64]PropertyHandler)
+	for id := range res.Properties {
+		if np, ok := res.NamedProperties[id]; ok {
+			if handler, ok := namedHandlers[np]; ok {
+				found[id] = handler
+			}
+		}
+	}
+	handlersMu.RUnlock()
+
+	for _, id := range sortedIDs(found) {
+		if res.applyHandler(found[id], id, res.Properties[id]) {
+			delete(res.Properties, id)
+			delete(res.PropertyTypes, id)
+		}
+	}
+}
+
+// applyHandler runs a handler, reporting whether it consumed the value
+func (res *Message) applyHandler(handler PropertyHandler, tag int64, value Value) bool {
+	err := handler(res, value)
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, ErrKeepProperty) {
+		log.Printf("Property %04x: %v", tag, err)
+	}
+	return false
+}
+
+func init() {
+	for tag, handler := range map[int64]PropertyHandler{
+		0x001A: stringHandler(func(m *Message) *string { return &m.MessageClass }),          // PR_MESSAGE_CLASS
+		0x1035: stringHandler(func(m *Message) *string { return &m.MessageID }),             // PR_INTERNET_MESSAGE_ID
+		0x0037: stringHandler(func(m *Message) *string { return &m.Subject }),               // PR_SUBJECT
+		0x0E1D: handleNormalizedSubject,                                                     // PR_NORMALIZED_SUBJECT
+		0x0C1F: handleSenderAddress,                                                         // PR_SENDER_EMAIL_ADDRESS
+		0x0065: handleSenderAddress,                                                         // PR_SENT_REPRESENTING_EMAIL_ADDRESS
+		0x0042: stringHandler(func(m *Message) *string { return &m.FromName }),              // PR_SENT_REPRESENTING_NAME
+		0x0C1A: stringHandler(func(m *Message) *string { return &m.FromName }),              // PR_SENDER_NAME
+		0x3FFA: handleLastModifierName,                                                      // PR_LAST_MODIFIER_NAME
+		0x3FDE: handleInternetCodepage,                                                      // PR_INTERNET_CPID
+		0x0E1B: dropProperty,                                                                // PR_HASATTACH: derived from the message when it is written
+		0x340D: dropProperty,                                                                // PR_STORE_SUPPORT_MASK: derived from the message when it is written
+		0x3007: timeHandler(func(m *Message) *time.Time { return &m.CreationDate }),         // PR_CREATION_TIME
+		0x3008: timeHandler(func(m *Message) *time.Time { return &m.LastModificationDate }), // PR_LAST_MODIFICATION_TIME
+		0x0039: timeHandler(func(m *Message) *time.Time { return &m.ClientSubmitTime }),     // PR_CLIENT_SUBMIT_TIME
+		0x0E06: timeHandler(func(m *Message) *time.Time { return &m.Date }),                 // PR_MESSAGE_DELIVERY_TIME
+		0x1000: handleBody,                                                                  // PR_BODY
+		0x1013: handleHTMLBody,                                                              // PR_HTML
+		0x0E04: stringHandler(func(m *Message) *string { return &m.ToDisplay }),             // PR_DISPLAY_TO
+		0x0E03: stringHandler(func(m *Message) *string { return &m.CCDisplay }),             // PR_DISPLAY_CC
+		0x0E02: stringHandler(func(m *Message) *string { return &m.BCCDisplay }),            // PR_DISPLAY_BCC
+		0x007D: handleTransportHeaders,                                                      // PR_TRANSPORT_MESSAGE_HEADERS
+		0x3003: handleRecipientAddress,                                                      // PR_EMAIL_ADDRESS
+		0x39FE: handleRecipientAddress,                                                      // PR_SMTP_ADDRESS
+	} {
+		RegisterPropertyHandler(tag, handler)
+	}
+}
+
+// stringHandler sets a string field unless an earlier property already set it
+func stringHandler(field func(*Message) *string) PropertyHandler {
+	return func(res *Message, value Value) error {
+		if s, ok := value.(string); ok && *field(res) == "" {
+			*field(res) = s
+		}
+		return nil
+	}
+}
+
+// timeHandler sets a time field unless an earlier property already set it
+func timeHandler(field func(*Message) *time.Time) PropertyHandler {
+	return func(res *Message, value Value) error {
+		if t, ok := value.(time.Time); ok && field(res).IsZero() {
+			*field(res) = t
+		}
+		return nil
+	}
+}
+
+// dropProperty consumes a property without setting anything
+func dropProperty(res *Message, value Value) error {
+	return nil
+}
+
+// handleNormalizedSubject uses PR_NORMALIZED_SUBJECT as subject when the message has no PR_SUBJECT
+func handleNormalizedSubject(res *Message, value Value) error {
+	if res.Subject != "" {
+		return ErrKeepProperty
+	}
+	res.Subject, _ = value.(string)
+	return nil
+}
+
+// handleSenderAddress adds a valid sender address to FromEmail. The value is kept in Properties as well, as the
+// order of FromEmail depends on the order the sender properties are read in.
+func handleSenderAddress(res *Message, value Value) error {
+	address, ok := value.(string)
+	if !ok || !isValidEmail(address) {
+		return ErrKeepProperty
+	}
+	if res.FromEmail == "" {
+		res.FromEmail = address
+	} else if !contains(strings.Split(res.FromEmail, ", "), address) {
+		res.FromEmail = address + ", " + res.FromEmail
+	}
+	return ErrKeepProperty
+}
+
+// handleLastModifierName uses the last modifier as sender name when no sender property named one
+func handleLastModifierName(res *Message, value Value) error {
+	if res.FromName != "" {
+		return ErrKeepProperty
+	}
+	res.FromName, _ = value.(string)
+	return nil
+}
+
+// handleInternetCodepage keeps the code page PR_HTML is decoded with
+func handleInternetCodepage(res *Message, value Value) error {
+	if cpid, ok := value.(int32); ok {
+		res.internetCodepage = cpid
+	}
+	return nil
+}
+
+// handleTransportHeaders sets TransportMessageHeaders from the first header property found
+func handleTransportHeaders(res *Message, value Value) error {
+	if res.TransportMessageHeaders != "" {
+		return nil
+	}
+	switch v := value.(type) {
+	case []uint8:
+		res.TransportMessageHeaders = string(v)
+	case string:
+		res.TransportMessageHeaders = v
+	default:
+		return fmt.Errorf("unexpected type %T", value)
+	}
+	return nil
+}
+
+// handleRecipientAddress adds an address found on the message itself to To
+func handleRecipientAddress(res *Message, value Value) error {
+	address, ok := value.(string)
+	if !ok || !isValidEmail(address) {
+		return ErrKeepProperty
+	}
+	res.Address = append(res.Address, address)
+	if !strings.Contains(res.To, address) {
+		res.To = res.To + address + "; "
+	}
+	return nil
+}
+
+// handleBody keeps PR_BODY for CalculateFinalBody
+func handleBody(res *Message, value Value) error {
+	switch v := value.(type) {
+	case []uint8:
+		res.bodyText = string(v)
+	case string:
+		res.bodyText = v
+	default:
+		return fmt.Errorf("unexpected type %T", value)
+	}
+	return nil
+}
+
+// handleHTMLBody keeps PR_HTML for CalculateFinalBody
+func handleHTMLBody(res *Message, value Value) error {
+	switch v := value.(type) {
+	case []uint8:
+		// PR_HTML is binary, it is decoded once PR_INTERNET_CPID is known
+		res.bodyHTMLRaw = v
+	case string:
+		res.bodyHTML = v
+	default:
+		return fmt.Errorf("unexpected type %T", value)
+	}
+	return nil
+}
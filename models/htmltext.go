@@ -0,0 +1,254 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// skippedElements hold no text meant to be read
+var skippedElements = map[string]bool{
+	"head": true, "title": true, "script": true, "style": true, "noscript": true, "template": true, "xml": true,
+	"object": true, "iframe": true, "svg": true, "math": true, "select": true, "button": true,
+}
+
+// blockElements start and end on a line of their own; paragraphs are also separated by a blank line
+var blockElements = map[string]int{
+	"address": 1, "article": 1, "aside": 1, "caption": 1, "center": 1, "dd": 1, "div": 1, "dl": 1, "dt": 1,
+	"figcaption": 1, "figure": 1, "footer": 1, "form": 1, "header": 1, "li": 1, "main": 1, "nav": 1, "section": 1,
+	"tr": 1, "h1": 2, "h2": 2, "h3": 2, "h4": 2, "h5": 2, "h6": 2, "ol": 2, "p": 2, "pre": 2, "table": 2, "ul": 2,
+}
+
+// collapsibleSpace matches the white space HTML renders as a single space; non-breaking spaces are kept
+var collapsibleSpace = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// blankLines matches the line breaks and blank lines beyond a single blank line
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// HTMLToText renders an HTML body as plain text. Block elements and line breaks start new lines and paragraphs
+// are separated by blank lines, except the MsoNormal paragraphs Outlook uses for every line. List items are
+// bulleted or numbered and indented by nesting, table cells are separated by " | ", quotes are prefixed with "> "
+// and links are numbered, with their URLs listed as footnotes. Entities are decoded. Styles, scripts, comments,
+// which include Outlook conditional comments, and elements hidden with display:none are skipped.
+func HTMLToText(body string) string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	return renderText(doc, true)
+}
+
+// renderText returns the text of an HTML tree, with the URLs of its links as footnotes when footnotes is set
+func renderText(doc *html.Node, footnotes bool) string {
+	w := &textWriter{}
+	if footnotes {
+		w.links = new([]string)
+	}
+	w.render(doc)
+	text := w.String()
+	if w.links != nil && len(*w.links) > 0 {
+		var notes []string
+		for i, link := range *w.links {
+			notes = append(notes, fmt.Sprintf("[%d] %s", i+1, link))
+		}
+		text += "\n\n" + strings.Join(notes, "\n")
+	}
+	return text
+}
+
+// textWriter accumulates the text of an HTML tree
+type textWriter struct {
+	buf    strings.Builder
+	breaks int       // Line breaks to write before the next text
+	space  bool      // Whether a space separates the next text from the previous one
+	pre    int       // Depth of <pre> elements
+	cells  int       // Depth of table cells, whose blocks are kept on the line of their row
+	lists  []int     // Next number of each enclosing list, 0 for bulleted lists
+	links  *[]string // URLs of the footnotes, shared with the writers of quotes; nil without footnotes
+}
+
+// block requests n line breaks before the next text, a space inside table cells
+func (w *textWriter) block(n int) {
+	if w.cells > 0 {
+		w.space = true
+		return
+	}
+	if n > w.breaks {
+		w.breaks = n
+	}
+}
+
+// write appends text, preceded by the pending line breaks or space
+func (w *textWriter) write(text string) {
+	if text == "" {
+		return
+	}
+	if w.buf.Len() > 0 {
+		written := w.buf.String()
+		if w.breaks > 0 {
+			trailing := 0
+			for i := len(written) - 1; i >= 0 && written[i] == '\n'; i-- {
+				trailing++
+			}
+			w.buf.WriteString(strings.Repeat("\n", max(w.breaks-trailing, 0)))
+		} else if w.space && !strings.HasSuffix(written, " ") {
+			w.buf.WriteString(" ")
+		}
+	}
+	w.breaks, w.space = 0, false
+	w.buf.WriteString(text)
+}
+
+// text appends the content of a text node, with its white space collapsed outside <pre>
+func (w *textWriter) text(data string) {
+	if w.pre > 0 {
+		w.write(data)
+		return
+	}
+	data = collapsibleSpace.ReplaceAllString(data, " ")
+	if strings.HasPrefix(data, " ") {
+		w.space = true
+	}
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(data, " "), " ")
+	w.write(trimmed)
+	if trimmed != "" && strings.HasSuffix(data, " ") {
+		w.space = true
+	}
+}
+
+// render appends the text of n and its descendants
+func (w *textWriter) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.DocumentNode:
+		w.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	name := strings.ToLower(n.Data)
+	style := strings.ToLower(strings.ReplaceAll(attr(n, "style"), " ", ""))
+	if skippedElements[name] || strings.HasPrefix(name, "v:") || strings.Contains(style, "display:none") {
+		return
+	}
+
+	breaks := blockElements[name]
+	if name == "p" && strings.Contains(attr(n, "class"), "MsoNormal") {
+		breaks = 1
+	}
+	if (name == "ul" || name == "ol") && len(w.lists) > 0 {
+		breaks = 1 // nested lists
+	}
+	w.block(breaks)
+
+	switch name {
+	case "br":
+		if w.cells > 0 {
+			w.space = true
+		} else {
+			// Consecutive <br> make blank lines
+			w.breaks++
+		}
+	case "hr":
+		w.block(1)
+		w.write("----------")
+		w.block(1)
+	case "img":
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			w.write("[" + alt + "]")
+		}
+	case "pre":
+		w.pre++
+		w.children(n)
+		w.pre--
+	case "ul", "ol":
+		next := 0
+		if name == "ol" {
+			next = 1
+		}
+		w.lists = append(w.lists, next)
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+	case "li":
+		marker := "* "
+		if depth := len(w.lists); depth > 0 {
+			if next := w.lists[depth-1]; next > 0 {
+				marker = fmt.Sprintf("%d. ", next)
+				w.lists[depth-1]++
+			}
+			marker = strings.Repeat("  ", depth-1) + marker
+		}
+		w.write(marker)
+		w.children(n)
+	case "td", "th":
+		for prev := n.PrevSibling; prev != nil; prev = prev.PrevSibling {
+			if prev.Type == html.ElementNode && (prev.Data == "td" || prev.Data == "th") {
+				w.write("|")
+				w.space = true
+				break
+			}
+		}
+		w.cells++
+		w.children(n)
+		w.cells--
+		w.space = true
+	case "blockquote":
+		quote := &textWriter{links: w.links, cells: w.cells}
+		quote.children(n)
+		if text := quote.String(); text != "" {
+			lines := strings.Split(text, "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimRight("> "+line, " ")
+			}
+			w.block(2)
+			w.write(strings.Join(lines, "\n"))
+		}
+		w.block(2)
+	case "a":
+		start := w.buf.Len()
+		w.children(n)
+		label := strings.TrimSpace(w.buf.String()[start:])
+		if href := strings.TrimSpace(attr(n, "href")); w.links != nil && footnote(href, label) {
+			*w.links = append(*w.links, href)
+			w.write(fmt.Sprintf("[%d]", len(*w.links)))
+		}
+	default:
+		w.children(n)
+	}
+	w.block(breaks)
+}
+
+func (w *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.render(c)
+	}
+}
+
+// footnote reports whether the URL of a link is worth a footnote: it points to a document or an address that
+// is not already its label
+func footnote(href, label string) bool {
+	lower := strings.ToLower(href)
+	switch {
+	case strings.HasPrefix(lower, "http:"), strings.HasPrefix(lower, "https:"), strings.HasPrefix(lower, "ftp:"):
+		return href != label && strings.TrimRight(href, "/") != strings.TrimRight(label, "/")
+	case strings.HasPrefix(lower, "mailto:"):
+		return !strings.EqualFold(strings.SplitN(href[len("mailto:"):], "?", 2)[0], label)
+	}
+	return false
+}
+
+// String returns the text written so far, without trailing spaces on its lines and with at most one blank line
+// between paragraphs
+func (w *textWriter) String() string {
+	lines := strings.Split(strings.ReplaceAll(w.buf.String(), "\u00a0", " "), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Trim(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"), "\n")
+}
@@ -0,0 +1,343 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ICS date and date-time layouts
+const (
+	icsDate     = "20060102"
+	icsDateTime = "20060102T150405"
+)
+
+// WriteICS writes the appointment as an iCalendar (RFC 5545) object holding a VEVENT, one more VEVENT per modified instance
+// of a series and the VTIMEZONE components they refer to. Meeting requests, responses and cancellations get
+// METHOD:REQUEST, REPLY and CANCEL.
+func (a *Appointment) WriteICS(w io.Writer) error {
+	ics := &lineWriter{}
+	ics.line("BEGIN", "VCALENDAR")
+	ics.line("PRODID", "-//outlook-msg-parser//EN")
+	ics.line("VERSION", "2.0")
+	method := a.method()
+	if method != "" {
+		ics.line("METHOD", method)
+	}
+
+	startTZ, endTZ := a.StartTimeZone, a.EndTimeZone
+	if a.Recurrence != nil && a.RecurrenceTimeZone != nil {
+		startTZ, endTZ = a.RecurrenceTimeZone, a.RecurrenceTimeZone
+	}
+	if !a.AllDay {
+		written := map[string]bool{}
+		for _, tz := range []*TimeZoneDefinition{startTZ, endTZ} {
+			if tz != nil && !written[tz.TZID()] {
+				written[tz.TZID()] = true
+				tz.WriteVTimezone(&ics.buf)
+			}
+		}
+	}
+
+	uid := a.uid()
+	stamp := firstTime(a.Message.ClientSubmitTime, a.Message.LastModificationDate, a.Message.CreationDate, time.Now()).UTC()
+	ics.line("BEGIN", "VEVENT")
+	ics.line("UID", uid)
+	ics.line("DTSTAMP", stamp.Format(icsDateTime+"Z"))
+	ics.line("SEQUENCE", fmt.Sprint(a.Sequence))
+	ics.text("SUMMARY", a.Message.Subject)
+	ics.text("LOCATION", a.Location)
+	ics.text("DESCRIPTION", a.Message.BodyPlainText)
+	ics.time("DTSTART", a.Start, startTZ, a.AllDay)
+	ics.time("DTEND", a.End, endTZ, a.AllDay)
+	if a.Recurrence != nil {
+		var loc *time.Location
+		if startTZ != nil {
+			loc = startTZ.Location()
+		}
+		if rule, err := a.Recurrence.RRule(loc, a.AllDay); err == nil {
+			ics.line("RRULE", rule)
+		}
+		for _, d := range a.Recurrence.DeletedInstances() {
+			ics.wallTime("EXDATE", d, startTZ, a.AllDay)
+		}
+	}
+	ics.busy(a.BusyStatus)
+	if a.IsCanceled() || method == "CANCEL" {
+		ics.line("STATUS", "CANCELLED")
+	} else if a.IsMeeting() {
+		ics.line("STATUS", "CONFIRMED")
+	}
+	a.writeAttendees(ics, method)
+	if a.Reminder != nil {
+		ics.alarm(a.Reminder.MinutesBefore)
+	}
+	ics.line("END", "VEVENT")
+
+	if a.Recurrence != nil {
+		for _, ex := range a.Recurrence.Exceptions {
+			ics.line("BEGIN", "VEVENT")
+			ics.line("UID", uid)
+			ics.line("DTSTAMP", stamp.Format(icsDateTime+"Z"))
+			ics.line("SEQUENCE", fmt.Sprint(a.Sequence))
+			ics.wallTime("RECURRENCE-ID", ex.OriginalStart, startTZ, a.AllDay)
+			allDay := a.AllDay
+			if ex.AllDay != nil {
+				allDay = *ex.AllDay
+			}
+			ics.wallTime("DTSTART", ex.Start, startTZ, allDay)
+			ics.wallTime("DTEND", ex.End, endTZ, allDay)
+			ics.text("SUMMARY", stringOr(ex.Subject, a.Message.Subject))
+			ics.text("LOCATION", stringOr(ex.Location, a.Location))
+			status := a.BusyStatus
+			if ex.BusyStatus != nil {
+				status = *ex.BusyStatus
+			}
+			ics.busy(status)
+			a.writeAttendees(ics, method)
+			reminder := a.Reminder != nil
+			if ex.ReminderSet != nil {
+				reminder = *ex.ReminderSet
+			}
+			if reminder {
+				minutes := int32(15)
+				if a.Reminder != nil {
+					minutes = a.Reminder.MinutesBefore
+				}
+				if ex.ReminderDelta != nil {
+					minutes = *ex.ReminderDelta
+				}
+				ics.alarm(minutes)
+			}
+			ics.line("END", "VEVENT")
+		}
+	}
+	ics.line("END", "VCALENDAR")
+	_, err := w.Write(ics.buf.Bytes())
+	return err
+}
+
+// method returns the iTIP method of a meeting message class, or "" for calendar items
+func (a *Appointment) method() string {
+	switch class := a.Message.MessageClass; {
+	case hasClass(class, "IPM.Schedule.Meeting.Request"):
+		return "REQUEST"
+	case hasClass(class, "IPM.Schedule.Meeting.Resp"):
+		return "REPLY"
+	case hasClass(class, "IPM.Schedule.Meeting.Canceled"):
+		return "CANCEL"
+	}
+	return ""
+}
+
+// writeAttendees writes the organizer and the attendees. A reply only lists the responding sender, with the response its class tells.
+func (a *Appointment) writeAttendees(ics *lineWriter, method string) {
+	if a.Organizer.Email != "" {
+		ics.address("ORGANIZER", a.Organizer, nil)
+	}
+	if method == "REPLY" {
+		status := ResponseNone
+		switch class := a.Message.MessageClass; {
+		case hasClass(class, "IPM.Schedule.Meeting.Resp.Pos"):
+			status = ResponseAccepted
+		case hasClass(class, "IPM.Schedule.Meeting.Resp.Neg"):
+			status = ResponseDeclined
+		case hasClass(class, "IPM.Schedule.Meeting.Resp.Tent"):
+			status = ResponseTentative
+		}
+		sender := Attendee{Name: a.Message.FromName, Email: senderAddress(a.Message)}
+		ics.address("ATTENDEE", sender, []string{"PARTSTAT=" + partStat(status)})
+		return
+	}
+	for _, attendee := range a.Attendees {
+		if attendee.Email == "" {
+			continue
+		}
+		params := []string{"CUTYPE=INDIVIDUAL", "ROLE=REQ-PARTICIPANT"}
+		switch attendee.Type {
+		case RecipientCC:
+			params[1] = "ROLE=OPT-PARTICIPANT"
+		case RecipientBCC:
+			params = []string{"CUTYPE=RESOURCE", "ROLE=NON-PARTICIPANT"}
+		}
+		params = append(params, "PARTSTAT="+partStat(attendee.Status))
+		if method == "REQUEST" {
+			params = append(params, "RSVP=TRUE")
+		}
+		ics.address("ATTENDEE", attendee, params)
+	}
+}
+
+// uid returns the iCalendar UID of the item, derived from its global object id as Exchange does
+func (a *Appointment) uid() string {
+	clean, _ := a.Message.NamedValue(PSETIDMeeting, lidCleanGlobalObjectID)
+	goid := asBytes(clean)
+	if len(goid) == 0 {
+		full, _ := a.Message.NamedValue(PSETIDMeeting, lidGlobalObjectID)
+		goid = asBytes(full)
+	}
+	if id, err := ParseGlobalObjectID(goid); err == nil {
+		return id.UID()
+	}
+	return fallbackUID(a.Message, a.Start)
+}
+
+// fallbackUID returns a UID for items without a global id: the Internet message id if any, else a hash of subject and start
+func fallbackUID(msg *Message, start time.Time) string {
+	if msg.MessageID != "" {
+		return strings.Trim(msg.MessageID, "<>")
+	}
+	sum := sha1.Sum([]byte(msg.Subject + start.UTC().Format(time.RFC3339)))
+	return hex.EncodeToString(sum[:])
+}
+
+// partStat returns the PARTSTAT of a response status
+func partStat(status ResponseStatus) string {
+	switch status {
+	case ResponseAccepted, ResponseOrganized:
+		return "ACCEPTED"
+	case ResponseDeclined:
+		return "DECLINED"
+	case ResponseTentative:
+		return "TENTATIVE"
+	}
+	return "NEEDS-ACTION"
+}
+
+// stringOr returns *s, or def if s is nil
+func stringOr(s *string, def string) string {
+	if s == nil {
+		return def
+	}
+	return *s
+}
+
+// firstTime returns the first non-zero time
+func firstTime(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// lineWriter collects the folded and escaped content lines of iCalendar and vCard objects
+type lineWriter struct {
+	buf bytes.Buffer
+}
+
+// line writes a content line, folded at 75 octets
+func (ics *lineWriter) line(name, value string) {
+	s := name + ":" + value
+	for len(s) > 75 {
+		cut := 75
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		ics.buf.WriteString(s[:cut] + "\r\n")
+		s = " " + s[cut:]
+	}
+	ics.buf.WriteString(s + "\r\n")
+}
+
+// text writes a TEXT property, leaving out empty values
+func (ics *lineWriter) text(name, value string) {
+	if value == "" {
+		return
+	}
+	ics.line(name, escapeText(value))
+}
+
+// escapeText escapes a TEXT value
+func escapeText(value string) string {
+	return textEscaper.Replace(value)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// time writes an instant in the zone tz, as a date for all-day events or in UTC when there is no zone
+func (ics *lineWriter) time(name string, t time.Time, tz *TimeZoneDefinition, allDay bool) {
+	if t.IsZero() {
+		return
+	}
+	switch {
+	case tz != nil:
+		t = t.In(tz.Location())
+	case allDay:
+		// An all-day event starts at the organizer's midnight converted to UTC, which is rounded to the nearest day
+		t = t.UTC().Add(12 * time.Hour)
+	default:
+		ics.line(name, t.UTC().Format(icsDateTime+"Z"))
+		return
+	}
+	ics.wallTime(name, time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), tz, allDay)
+}
+
+// wallTime writes a wall clock time of the zone tz, as a date for all-day events or as floating time when there is no zone
+func (ics *lineWriter) wallTime(name string, t time.Time, tz *TimeZoneDefinition, allDay bool) {
+	switch {
+	case allDay:
+		ics.line(name+";VALUE=DATE", t.Format(icsDate))
+	case tz != nil:
+		ics.line(name+";TZID="+paramValue(tz.TZID()), t.Format(icsDateTime))
+	default:
+		ics.line(name, t.Format(icsDateTime))
+	}
+}
+
+// address writes an ORGANIZER or ATTENDEE property
+func (ics *lineWriter) address(name string, attendee Attendee, params []string) {
+	if attendee.Name != "" {
+		params = append([]string{"CN=" + paramValue(attendee.Name)}, params...)
+	}
+	for _, p := range params {
+		name += ";" + p
+	}
+	ics.line(name, "mailto:"+attendee.Email)
+}
+
+// busy writes TRANSP and the busy status Outlook reads back
+func (ics *lineWriter) busy(status BusyStatus) {
+	transp := "OPAQUE"
+	if status == BusyStatusFree {
+		transp = "TRANSPARENT"
+	}
+	ics.line("TRANSP", transp)
+	if code, ok := map[BusyStatus]string{
+		BusyStatusFree:             "FREE",
+		BusyStatusTentative:        "TENTATIVE",
+		BusyStatusBusy:             "BUSY",
+		BusyStatusOutOfOffice:      "OOF",
+		BusyStatusWorkingElsewhere: "WORKINGELSEWHERE",
+	}[status]; ok {
+		ics.line("X-MICROSOFT-CDO-BUSYSTATUS", code)
+	}
+}
+
+// alarm writes a display VALARM the given number of minutes before the start, or after it when minutes is negative
+func (ics *lineWriter) alarm(minutes int32) {
+	trigger := fmt.Sprintf("-PT%dM", minutes)
+	if minutes < 0 {
+		trigger = fmt.Sprintf("PT%dM", -minutes)
+	}
+	ics.line("BEGIN", "VALARM")
+	ics.line("ACTION", "DISPLAY")
+	ics.line("DESCRIPTION", "Reminder")
+	ics.line("TRIGGER", trigger)
+	ics.line("END", "VALARM")
+}
+
+// paramValue quotes a parameter value when it holds characters that separate parameters
+func paramValue(value string) string {
+	value = strings.ReplaceAll(value, `"`, "'")
+	if strings.ContainsAny(value, ":;,") {
+		return `"` + value + `"`
+	}
+	return value
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/base64"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Attachment flags (PR_ATTACH_FLAGS)
+const (
+	AttachInvisibleInHTML = 0x1 // ATT_INVISIBLE_IN_HTML
+	AttachInvisibleInRTF  = 0x2 // ATT_INVISIBLE_IN_RTF
+	AttachMHTMLRef        = 0x4 // ATT_MHTML_REF, the attachment is referenced from the HTML body
+)
+
+// InlineURLFunc returns the URL an inline attachment is rendered with, or "" to leave its references unchanged
+type InlineURLFunc func(att *Attachment) string
+
+// cidReference matches a cid: URL (RFC 2392) in an attribute value or a CSS url()
+var cidReference = regexp.MustCompile(`(?i)cid:([^"'\s()<>]+)`)
+
+// IsInline reports whether the attachment is shown in the body rather than listed with the attachments:
+// it is hidden (PR_ATTACHMENT_HIDDEN) or referenced from the HTML body (ATT_MHTML_REF in PR_ATTACH_FLAGS)
+func (a *Attachment) IsInline() bool {
+	return asBool(a.Properties[0x7FFE]) || asInt32(a.Properties[0x3714])&AttachMHTMLRef != 0
+}
+
+// DataURL returns a data: URL holding the attachment, typed by its MIME tag, its file name or its content
+func DataURL(att *Attachment) string {
+	typ := att.MimeType
+	if typ == "" {
+		typ = mime.TypeByExtension(strings.ToLower(filepath.Ext(att.FileName)))
+	}
+	if typ == "" {
+		typ = http.DetectContentType(att.Data)
+	}
+	return "data:" + strings.ReplaceAll(typ, " ", "") + ";base64," + base64.StdEncoding.EncodeToString(att.Data)
+}
+
+// ResolveInlineImages returns BodyHTML with its cid: references replaced by the URL resolve returns for the attachment
+// they designate, or by a data: URL when resolve is nil. The referenced attachments are marked as inline: their
+// PR_ATTACHMENT_HIDDEN is set and ATT_MHTML_REF is added to their PR_ATTACH_FLAGS. References to unknown content ids
+// are left unchanged.
+func (res *Message) ResolveInlineImages(resolve InlineURLFunc) string {
+	if resolve == nil {
+		resolve = DataURL
+	}
+	urls := make(map[*Attachment]string)
+	return cidReference.ReplaceAllStringFunc(res.BodyHTML, func(ref string) string {
+		att := res.attachmentByContentID(ref[len("cid:"):])
+		if att == nil {
+			return ref
+		}
+		u, ok := urls[att]
+		if !ok {
+			u = resolve(att)
+			urls[att] = u
+			if att.Properties == nil {
+				att.Properties = make(map[int64]interface{})
+			}
+			att.Properties[0x7FFE] = true                                             // PR_ATTACHMENT_HIDDEN
+			att.Properties[0x3714] = asInt32(att.Properties[0x3714]) | AttachMHTMLRef // PR_ATTACH_FLAGS
+		}
+		if u == "" {
+			return ref
+		}
+		return html.EscapeString(u)
+	})
+}
+
+// attachmentByContentID returns the attachment a cid: URL designates by its PR_ATTACH_CONTENT_ID, or failing that
+// by its PR_ATTACH_CONTENT_LOCATION or file name, which some clients reference instead
+func (res *Message) attachmentByContentID(cid string) *Attachment {
+	if unescaped, err := url.PathUnescape(cid); err == nil {
+		cid = unescaped
+	}
+	for i := range res.Attachments {
+		if strings.EqualFold(strings.Trim(res.Attachments[i].ContentID, "<>"), cid) {
+			return &res.Attachments[i]
+		}
+	}
+	for i := range res.Attachments {
+		att := &res.Attachments[i]
+		if location := asString(att.Properties[0x3713]); location != "" && strings.EqualFold(location, cid) { // PR_ATTACH_CONTENT_LOCATION
+			return att
+		}
+		if att.FileName != "" && strings.EqualFold(att.FileName, cid) {
+			return att
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+)
+
+// rpmsgMagic starts a compressed rights-protected message container (MS-OXORMMS 2.2.1)
+var rpmsgMagic = []byte{0x76, 0xE8, 0x04, 0x60, 0xC4, 0x11, 0xE3, 0x86}
+
+// rpmsgChunkMarker starts each zlib compressed chunk of the container
+const rpmsgChunkMarker = 0x0FA0
+
+// rpmsgMaxSize bounds the decompressed size of a container
+const rpmsgMaxSize = 256 << 20
+
+// ErrNotRPMSG is returned by ParseRPMSG for data that is not a compressed rights-protected message container
+var ErrNotRPMSG = errors.New("rpmsg: not a rights-protected message container")
+
+// RightsProtection is a view of a message protected with Information Rights Management (IPM.Note.rpmsg).
+// Its body and attachments are encrypted in the message.rpmsg attachment; only the publishing license is readable offline.
+type RightsProtection struct {
+	Message *Message // The underlying message
+
+	Attachment *Attachment        // The message.rpmsg attachment, nil if the message has none
+	Container  *RPMSG             // The decompressed container, nil if the attachment is missing or invalid
+	License    *PublishingLicense // The publishing license of the container, nil if it has none
+	Err        error              // Why Container or License is nil
+}
+
+// RPMSG is a decompressed rights-protected message container
+type RPMSG struct {
+	Storage []byte             // The compound file holding the data spaces, the license and the encrypted content
+	Content []byte             // The encrypted message (\tDRMContent), which needs the use license of the server to decrypt
+	License *PublishingLicense // Nil if the container has no readable publishing license
+}
+
+// PublishingLicense holds the metadata of the XrML publishing license of a protected message
+type PublishingLicense struct {
+	TemplateID          string    // GUID of the rights policy template, such as "Do Not Forward"
+	TemplateName        string    // Name of the template in the first language of the license
+	TemplateDescription string    // Description of the template in the first language of the license
+	Owner               string    // Email address or name of the owner, who protected the message
+	IssuerName          string    // Name of the rights management server, or of the user for offline publishing
+	IssuerURL           string    // Licensing URL of the rights management server
+	ContentID           string    // GUID of the protected content
+	IssuedTime          time.Time // When the license was issued
+	XrML                string    // The license document
+}
+
+// RightsProtection returns the IRM view of the message, or false when its class is not IPM.Note.rpmsg
+func (res *Message) RightsProtection() (*RightsProtection, bool) {
+	if !hasClass(res.MessageClass, "IPM.Note.rpmsg") {
+		return nil, false
+	}
+	rp := &RightsProtection{Message: res}
+	for i := range res.Attachments {
+		att := &res.Attachments[i]
+		if strings.EqualFold(att.FileName, "message.rpmsg") || strings.EqualFold(att.MimeType, "application/x-microsoft-rpmsg-message") {
+			rp.Attachment = att
+			break
+		}
+	}
+	if rp.Attachment == nil {
+		rp.Err = errors.New("rpmsg: message has no message.rpmsg attachment")
+		return rp, true
+	}
+	rp.Container, rp.Err = ParseRPMSG(rp.Attachment.Data)
+	if rp.Container != nil {
+		rp.License = rp.Container.License
+		if rp.License == nil {
+			rp.Err = errors.New("rpmsg: container has no publishing license")
+		}
+	}
+	return rp, true
+}
+
+// ParseRPMSG decompresses a message.rpmsg container and decodes its publishing license
+func ParseRPMSG(data []byte) (*RPMSG, error) {
+	if !bytes.HasPrefix(data, rpmsgMagic) {
+		return nil, ErrNotRPMSG
+	}
+	var storage bytes.Buffer
+	for rest := data[len(rpmsgMagic):]; len(rest) > 0; {
+		if len(rest) < 12 || binary.LittleEndian.Uint32(rest) != rpmsgChunkMarker {
+			return nil, ErrNotRPMSG
+		}
+		uncompressed := int64(binary.LittleEndian.Uint32(rest[4:]))
+		compressed := int(binary.LittleEndian.Uint32(rest[8:]))
+		rest = rest[12:]
+		if compressed > len(rest) {
+			return nil, ErrNotRPMSG
+		}
+		if int64(storage.Len())+uncompressed > rpmsgMaxSize {
+			return nil, errors.New("rpmsg: container is too large")
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(rest[:compressed]))
+		if err != nil {
+			return nil, err
+		}
+		// Read one byte more than declared to detect chunks that expand beyond their size
+		n, err := io.Copy(&storage, io.LimitReader(zr, uncompressed+1))
+		if err != nil {
+			return nil, err
+		}
+		if n != uncompressed {
+			return nil, errors.New("rpmsg: chunk does not match its uncompressed size")
+		}
+		rest = rest[compressed:]
+	}
+
+	res := &RPMSG{Storage: storage.Bytes()}
+	doc, err := mscfb.New(bytes.NewReader(res.Storage))
+	if err != nil {
+		return nil, err
+	}
+	var license string
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if entry.Size == 0 {
+			continue
+		}
+		content, err := ioutil.ReadAll(entry)
+		if err != nil {
+			return nil, err
+		}
+		// mscfb drops the control character that starts the names of special streams
+		switch entry.Name {
+		case "DRMContent":
+			res.Content = content
+		case "Primary":
+			// The IRMDSTransformInfo of the DRM transform, which ends with the publishing license
+			if xrml := findXrML(content); xrml != "" {
+				license = xrml
+			}
+		default:
+			if xrml := findXrML(content); xrml != "" && license == "" {
+				license = xrml
+			}
+		}
+	}
+	if license != "" {
+		res.License, _ = ParsePublishingLicense(license)
+	}
+	return res, nil
+}
+
+// findXrML returns the first XrML document in a stream, which may be UTF-8 or UTF-16LE encoded
+func findXrML(data []byte) string {
+	if start := bytes.Index(data, []byte("<XrML")); start >= 0 {
+		if end := bytes.Index(data[start:], []byte("</XrML>")); end >= 0 {
+			return string(data[start : start+end+len("</XrML>")])
+		}
+	}
+	wide := func(s string) []byte {
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = binary.LittleEndian.AppendUint16(b, u)
+		}
+		return b
+	}
+	start := bytes.Index(data, wide("<XrML"))
+	if start < 0 {
+		return ""
+	}
+	end := bytes.Index(data[start:], wide("</XrML>"))
+	if end < 0 || (end+len(wide("</XrML>")))%2 != 0 {
+		return ""
+	}
+	units := make([]uint16, (end+len(wide("</XrML>")))/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[start+2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+type xrmlLicense struct {
+	IssuedTime string       `xml:"BODY>ISSUEDTIME"`
+	Descriptor xrmlObject   `xml:"BODY>DESCRIPTOR>OBJECT"`
+	Issuer     xrmlObject   `xml:"BODY>ISSUER>OBJECT"`
+	Content    xrmlObject   `xml:"BODY>WORK>OBJECT"`
+	Owner      []xrmlObject `xml:"BODY>WORK>METADATA>OWNER>OBJECT"`
+}
+
+type xrmlObject struct {
+	IDs       []xrmlValue `xml:"ID"`
+	Name      string      `xml:"NAME"`
+	Addresses []xrmlValue `xml:"ADDRESS"`
+}
+
+type xrmlValue struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// firstValue returns the first value of the given type, or the first value if none has it
+func firstValue(values []xrmlValue, typ string) string {
+	for _, v := range values {
+		if strings.EqualFold(v.Type, typ) {
+			return strings.TrimSpace(v.Value)
+		}
+	}
+	if len(values) > 0 {
+		return strings.TrimSpace(values[0].Value)
+	}
+	return ""
+}
+
+// ParsePublishingLicense decodes the metadata of an XrML publishing license
+func ParsePublishingLicense(xrml string) (*PublishingLicense, error) {
+	var doc xrmlLicense
+	if err := xml.Unmarshal([]byte(xrml), &doc); err != nil {
+		return nil, err
+	}
+	pl := &PublishingLicense{
+		TemplateID: firstValue(doc.Descriptor.IDs, "MS-GUID"),
+		IssuerName: strings.TrimSpace(doc.Issuer.Name),
+		IssuerURL:  firstValue(doc.Issuer.Addresses, "URL"),
+		ContentID:  firstValue(doc.Content.IDs, "MS-GUID"),
+		XrML:       xrml,
+	}
+	pl.TemplateName, pl.TemplateDescription = templateText(doc.Descriptor.Name)
+	for _, owner := range doc.Owner {
+		if pl.Owner = firstValue(owner.IDs, "email"); !strings.Contains(pl.Owner, "@") {
+			pl.Owner = strings.TrimSpace(owner.Name)
+		}
+		if pl.Owner != "" {
+			break
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04", time.RFC3339, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(doc.IssuedTime)); err == nil {
+			pl.IssuedTime = t
+			break
+		}
+	}
+	return pl, nil
+}
+
+// templateText splits the descriptor name of a template, "LCID 1033:NAME Confidential:DESCRIPTION Text;" repeated
+// for each language, into the name and description of the first language
+func templateText(descriptor string) (name, description string) {
+	first := strings.SplitN(strings.TrimSpace(descriptor), ";", 2)[0]
+	if !strings.HasPrefix(first, "LCID ") {
+		return first, ""
+	}
+	if i := strings.Index(first, ":NAME "); i >= 0 {
+		name = first[i+len(":NAME "):]
+		if j := strings.Index(name, ":DESCRIPTION "); j >= 0 {
+			name, description = name[:j], name[j+len(":DESCRIPTION "):]
+		}
+	}
+	return name, description
+}
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Named properties of PSETID_Log (MS-OXOJRNL)
+const (
+	lidLogType            = 0x8700 // PidLidLogType
+	lidLogStart           = 0x8706 // PidLidLogStart
+	lidLogDuration        = 0x8707 // PidLidLogDuration
+	lidLogEnd             = 0x8708 // PidLidLogEnd
+	lidLogFlags           = 0x870C // PidLidLogFlags
+	lidLogDocumentPrinted = 0x870E // PidLidLogDocumentPrinted
+	lidLogDocumentSaved   = 0x870F // PidLidLogDocumentSaved
+	lidLogDocumentRouted  = 0x8710 // PidLidLogDocumentRouted
+	lidLogDocumentPosted  = 0x8711 // PidLidLogDocumentPosted
+	lidLogTypeDesc        = 0x8712 // PidLidLogTypeDesc
+)
+
+// Named properties of PSETID_Common used by journal entries
+const (
+	lidCompanies = 0x8539 // PidLidCompanies
+	lidContacts  = 0x853A // PidLidContacts
+)
+
+// JournalEntry is a view of a journal entry (IPM.Activity) built from its PSETID_Log named properties
+type JournalEntry struct {
+	Message *Message // The underlying message
+
+	Type            string        // PidLidLogType, such as "Phone call", "Meeting" or "Document"
+	TypeDescription string        // PidLidLogTypeDesc, the localized type shown by Outlook
+	Start           time.Time     // PidLidLogStart
+	End             time.Time     // PidLidLogEnd
+	Duration        time.Duration // PidLidLogDuration
+	Flags           int32         // PidLidLogFlags
+	Companies       []string      // PidLidCompanies
+	Contacts        []string      // PidLidContacts, the names of the linked contacts
+	DocumentPrinted bool          // PidLidLogDocumentPrinted
+	DocumentSaved   bool          // PidLidLogDocumentSaved
+	DocumentRouted  bool          // PidLidLogDocumentRouted
+	DocumentPosted  bool          // PidLidLogDocumentPosted
+}
+
+// JournalEntry returns the journal view of the message, or false when its class is not IPM.Activity
+func (res *Message) JournalEntry() (*JournalEntry, bool) {
+	if !hasClass(res.MessageClass, "IPM.Activity") {
+		return nil, false
+	}
+	log := func(lid uint32) interface{} {
+		v, _ := res.NamedValue(PSETIDLog, lid)
+		return v
+	}
+	j := &JournalEntry{
+		Message:         res,
+		Type:            asString(log(lidLogType)),
+		TypeDescription: asString(log(lidLogTypeDesc)),
+		Start:           asTime(log(lidLogStart)),
+		End:             asTime(log(lidLogEnd)),
+		Duration:        time.Duration(asInt32(log(lidLogDuration))) * time.Minute,
+		Flags:           asInt32(log(lidLogFlags)),
+		DocumentPrinted: asBool(log(lidLogDocumentPrinted)),
+		DocumentSaved:   asBool(log(lidLogDocumentSaved)),
+		DocumentRouted:  asBool(log(lidLogDocumentRouted)),
+		DocumentPosted:  asBool(log(lidLogDocumentPosted)),
+	}
+	if j.Duration == 0 && !j.Start.IsZero() && j.End.After(j.Start) {
+		j.Duration = j.End.Sub(j.Start)
+	}
+	companies, _ := res.NamedValue(PSETIDCommon, lidCompanies)
+	j.Companies, _ = companies.([]string)
+	contacts, _ := res.NamedValue(PSETIDCommon, lidContacts)
+	j.Contacts, _ = contacts.([]string)
+	return j, true
+}
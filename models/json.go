@@ -0,0 +1,591 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONOptions controls how a Message is encoded by MarshalJSONWithOptions
+type JSONOptions struct {
+	OmitAttachmentData bool // Leave out the content of attachments, only their size is written
+}
+
+// jsonMessage is the JSON form of a Message
+type jsonMessage struct {
+	MessageClass            string                 `json:"messageClass,omitempty"`
+	MessageID               string                 `json:"messageId,omitempty"`
+	Subject                 string                 `json:"subject,omitempty"`
+	FromEmail               string                 `json:"fromEmail,omitempty"`
+	FromName                string                 `json:"fromName,omitempty"`
+	ToDisplay               string                 `json:"toDisplay,omitempty"`
+	To                      string                 `json:"to,omitempty"`
+	CCDisplay               string                 `json:"ccDisplay,omitempty"`
+	BCCDisplay              string                 `json:"bccDisplay,omitempty"`
+	CC                      string                 `json:"cc,omitempty"`
+	BCC                     string                 `json:"bcc,omitempty"`
+	BodyPlainText           string                 `json:"bodyPlainText,omitempty"`
+	BodyHTML                string                 `json:"bodyHtml,omitempty"`
+	ConvertedBodyHTML       string                 `json:"convertedBodyHtml,omitempty"`
+	BodySource              BodySource             `json:"bodySource,omitempty"`
+	Headers                 string                 `json:"headers,omitempty"`
+	Date                    *time.Time             `json:"date,omitempty"`
+	ClientSubmitTime        *time.Time             `json:"clientSubmitTime,omitempty"`
+	CreationDate            *time.Time             `json:"creationDate,omitempty"`
+	LastModificationDate    *time.Time             `json:"lastModificationDate,omitempty"`
+	TransportMessageHeaders string                 `json:"transportMessageHeaders,omitempty"`
+	Address                 []string               `json:"address,omitempty"`
+	LastRecipient           int                    `json:"lastRecipient,omitempty"`
+	Recipients              []jsonRecipient        `json:"recipients,omitempty"`
+	Attachments             []jsonAttachment       `json:"attachments,omitempty"`
+	NamedProperties         []jsonNamedProperty    `json:"namedProperties,omitempty"`
+	Properties              []jsonProperty         `json:"properties"`
+	Extensions              map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// jsonRecipient is the JSON form of a Recipient
+type jsonRecipient struct {
+	Type         RecipientType  `json:"type"`
+	DisplayName  string         `json:"displayName,omitempty"`
+	EmailAddress string         `json:"emailAddress,omitempty"`
+	AddressType  string         `json:"addressType,omitempty"`
+	SMTPAddress  string         `json:"smtpAddress,omitempty"`
+	Properties   []jsonProperty `json:"properties"`
+}
+
+// jsonAttachment is the JSON form of an Attachment
+type jsonAttachment struct {
+	Name       string         `json:"name,omitempty"`
+	FileName   string         `json:"fileName,omitempty"`
+	MimeType   string         `json:"mimeType,omitempty"`
+	ContentID  string         `json:"contentId,omitempty"`
+	Method     int32          `json:"method"`
+	Size       int            `json:"size"`
+	Data       []byte         `json:"data,omitempty"`
+	Embedded   *jsonMessage   `json:"embedded,omitempty"`
+	Properties []jsonProperty `json:"properties"`
+}
+
+// jsonNamedProperty is an entry of the named property map of a message
+type jsonNamedProperty struct {
+	ID          string `json:"id"`
+	PropertySet string `json:"propertySet"`
+	LID         string `json:"lid,omitempty"`
+	StringName  string `json:"stringName,omitempty"`
+}
+
+// jsonProperty is a single entry of a property bag.
+// Named properties repeat their property set and name so the entry can be read on its own.
+type jsonProperty struct {
+	Tag         string          `json:"tag"`
+	Name        string          `json:"name,omitempty"`
+	Type        string          `json:"type"`
+	PropertySet string          `json:"propertySet,omitempty"`
+	LID         string          `json:"lid,omitempty"`
+	StringName  string          `json:"stringName,omitempty"`
+	Value       json.RawMessage `json:"value"`
+}
+
+// MarshalJSON encodes the message including attachment content, see MarshalJSONWithOptions
+func (res *Message) MarshalJSON() ([]byte, error) {
+	return res.MarshalJSONWithOptions(JSONOptions{})
+}
+
+// MarshalJSONWithOptions encodes the message, its recipients, attachments and property bags.
+// Properties are written as a list sorted by id, each with its hex tag (0xIIIITTTT), canonical name, PT_* type and value.
+// Times are written in RFC 3339 in UTC and binary values as base64.
+// Extensions are written with encoding/json as they are, and read back as the generic JSON types.
+func (res *Message) MarshalJSONWithOptions(opts JSONOptions) ([]byte, error) {
+	jm, err := res.toJSON(opts)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jm)
+}
+
+// UnmarshalJSON decodes a message written by MarshalJSON
+func (res *Message) UnmarshalJSON(data []byte) error {
+	var jm jsonMessage
+	if err := json.Unmarshal(data, &jm); err != nil {
+		return err
+	}
+	msg, err := jm.message()
+	if err != nil {
+		return err
+	}
+	*res = *msg
+	return nil
+}
+
+// MarshalJSON encodes the recipient. Named properties are only resolved when the recipient is encoded as part of its message.
+func (r Recipient) MarshalJSON() ([]byte, error) {
+	jr, err := r.toJSON(nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jr)
+}
+
+// UnmarshalJSON decodes a recipient written by MarshalJSON
+func (r *Recipient) UnmarshalJSON(data []byte) error {
+	var jr jsonRecipient
+	if err := json.Unmarshal(data, &jr); err != nil {
+		return err
+	}
+	recip, err := jr.recipient()
+	if err != nil {
+		return err
+	}
+	*r = recip
+	return nil
+}
+
+// MarshalJSON encodes the attachment including its content. Named properties are only resolved when the attachment is encoded as part of its message.
+func (a Attachment) MarshalJSON() ([]byte, error) {
+	ja, err := a.toJSON(nil, JSONOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ja)
+}
+
+// UnmarshalJSON decodes an attachment written by MarshalJSON
+func (a *Attachment) UnmarshalJSON(data []byte) error {
+	var ja jsonAttachment
+	if err := json.Unmarshal(data, &ja); err != nil {
+		return err
+	}
+	att, err := ja.attachment()
+	if err != nil {
+		return err
+	}
+	*a = att
+	return nil
+}
+
+// MarshalPropertiesJSON encodes a property bag, using named to resolve the names of named properties.
+// The property types are those of the Go values, see PropertyTypeOf.
+func MarshalPropertiesJSON(properties map[int64]interface{}, named map[int64]NamedProperty) ([]byte, error) {
+	props, err := propertiesToJSON(properties, nil, named)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(props)
+}
+
+// UnmarshalPropertiesJSON decodes a property bag written by MarshalPropertiesJSON, returning the named properties it references
+func UnmarshalPropertiesJSON(data []byte) (map[int64]interface{}, map[int64]NamedProperty, error) {
+	var props []jsonProperty
+	if err := json.Unmarshal(data, &props); err != nil {
+		return nil, nil, err
+	}
+	named := make(map[int64]NamedProperty)
+	properties, _, err := propertiesFromJSON(props, named)
+	if err != nil {
+		return nil, nil, err
+	}
+	return properties, named, nil
+}
+
+func (res *Message) toJSON(opts JSONOptions) (*jsonMessage, error) {
+	jm := &jsonMessage{
+		MessageClass:            res.MessageClass,
+		MessageID:               res.MessageID,
+		Subject:                 res.Subject,
+		FromEmail:               res.FromEmail,
+		FromName:                res.FromName,
+		ToDisplay:               res.ToDisplay,
+		To:                      res.To,
+		CCDisplay:               res.CCDisplay,
+		BCCDisplay:              res.BCCDisplay,
+		CC:                      res.CC,
+		BCC:                     res.BCC,
+		BodyPlainText:           res.BodyPlainText,
+		BodyHTML:                res.BodyHTML,
+		ConvertedBodyHTML:       res.ConvertedBodyHTML,
+		BodySource:              res.BodySource,
+		Headers:                 res.Headers,
+		Date:                    jsonTime(res.Date),
+		ClientSubmitTime:        jsonTime(res.ClientSubmitTime),
+		CreationDate:            jsonTime(res.CreationDate),
+		LastModificationDate:    jsonTime(res.LastModificationDate),
+		TransportMessageHeaders: res.TransportMessageHeaders,
+		Address:                 res.Address,
+		LastRecipient:           res.LastRecipient,
+		Extensions:              res.Extensions,
+	}
+	for _, r := range res.Recipients {
+		jr, err := r.toJSON(res.NamedProperties)
+		if err != nil {
+			return nil, err
+		}
+		jm.Recipients = append(jm.Recipients, *jr)
+	}
+	for _, a := range res.Attachments {
+		ja, err := a.toJSON(res.NamedProperties, opts)
+		if err != nil {
+			return nil, err
+		}
+		jm.Attachments = append(jm.Attachments, *ja)
+	}
+	for _, id := range sortedIDs(res.NamedProperties) {
+		np := res.NamedProperties[id]
+		jn := jsonNamedProperty{ID: fmt.Sprintf("0x%04X", id), PropertySet: np.GUID, StringName: np.Name}
+		if np.Name == "" {
+			jn.LID = fmt.Sprintf("0x%04X", np.ID)
+		}
+		jm.NamedProperties = append(jm.NamedProperties, jn)
+	}
+	props, err := propertiesToJSON(res.Properties, res.PropertyTypes, res.NamedProperties)
+	if err != nil {
+		return nil, err
+	}
+	jm.Properties = props
+	return jm, nil
+}
+
+func (jm *jsonMessage) message() (*Message, error) {
+	res := &Message{
+		MessageClass:            jm.MessageClass,
+		MessageID:               jm.MessageID,
+		Subject:                 jm.Subject,
+		FromEmail:               jm.FromEmail,
+		FromName:                jm.FromName,
+		ToDisplay:               jm.ToDisplay,
+		To:                      jm.To,
+		CCDisplay:               jm.CCDisplay,
+		BCCDisplay:              jm.BCCDisplay,
+		CC:                      jm.CC,
+		BCC:                     jm.BCC,
+		BodyPlainText:           jm.BodyPlainText,
+		BodyHTML:                jm.BodyHTML,
+		ConvertedBodyHTML:       jm.ConvertedBodyHTML,
+		BodySource:              jm.BodySource,
+		Headers:                 jm.Headers,
+		Date:                    fromJSONTime(jm.Date),
+		ClientSubmitTime:        fromJSONTime(jm.ClientSubmitTime),
+		CreationDate:            fromJSONTime(jm.CreationDate),
+		LastModificationDate:    fromJSONTime(jm.LastModificationDate),
+		TransportMessageHeaders: jm.TransportMessageHeaders,
+		Address:                 jm.Address,
+		LastRecipient:           jm.LastRecipient,
+		Extensions:              jm.Extensions,
+	}
+	named := make(map[int64]NamedProperty)
+	for _, jn := range jm.NamedProperties {
+		id, err := strconv.ParseInt(strings.TrimPrefix(jn.ID, "0x"), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid named property id %q", jn.ID)
+		}
+		np, err := jn.named()
+		if err != nil {
+			return nil, err
+		}
+		named[id] = np
+	}
+	for _, jr := range jm.Recipients {
+		r, err := jr.recipientNamed(named)
+		if err != nil {
+			return nil, err
+		}
+		res.Recipients = append(res.Recipients, r)
+	}
+	for _, ja := range jm.Attachments {
+		a, err := ja.attachmentNamed(named)
+		if err != nil {
+			return nil, err
+		}
+		res.Attachments = append(res.Attachments, a)
+	}
+	props, types, err := propertiesFromJSON(jm.Properties, named)
+	if err != nil {
+		return nil, err
+	}
+	res.Properties, res.PropertyTypes = props, types
+	if len(named) > 0 {
+		res.NamedProperties = named
+	}
+	return res, nil
+}
+
+func (r Recipient) toJSON(named map[int64]NamedProperty) (*jsonRecipient, error) {
+	props, err := propertiesToJSON(r.Properties, r.PropertyTypes, named)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonRecipient{
+		Type:         r.Type,
+		DisplayName:  r.DisplayName,
+		EmailAddress: r.EmailAddress,
+		AddressType:  r.AddressType,
+		SMTPAddress:  r.SMTPAddress,
+		Properties:   props,
+	}, nil
+}
+
+func (jr *jsonRecipient) recipient() (Recipient, error) {
+	return jr.recipientNamed(make(map[int64]NamedProperty))
+}
+
+func (jr *jsonRecipient) recipientNamed(named map[int64]NamedProperty) (Recipient, error) {
+	props, types, err := propertiesFromJSON(jr.Properties, named)
+	if err != nil {
+		return Recipient{}, err
+	}
+	return Recipient{
+		Type:          jr.Type,
+		DisplayName:   jr.DisplayName,
+		EmailAddress:  jr.EmailAddress,
+		AddressType:   jr.AddressType,
+		SMTPAddress:   jr.SMTPAddress,
+		Properties:    props,
+		PropertyTypes: types,
+	}, nil
+}
+
+func (a Attachment) toJSON(named map[int64]NamedProperty, opts JSONOptions) (*jsonAttachment, error) {
+	props, err := propertiesToJSON(a.Properties, a.PropertyTypes, named)
+	if err != nil {
+		return nil, err
+	}
+	ja := &jsonAttachment{
+		Name:       a.Name,
+		FileName:   a.FileName,
+		MimeType:   a.MimeType,
+		ContentID:  a.ContentID,
+		Method:     a.Method,
+		Size:       len(a.Data),
+		Properties: props,
+	}
+	if !opts.OmitAttachmentData {
+		ja.Data = a.Data
+	}
+	if a.Embedded != nil {
+		ja.Embedded, err = a.Embedded.toJSON(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ja, nil
+}
+
+func (ja *jsonAttachment) attachment() (Attachment, error) {
+	return ja.attachmentNamed(make(map[int64]NamedProperty))
+}
+
+func (ja *jsonAttachment) attachmentNamed(named map[int64]NamedProperty) (Attachment, error) {
+	props, types, err := propertiesFromJSON(ja.Properties, named)
+	if err != nil {
+		return Attachment{}, err
+	}
+	a := Attachment{
+		Name:          ja.Name,
+		FileName:      ja.FileName,
+		MimeType:      ja.MimeType,
+		ContentID:     ja.ContentID,
+		Method:        ja.Method,
+		Data:          ja.Data,
+		Properties:    props,
+		PropertyTypes: types,
+	}
+	if ja.Embedded != nil {
+		a.Embedded, err = ja.Embedded.message()
+		if err != nil {
+			return Attachment{}, err
+		}
+	}
+	return a, nil
+}
+
+func (jn *jsonNamedProperty) named() (NamedProperty, error) {
+	np := NamedProperty{GUID: jn.PropertySet, Name: jn.StringName}
+	if jn.StringName == "" {
+		lid, err := strconv.ParseUint(strings.TrimPrefix(jn.LID, "0x"), 16, 32)
+		if err != nil {
+			return np, fmt.Errorf("invalid named property id %q", jn.LID)
+		}
+		np.ID = uint32(lid)
+	}
+	return np, nil
+}
+
+// propertiesToJSON converts a property bag to its JSON list, with the types recorded in types or else those of
+// the Go values
+func propertiesToJSON(properties map[int64]interface{}, types map[int64]uint16, named map[int64]NamedProperty) ([]jsonProperty, error) {
+	res := []jsonProperty{}
+	for _, id := range sortedIDs(properties) {
+		v := properties[id]
+		typ, ok := propertyType(types, id, v)
+		if !ok {
+			return nil, fmt.Errorf("property %04x: unsupported value type %T", id, v)
+		}
+		switch t := v.(type) {
+		case time.Time:
+			v = t.UTC()
+		case []time.Time:
+			utc := make([]time.Time, len(t))
+			for i := range t {
+				utc[i] = t[i].UTC()
+			}
+			v = utc
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %v", FormatPropertyTag(uint16(id), typ), err)
+		}
+		jp := jsonProperty{
+			Tag:   FormatPropertyTag(uint16(id), typ),
+			Name:  PropertyName(uint16(id)),
+			Type:  PropertyTypeName(typ),
+			Value: value,
+		}
+		if np, ok := named[id]; ok && id >= 0x8000 {
+			jp.PropertySet = np.GUID
+			jp.StringName = np.Name
+			if np.Name == "" {
+				jp.LID = fmt.Sprintf("0x%04X", np.ID)
+			}
+		}
+		res = append(res, jp)
+	}
+	return res, nil
+}
+
+// propertiesFromJSON converts a JSON property list back to a property bag and the types its Go values do not
+// tell, adding the names of named properties to named
+func propertiesFromJSON(props []jsonProperty, named map[int64]NamedProperty) (map[int64]interface{}, map[int64]uint16, error) {
+	res := make(map[int64]interface{}, len(props))
+	var types map[int64]uint16
+	for _, jp := range props {
+		id, typ, err := ParsePropertyTag(jp.Tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := decodeJSONValue(typ, jp.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("property %s: %v", jp.Tag, err)
+		}
+		res[int64(id)] = value
+		recordPropertyType(&types, int64(id), int64(typ), value)
+		if id >= 0x8000 && jp.PropertySet != "" {
+			if _, ok := named[int64(id)]; !ok {
+				jn := jsonNamedProperty{PropertySet: jp.PropertySet, LID: jp.LID, StringName: jp.StringName}
+				np, err := jn.named()
+				if err != nil {
+					return nil, nil, err
+				}
+				named[int64(id)] = np
+			}
+		}
+	}
+	return res, types, nil
+}
+
+// decodeJSONValue decodes a property value into the Go type the parser uses for the property type
+func decodeJSONValue(typ uint16, raw json.RawMessage) (interface{}, error) {
+	var err error
+	switch typ {
+	case PropTypeI2:
+		var v int16
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeLong, PropTypeError:
+		var v int32
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeR4:
+		var v float32
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeDouble, PropTypeAppTime:
+		var v float64
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeBoolean:
+		var v bool
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeI8, PropTypeCurrency:
+		var v int64
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeUnicode, PropTypeString8, PropTypeCLSID:
+		var v string
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeSysTime:
+		var v time.Time
+		err = json.Unmarshal(raw, &v)
+		return fromJSONTime(&v), err
+	case PropTypeBinary, PropTypeSvrEID, PropTypeMultiple | PropTypeSvrEID:
+		var v []byte
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeMultiple | PropTypeI2:
+		var v []int16
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeMultiple | PropTypeLong:
+		var v []int32
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeMultiple | PropTypeR4:
+		var v []float32
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeMultiple | PropTypeDouble, PropTypeMultiple | PropTypeAppTime:
+		var v []float64
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeMultiple | PropTypeI8, PropTypeMultiple | PropTypeCurrency:
+		var v []int64
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeMultiple | PropTypeUnicode, PropTypeMultiple | PropTypeString8, PropTypeMultiple | PropTypeCLSID:
+		var v []string
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case PropTypeMultiple | PropTypeSysTime:
+		var v []time.Time
+		err = json.Unmarshal(raw, &v)
+		for i := range v {
+			v[i] = fromJSONTime(&v[i])
+		}
+		return v, err
+	case PropTypeMultiple | PropTypeBinary:
+		var v [][]byte
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("unsupported property type %s", PropertyTypeName(typ))
+}
+
+// jsonTime returns t in UTC, or nil for the zero time so it is left out
+func jsonTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// fromJSONTime returns a decoded time in the local time zone, matching the times produced by the parser
+func fromJSONTime(t *time.Time) time.Time {
+	if t == nil || t.IsZero() {
+		return time.Time{}
+	}
+	return t.Local()
+}
+
+// sortedIDs returns the keys of a property or named property map in ascending order
+func sortedIDs[V any](m map[int64]V) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
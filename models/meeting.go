@@ -0,0 +1,189 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Named properties of PSETID_Meeting
+const (
+	lidAttendeeCriticalChange = 0x0001 // PidLidAttendeeCriticalChange
+	lidGlobalObjectID         = 0x0003 // PidLidGlobalObjectId
+	lidIsRecurring            = 0x0005 // PidLidIsRecurring
+	lidIsException            = 0x000A // PidLidIsException
+	lidOwnerCriticalChange    = 0x001A // PidLidOwnerCriticalChange
+	lidCleanGlobalObjectID    = 0x0023 // PidLidCleanGlobalObjectId
+	lidMeetingType            = 0x0026 // PidLidMeetingType
+)
+
+// Named properties of PSETID_Appointment used by meeting responses
+const (
+	lidProposedStartWhole = 0x8250 // PidLidAppointmentProposedStartWhole
+	lidProposedEndWhole   = 0x8251 // PidLidAppointmentProposedEndWhole
+	lidCounterProposal    = 0x8257 // PidLidAppointmentCounterProposal
+)
+
+// MeetingType is the PidLidMeetingType of a meeting request
+type MeetingType int32
+
+// Meeting types
+const (
+	MeetingTypeEmpty         MeetingType = 0x00000000 // mtgEmpty
+	MeetingTypeRequest       MeetingType = 0x00000001 // mtgRequest, a new meeting
+	MeetingTypeFull          MeetingType = 0x00010000 // mtgFull, an update with changes attendees must respond to
+	MeetingTypeInfo          MeetingType = 0x00020000 // mtgInfo, an informational update
+	MeetingTypeOutOfDate     MeetingType = 0x00080000 // mtgOutOfDate, superseded by a later update
+	MeetingTypeDelegatorCopy MeetingType = 0x00100000 // mtgDelegatorCopy
+)
+
+// MeetingKind tells whether a meeting message is a request, a response or a cancellation
+type MeetingKind int
+
+// Kinds of meeting messages
+const (
+	MeetingRequest MeetingKind = iota
+	MeetingResponse
+	MeetingCancellation
+)
+
+// GlobalObjectID is a decoded PidLidGlobalObjectId, which identifies a meeting across the mailboxes of its attendees (MS-OXOCAL 2.2.1.27)
+type GlobalObjectID struct {
+	InstanceDate time.Time // Original date of the instance the message is about, zero for a whole series or single meeting
+	CreationTime time.Time
+	Data         []byte // Outlook generated id, or the UID of an iCalendar import after a "vCal-Uid" marker
+	raw          []byte
+}
+
+// ParseGlobalObjectID decodes a global object id
+func ParseGlobalObjectID(data []byte) (*GlobalObjectID, error) {
+	r := &blobReader{data: data}
+	r.bytes(16)        // Byte Array ID
+	date := r.bytes(4) // YH, YL, Month, D
+	ft := r.bytes(8)
+	r.bytes(8) // Reserved
+	payload := r.bytes(int(r.uint32()))
+	if r.err != nil {
+		return nil, r.err
+	}
+	res := &GlobalObjectID{
+		CreationTime: FiletimeToTime(binary.LittleEndian.Uint64(ft)),
+		Data:         payload,
+		raw:          data,
+	}
+	if year := int(date[0])<<8 | int(date[1]); year != 0 && date[2] != 0 && date[3] != 0 {
+		res.InstanceDate = time.Date(year, time.Month(date[2]), int(date[3]), 0, 0, 0, 0, time.UTC)
+	}
+	return res, nil
+}
+
+// Bytes returns the id as stored
+func (id *GlobalObjectID) Bytes() []byte {
+	return id.raw
+}
+
+// Clean returns the id without instance date, as stored in PidLidCleanGlobalObjectId
+func (id *GlobalObjectID) Clean() []byte {
+	res := append([]byte{}, id.raw...)
+	copy(res[16:20], []byte{0, 0, 0, 0})
+	return res
+}
+
+// UID returns the iCalendar UID of the meeting: the one embedded by iCalendar imports,
+// else the hex encoded clean id, as Exchange does
+func (id *GlobalObjectID) UID() string {
+	if i := bytes.Index(id.Data, []byte("vCal-Uid\x01\x00\x00\x00")); i >= 0 {
+		uid := id.Data[i+12:]
+		if end := bytes.IndexByte(uid, 0); end >= 0 {
+			uid = uid[:end]
+		}
+		return string(uid)
+	}
+	return strings.ToUpper(hex.EncodeToString(id.Clean()))
+}
+
+// MeetingMessage is a view of a meeting request, response or cancellation (IPM.Schedule.Meeting.*)
+type MeetingMessage struct {
+	*Appointment // The meeting the message is about
+
+	Kind                   MeetingKind
+	ResponseType           ResponseStatus  // Accepted, declined or tentative for responses, taken from the message class
+	GlobalObjectID         *GlobalObjectID // PidLidGlobalObjectId, nil if missing or invalid
+	CleanGlobalObjectID    []byte          // PidLidCleanGlobalObjectId
+	MeetingType            MeetingType     // PidLidMeetingType
+	IsRecurring            bool            // PidLidIsRecurring
+	IsException            bool            // PidLidIsException
+	OwnerCriticalChange    time.Time       // PidLidOwnerCriticalChange, when the organizer last made a change attendees must respond to
+	AttendeeCriticalChange time.Time       // PidLidAttendeeCriticalChange
+	CounterProposal        bool            // PidLidAppointmentCounterProposal, set when a response proposes a new time
+	ProposedStart          time.Time       // PidLidAppointmentProposedStartWhole
+	ProposedEnd            time.Time       // PidLidAppointmentProposedEndWhole
+}
+
+// MeetingMessage returns the meeting view of the message, or false when its class is not IPM.Schedule.Meeting.Request,
+// IPM.Schedule.Meeting.Resp.* or IPM.Schedule.Meeting.Canceled
+func (res *Message) MeetingMessage() (*MeetingMessage, bool) {
+	m := &MeetingMessage{}
+	switch class := res.MessageClass; {
+	case hasClass(class, "IPM.Schedule.Meeting.Request"):
+		m.Kind = MeetingRequest
+	case hasClass(class, "IPM.Schedule.Meeting.Resp.Pos"):
+		m.Kind, m.ResponseType = MeetingResponse, ResponseAccepted
+	case hasClass(class, "IPM.Schedule.Meeting.Resp.Neg"):
+		m.Kind, m.ResponseType = MeetingResponse, ResponseDeclined
+	case hasClass(class, "IPM.Schedule.Meeting.Resp.Tent"):
+		m.Kind, m.ResponseType = MeetingResponse, ResponseTentative
+	case hasClass(class, "IPM.Schedule.Meeting.Canceled"):
+		m.Kind = MeetingCancellation
+	default:
+		return nil, false
+	}
+	m.Appointment = res.appointment()
+	meeting := func(lid uint32) interface{} {
+		v, _ := res.NamedValue(PSETIDMeeting, lid)
+		return v
+	}
+	appt := func(lid uint32) interface{} {
+		v, _ := res.NamedValue(PSETIDAppointment, lid)
+		return v
+	}
+
+	if goid := asBytes(meeting(lidGlobalObjectID)); len(goid) > 0 {
+		m.GlobalObjectID, _ = ParseGlobalObjectID(goid)
+	}
+	m.CleanGlobalObjectID = asBytes(meeting(lidCleanGlobalObjectID))
+	m.MeetingType = MeetingType(asInt32(meeting(lidMeetingType)))
+	m.IsRecurring = asBool(meeting(lidIsRecurring))
+	m.IsException = asBool(meeting(lidIsException))
+	m.OwnerCriticalChange = asTime(meeting(lidOwnerCriticalChange))
+	m.AttendeeCriticalChange = asTime(meeting(lidAttendeeCriticalChange))
+	m.CounterProposal = asBool(appt(lidCounterProposal))
+	m.ProposedStart = asTime(appt(lidProposedStartWhole))
+	m.ProposedEnd = asTime(appt(lidProposedEndWhole))
+	return m, true
+}
+
+// UpdatesInstance reports whether the message is about a single instance of a recurring series rather than the whole series or a single meeting
+func (m *MeetingMessage) UpdatesInstance() bool {
+	return m.IsException || m.GlobalObjectID != nil && !m.GlobalObjectID.InstanceDate.IsZero()
+}
+
+// InstanceDate returns the original date of the instance the message is about, or the zero time
+func (m *MeetingMessage) InstanceDate() time.Time {
+	if m.GlobalObjectID == nil {
+		return time.Time{}
+	}
+	return m.GlobalObjectID.InstanceDate
+}
+
+// IsUpdate reports whether a request updates a meeting sent before rather than creating it
+func (m *MeetingMessage) IsUpdate() bool {
+	return m.Kind == MeetingRequest && m.MeetingType&(MeetingTypeFull|MeetingTypeInfo) != 0
+}
+
+// HasProposedTime reports whether a response proposes a new time for the meeting
+func (m *MeetingMessage) HasProposedTime() bool {
+	return m.CounterProposal && !m.ProposedStart.IsZero()
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"encoding/binary"
 	"log"
 	"strconv"
 	"strings"
@@ -15,43 +14,117 @@ import (
 
 // Message is a struct that holds a structered result of parsing the entry
 type Message struct {
-	MessageClass            string                // PR_MESSAGE_CLASS
-	MessageID               string                // PR_INTERNET_MESSAGE_ID
-	Subject                 string                // PR_SUBJECT
-	FromEmail               string                // PR_SENDER_EMAIL_ADDRESS
-	FromName                string                // PR_SENDER_NAME
-	ToDisplay               string                // PR_DISPLAY_TO
-	To                      string                // PR_DISPLAY_TO
-	CCDisplay               string                // PR_DISPLAY_CC
-	BCCDisplay              string                // PR_DISPLAY_BCC
-	CC                      string                // PR_DISPLAY_CC
-	BCC                     string                // PR_DISPLAY_BCC
-	BodyPlainText           string                // PR_BODY
-	BodyHTML                string                // PR_HTML
-	ConvertedBodyHTML       string                // The body in HTML format (converted from RTF)
-	Headers                 string                // Email headers (if available)
-	Date                    time.Time             // PR_MESSAGE_DELIVERY_TIME
-	ClientSubmitTime        time.Time             // PR_CLIENT_SUBMIT_TIME
-	CreationDate            time.Time             // PR_CREATION_TIME
-	LastModificationDate    time.Time             // PR_LAST_MODIFICATION_TIME
-	Attachments             []Attachment          // Attachments
-	Properties              map[int64]interface{} // Other properties
-	TransportMessageHeaders string                // Message Headers
-	Address                 []string              // Email Address
-	LastRecipient           int                   // Last recipient of the message
-
-	bodyCandidates []string
-	htmlCandidates []string
+	MessageClass            string                  // PR_MESSAGE_CLASS
+	MessageID               string                  // PR_INTERNET_MESSAGE_ID
+	Subject                 string                  // PR_SUBJECT
+	FromEmail               string                  // PR_SENDER_EMAIL_ADDRESS
+	FromName                string                  // PR_SENDER_NAME
+	ToDisplay               string                  // PR_DISPLAY_TO
+	To                      string                  // PR_DISPLAY_TO
+	CCDisplay               string                  // PR_DISPLAY_CC
+	BCCDisplay              string                  // PR_DISPLAY_BCC
+	CC                      string                  // PR_DISPLAY_CC
+	BCC                     string                  // PR_DISPLAY_BCC
+	BodyPlainText           string                  // PR_BODY
+	BodyHTML                string                  // PR_HTML
+	ConvertedBodyHTML       string                  // The body in HTML format (converted from RTF)
+	BodySource              BodySource              // The property BodyPlainText and BodyHTML were taken from
+	Headers                 string                  // Email headers (if available)
+	Date                    time.Time               // PR_MESSAGE_DELIVERY_TIME
+	ClientSubmitTime        time.Time               // PR_CLIENT_SUBMIT_TIME
+	CreationDate            time.Time               // PR_CREATION_TIME
+	LastModificationDate    time.Time               // PR_LAST_MODIFICATION_TIME
+	Attachments             []Attachment            // Attachments
+	Properties              map[int64]interface{}   // Other properties
+	PropertyTypes           map[int64]uint16        // MAPI types of the Properties whose Go type does not tell them, see PropertyTypeOf
+	TransportMessageHeaders string                  // Message Headers
+	Address                 []string                // Email Address
+	LastRecipient           int                     // Last recipient of the message
+	Recipients              []Recipient             // Recipient table
+	NamedProperties         map[int64]NamedProperty // Names of the named properties (0x8000 and above) found in Properties
+	Extensions              map[string]interface{}  // Values set by registered property handlers, keyed by a name of their choosing
+
+	bodyText         string // PR_BODY
+	bodyHTML         string // PR_HTML read as a string
+	bodyHTMLRaw      []byte // PR_HTML read as binary, decoded with internetCodepage
+	internetCodepage int32  // PR_INTERNET_CPID
 }
 
+// BodySource is the property the body of a message was taken from
+type BodySource int32
+
+// Body sources
+const (
+	BodySourceNone      BodySource = 0 // The message has no body
+	BodySourcePlainText BodySource = 1 // PR_BODY
+	BodySourceRTF       BodySource = 2 // PR_RTF_COMPRESSED
+	BodySourceHTML      BodySource = 3 // PR_HTML
+)
+
+// String returns the name of the source
+func (s BodySource) String() string {
+	switch s {
+	case BodySourceNone:
+		return "none"
+	case BodySourcePlainText:
+		return "plain text"
+	case BodySourceRTF:
+		return "rtf"
+	case BodySourceHTML:
+		return "html"
+	}
+	return "unknown"
+}
+
+// Attachment holds a single entry of the attachment table
 type Attachment struct {
-	Name string
-	// Add other relevant fields as needed
+	Name      string   // PR_DISPLAY_NAME
+	FileName  string   // PR_ATTACH_LONG_FILENAME or PR_ATTACH_FILENAME
+	MimeType  string   // PR_ATTACH_MIME_TAG
+	ContentID string   // PR_ATTACH_CONTENT_ID
+	Method    int32    // PR_ATTACH_METHOD
+	Data      []byte   // PR_ATTACH_DATA_BIN
+	Embedded  *Message // PR_ATTACH_DATA_OBJ, set for attached messages
+
+	Properties    map[int64]interface{} // Other properties
+	PropertyTypes map[int64]uint16      // MAPI types of the Properties whose Go type does not tell them
+}
+
+// Attachment methods (PR_ATTACH_METHOD)
+const (
+	AttachByValue        = 1 // ATTACH_BY_VALUE
+	AttachEmbeddedMsg    = 5 // ATTACH_EMBEDDED_MSG
+	AttachOLE            = 6 // ATTACH_OLE
+	AttachByWebReference = 7 // ATTACH_BY_WEB_REFERENCE
+)
+
+// RecipientType is the PR_RECIPIENT_TYPE of a recipient
+type RecipientType int32
+
+// Recipient types
+const (
+	RecipientOriginator RecipientType = 0 // MAPI_ORIG
+	RecipientTo         RecipientType = 1 // MAPI_TO
+	RecipientCC         RecipientType = 2 // MAPI_CC
+	RecipientBCC        RecipientType = 3 // MAPI_BCC
+)
+
+// Recipient holds a single entry of the recipient table
+type Recipient struct {
+	Type         RecipientType // PR_RECIPIENT_TYPE
+	DisplayName  string        // PR_DISPLAY_NAME
+	EmailAddress string        // PR_EMAIL_ADDRESS
+	AddressType  string        // PR_ADDRTYPE
+	SMTPAddress  string        // PR_SMTP_ADDRESS
+
+	Properties    map[int64]interface{} // Other properties
+	PropertyTypes map[int64]uint16      // MAPI types of the Properties whose Go type does not tell them
 }
 
 const AttachmentPrefix = "__attach_"
 
-// SetProperties sets the message properties and collects body/html candidates
+// SetProperties maps a property onto the message using the handler registered for its id (see RegisterPropertyHandler),
+// storing it in Properties when there is none or the handler does not consume it
 func (res *Message) SetProperties(msgProps MessageEntryProperty) {
 	name := msgProps.Class
 	data := msgProps.Data
@@ -69,591 +142,109 @@ func (res *Message) SetProperties(msgProps MessageEntryProperty) {
 		return
 	}
 
-	// --- Robust body and HTML property handling ---
-	// In the switch, collect all body and HTML candidates
-	switch class {
-	case 0x1a:
-		// PR_MESSAGE_CLASS: The message class of the message
-		if res.MessageClass == "" {
-			res.MessageClass = data.(string)
-		}
-
-	case 0x1035:
-		// PR_INTERNET_MESSAGE_ID: The Internet message ID of the message
-		if res.MessageID == "" {
-			res.MessageID = data.(string)
-		}
-
-	case 0x37:
-		// PR_SUBJECT: The subject of the message
-		if res.Subject == "" {
-			res.Subject = data.(string)
-		}
-
-	case 0xe1d:
-		// PR_NORMALIZED_SUBJECT: The normalized subject of the message
-		if res.Subject == "" {
-			res.Subject = data.(string)
-		}
-
-	case 0xc1f:
-		// PR_SENDER_EMAIL_ADDRESS: The email address of the sender
-		if isValidEmail(data.(string)) {
-			if res.FromEmail == "" {
-				res.FromEmail = data.(string)
-			} else if !strings.Contains(res.FromEmail, data.(string)) {
-				res.FromEmail = data.(string) + ", " + res.FromEmail
-			}
-		}
-	case 0x65:
-		// PR_SENT_REPRESENTING_EMAIL_ADDRESS: The email address of the user represented by the sender
-		if res.FromEmail == "" && isValidEmail(data.(string)) {
-			res.FromEmail = data.(string)
-		} else if !strings.Contains(res.FromEmail, data.(string)) {
-			res.FromEmail = data.(string) + ", " + res.FromEmail
-		}
-	case 0x3ffa:
-		// PR_LAST_MODIFIER_NAME: The name of the last user to modify the message
-		if res.FromName == "" {
-			res.FromName = data.(string)
-		}
-
-	case 0x1000, 0x3ff9, 0x65e0, 0x65e2, 0xff9, 0x120b:
-		// PR_BODY: The plain text body of the message
-		if v, ok := data.([]uint8); ok {
-			if cleaned, ok := CleanAndAcceptBodyCandidate(string(v), 10); ok {
-				res.bodyCandidates = append(res.bodyCandidates, cleaned)
-			}
-		} else if v, ok := data.(string); ok {
-			if cleaned, ok := CleanAndAcceptBodyCandidate(v, 10); ok {
-				res.bodyCandidates = append(res.bodyCandidates, cleaned)
-			}
-		}
-	case 0x1001, 0x1013, 0x3ffb, 0x65e1, 0x65e3, 0x5ff7, 0xc25, 0xf03:
-		// PR_BODY_HTML: The HTML body of the message
-		if v, ok := data.([]uint8); ok {
-			if cleaned, ok := CleanAndAcceptBodyCandidate(string(v), 10); ok {
-				res.htmlCandidates = append(res.htmlCandidates, cleaned)
-			}
-		} else if v, ok := data.(string); ok {
-			if cleaned, ok := CleanAndAcceptBodyCandidate(v, 10); ok {
-				res.htmlCandidates = append(res.htmlCandidates, cleaned)
-			}
-		}
-
-	case 0x3007:
-		// PR_CREATION_TIME: The creation time of the message
-		if res.CreationDate.IsZero() {
-			res.CreationDate = data.(time.Time)
-		}
-
-	case 0x3008:
-		// PR_LAST_MODIFICATION_TIME: The last modification time of the message
-		if res.LastModificationDate.IsZero() {
-			res.LastModificationDate = data.(time.Time)
-		}
-
-	case 0xe06:
-		// PR_CLIENT_SUBMIT_TIME: The client submit time of the message
-		if res.ClientSubmitTime.IsZero() {
-			res.ClientSubmitTime = data.(time.Time)
-		}
-
-	case 0xe0f:
-		// PR_MESSAGE_DELIVERY_TIME: The delivery time of the message
-		if res.Date.IsZero() {
-			res.Date = data.(time.Time)
-		}
-
-	case 0x0002:
-		// PR_IMPORTANCE: The importance level of the message
-		if intData, ok := data.([]uint8); ok {
-			res.Properties[class] = intData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x0003:
-		// PR_PRIORITY: The priority level of the message
-		if intData, ok := data.([]uint8); ok {
-			res.Properties[class] = intData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x0004:
-		// PR_PRIORITY: The priority level of the message
-		if floatData, ok := data.([]uint8); ok {
-			res.Properties[class] = floatData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x1002:
-		// PR_REPORT_TEXT: Text of a report
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = string(byteData)
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x1008:
-		// PR_ORIGINATOR_DELIVERY_REPORT_REQUESTED: Indicates if a delivery report is requested
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = byteData[0] != 0
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x1009:
-		// PR_READ_RECEIPT_REQUESTED: Indicates if a read receipt is requested
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = byteData[0] != 0
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x1014:
-		// PR_RTF_SYNC_BODY_CRC: CRC of the RTF body
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = int32(binary.LittleEndian.Uint32(byteData))
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x1015:
-		// PR_RTF_SYNC_BODY_COUNT: Count of the RTF body
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = int32(binary.LittleEndian.Uint32(byteData))
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x003b:
-		// PR_ENTRYID: Entry identifier
-		if binData, ok := data.([]byte); ok {
-			res.Properties[class] = binData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x003f:
-		// PR_OBJECT_TYPE: Type of the object
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = int32(binary.LittleEndian.Uint32(byteData))
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x0041:
-		// PR_ICON: Icon of the message
-		if binData, ok := data.([]byte); ok {
-			res.Properties[class] = binData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x0051:
-		// PR_ACCESS: Access level of the message
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = int32(binary.LittleEndian.Uint32(byteData))
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x0071:
-		// PR_ACCESS_LEVEL: Access level of the message
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = int32(binary.LittleEndian.Uint32(byteData))
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x0c19:
-		// PR_SENDER_ENTRYID: Entry identifier of the sender
-		if binData, ok := data.([]byte); ok {
-			res.Properties[class] = binData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x0c1d:
-		// PR_SENT_REPRESENTING_ENTRYID: Entry identifier of the user represented by the sender
-		if binData, ok := data.([]byte); ok {
-			res.Properties[class] = binData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x300b:
-		// PR_HASATTACH: Indicates if the message has attachments
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = byteData[0] != 0
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0xe04, 0x800d:
-		// PR_DISPLAY_TO: The display names of the primary (To) recipients
-		if byteData, ok := data.([]uint8); ok {
-			if res.ToDisplay == "" {
-				res.ToDisplay = string(byteData)
-			}
-		} else if strData, ok := data.(string); ok {
-			if res.ToDisplay == "" {
-				res.ToDisplay = strData
-			}
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0xe03, 0x800e:
-		// PR_DISPLAY_CC: The display names of the carbon copy (CC) recipients
-
-		if byteData, ok := data.([]uint8); ok {
-			if res.CCDisplay == "" {
-				res.CCDisplay = string(byteData)
-			}
-		} else if strData, ok := data.(string); ok {
-			if res.CCDisplay == "" {
-				res.CCDisplay = strData
-			}
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0xe02, 0x800f:
-		// PR_DISPLAY_BCC: The display names of the blind carbon copy (BCC) recipients
-
-		if byteData, ok := data.([]uint8); ok {
-			if res.BCCDisplay == "" {
-				res.BCCDisplay = string(byteData)
-			}
-		} else if strData, ok := data.(string); ok {
-			if res.BCCDisplay == "" {
-				res.BCCDisplay = strData
-			}
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x8002:
-		// PR_TRANSPORT_MESSAGE_HEADERS: Transport message headers
-		if strData, ok := data.([]string); ok {
-			res.Properties[class] = strData
-		} else if strData, ok := data.(string); ok {
-			res.Properties[class] = strData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x0ff6:
-		// PR_CONVERSATION_TOPIC: Conversation topic
-		if res.Properties[class] == nil {
-			if byteData, ok := data.([]uint8); ok {
-				res.Properties[class] = string(byteData)
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x0fff:
-		// PR_CONVERSATION_INDEX: Conversation index
-		if binData, ok := data.([]byte); ok {
-			res.Properties[class] = binData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-		// Documented but not implemented properties
-	case 0x1005:
-		// PR_BODY_CONTENT_LOCATION: Content location of the body
-		// Not implemented
-
-	case 0x1006:
-		// PR_BODY_CONTENT_ID: Content ID of the body
-		// Not implemented
-
-	case 0x1007:
-		// PR_BODY_CONTENT_TYPE: Content type of the body
-		// Not implemented
-
-	case 0x100b:
-		// PR_BODY_ENCODING: Encoding of the body
-		// Not implemented
-
-	case 0x100c:
-		// PR_BODY_SIZE: Size of the body
-		// Not implemented
-
-	case 0x100d:
-		// PR_BODY_TAG: Tag of the body
-		// Not implemented
-
-	case 0x100f:
-		// PR_BODY_TYPE: Type of the body
-		// Not implemented
-
-	case 0x1011:
-		// PR_BODY_CHARSET: Charset of the body
-		// Not implemented
-
-	case 0x1016:
-		// PR_BODY_LANGUAGE: Language of the body
-		// Not implemented
-
-	case 0x1017:
-		// PR_BODY_SUBTYPE: Subtype of the body
-		// Not implemented
-
-	case 0x1018:
-		// PR_BODY_TRANSFER_ENCODING: Transfer encoding of the body
-		// Not implemented
-
-	case 0x1019:
-		// PR_BODY_DISPOSITION: Disposition of the body
-		// Not implemented
-
-	case 0x101a:
-		// PR_BODY_DISPOSITION_TYPE: Disposition type of the body
-		// Not implemented
-
-	case 0x101b:
-		// PR_BODY_DISPOSITION_PARAMS: Disposition parameters of the body
-		// Not implemented
-
-	case 0x101c:
-		// PR_BODY_DISPOSITION_FILENAME: Disposition filename of the body
-		// Not implemented
-
-	case 0x101e:
-		// PR_BODY_DISPOSITION_CREATION_DATE: Disposition creation date of the body
-		// Not implemented
-
-	case 0x43:
-		// PR_BODY_DISPOSITION_MODIFICATION_DATE: Disposition modification date of the body
-		// Not implemented
-
-	case 0x52:
-		// PR_BODY_DISPOSITION_READ_DATE: Disposition read date of the body
-		// Not implemented
-
-	case 0xe0b:
-		// PR_BODY_CRC: CRC of the message body
-		// Not implemented
-
-	case 0xe4b:
-		// PR_RTF_SYNC_BODY_CRC: CRC of the RTF body
-		// Not implemented
-
-	case 0xe4c:
-		// PR_RTF_SYNC_BODY_COUNT: Count of the RTF body
-		// Not implemented
-
-	case 0xe58:
-		// PR_RTF_SYNC_BODY_TAG: Tag of the RTF body
-		// Not implemented
-
-	case 0xe59:
-		// PR_RTF_SYNC_BODY_TAG: Tag of the RTF body
-		// Not implemented
-
-	case 0x3013:
-		// PR_CREATION_TIME: Creation time of the message
-		// Not implemented
-
-	case 0x3014:
-		// PR_LAST_MODIFICATION_TIME: Last modification time of the message
-		// Not implemented
-
-	case 0x8000:
-		// PR_TRANSPORT_MESSAGE_HEADERS: Transport message headers
-		// Not implemented
-
-	case 0x8007:
-		// PR_TRANSPORT_MESSAGE_HEADERS: Transport message headers
-		// Not implemented
-
-	case 0x8008:
-		// PR_TRANSPORT_MESSAGE_HEADERS: Transport message headers
-		// Not implemented
-
-	case 0x800b:
-		// PR_TRANSPORT_MESSAGE_HEADERS: Transport message headers
-		// Not implemented
-
-	case 0x802c:
-		// PR_TRANSPORT_MESSAGE_HEADERS: Transport message headers
-		// Not implemented
-
-	case 0x802e:
-		// PR_TRANSPORT_MESSAGE_HEADERS: Transport message headers
-		// Not implemented
-
-	case 0x4099:
-		// PR_MESSAGE_FLAGS: Flags indicating the status or attributes of the message
-		if intData, ok := data.(int32); ok {
-			res.Properties[class] = intData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-	case 0x1003:
-		// PR_IMPORTANCE: The importance level of the message
-		if intData, ok := data.([]uint8); ok {
-			res.Properties[class] = intData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x1004:
-		// PR_PRIORITY: The priority level of the message
-		if intData, ok := data.([]uint8); ok {
-			res.Properties[class] = intData
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x007D:
-		// PR_TRANSPORT_MESSAGE_HEADERS: Transport message headers
-		if res.TransportMessageHeaders == "" {
-			if byteData, ok := data.([]uint8); ok {
-				res.TransportMessageHeaders = string(byteData)
-			} else if strData, ok := data.(string); ok {
-				res.TransportMessageHeaders = strData
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
-
-	case 0x3003, 0xC025, 0x39FE:
-		// PR_EMAIL_ADDRESS - PR_SMTP_ADDRES
-		if byteData, ok := data.([]uint8); ok {
-			address := string(byteData)
-			if isValidEmail(address) {
-				res.Address = append(res.Address, string(byteData))
-
-				if res.LastRecipient == 0 {
-					// Add the new address to TO
-					res.To = res.To + address + "; "
-				} else if res.LastRecipient == 1 {
-					// Add the new address to CC
-					res.CC = res.CC + address + "; "
-				} else if res.LastRecipient == 2 {
-					// Add the new address to BCC
-					res.BCC = res.BCC + address + "; "
-				}
-			}
-		} else if strData, ok := data.(string); ok {
-			address := strData
-			if isValidEmail(address) {
-				res.Address = append(res.Address, strData)
-
-				// Recipient ID  seems to not be present so we will copy all of them a CC
-
-				if !strings.Contains(res.To, strData) {
-					res.To = res.To + strData + "; "
-				}
-
-				/*if res.LastRecipient == 0 {
-					// Add the new address to TO
-					res.To = res.To + strData + "; "
-				} else if res.LastRecipient == 1 {
-					// Add the new address to CC
-					res.CC = res.CC + strData + "; "
-				} else if res.LastRecipient == 2 {
-					// Add the new address to BCC
-					res.BCC = res.BCC + "; "
-				}*/
-			}
-
-		} else {
-			log.Printf("Unexpected type for property %x: %T", class, data)
-		}
-
-	case 0x0C24:
-		// PR_SENT_REPRESENTING_ADDRTYPE
-
-	// Handle attachment file name properties (PR_ATTACH_FILENAME, PR_ATTACH_LONG_FILENAME)
-	case 0x3701, 0x3702, 0x371d:
-		if byteData, ok := data.([]uint8); ok {
-			res.Properties[class] = string(byteData)
-		} else if strData, ok := data.(string); ok {
-			res.Properties[class] = strData
-		}
-
-	// Handle PR_ATTACH_MIME_TAG (MIME tag for attachment)
-	case 0x8004:
-		if strSlice, ok := data.([]string); ok {
-			res.Properties[class] = strings.Join(strSlice, ", ")
-		} else if strData, ok := data.(string); ok {
-			res.Properties[class] = strData
-		}
+	// Named properties get their id from the name-ID map of each file, so they cannot be matched by number
+	if class >= 0x8000 {
+		res.Properties[class] = data
+		recordPropertyType(&res.PropertyTypes, class, msgProps.Mapi, data)
+		return
+	}
 
-	// Handle string properties that may come as []uint8
-	case 0x1010, 0x1012, 0x101d, 0x3019, 0x301b, 0x8021:
-		if byteData, ok := data.([]uint8); ok {
-			res.Properties[class] = string(byteData)
-		} else if strData, ok := data.(string); ok {
-			res.Properties[class] = strData
-		}
+	if class == 0 || data == nil {
+		return
+	}
+	if handler := LookupPropertyHandler(class); handler != nil && res.applyHandler(handler, class, data) {
+		return
+	}
+	// Store other properties in the Properties map
+	if _, exists := res.Properties[class]; !exists {
+		res.Properties[class] = data
+		recordPropertyType(&res.PropertyTypes, class, msgProps.Mapi, data)
+	}
+}
 
-	// Handle additional properties based on log
-	case 0x100a:
-		// PR_BODY_HTML_ALT or similar: treat as string if possible
-		if byteData, ok := data.([]uint8); ok {
-			res.Properties[class] = string(byteData)
-		} else if strData, ok := data.(string); ok {
-			res.Properties[class] = strData
-		}
-	case 0x8005:
-		// Possibly PR_ATTACH_CONTENT_ID or similar, can be []string or string
-		if strSlice, ok := data.([]string); ok {
-			res.Properties[class] = strings.Join(strSlice, ", ")
-		} else if strData, ok := data.(string); ok {
-			res.Properties[class] = strData
-		}
-	case 0x8011, 0x8025, 0x802d:
-		// Unknown, but treat []uint8 as string
-		if byteData, ok := data.([]uint8); ok {
-			res.Properties[class] = string(byteData)
-		} else if strData, ok := data.(string); ok {
-			res.Properties[class] = strData
-		}
+// SetProperties sets the recipient properties, keeping the ones without a field in Properties
+func (res *Recipient) SetProperties(msgProps MessageEntryProperty) {
+	data := msgProps.Data
+	if res.Properties == nil {
+		res.Properties = make(map[int64]interface{}, 2)
+	}
+	class, err := strconv.ParseInt(msgProps.Class, 16, 32)
+	if err != nil || data == nil {
+		return
+	}
+	switch class {
+	case 0x0c15:
+		// PR_RECIPIENT_TYPE: To, CC or BCC
+		if v, ok := data.(int32); ok {
+			res.Type = RecipientType(v)
+		}
+	case 0x3001:
+		// PR_DISPLAY_NAME
+		res.DisplayName, _ = data.(string)
+	case 0x3002:
+		// PR_ADDRTYPE
+		res.AddressType, _ = data.(string)
+	case 0x3003:
+		// PR_EMAIL_ADDRESS
+		res.EmailAddress, _ = data.(string)
+	case 0x39fe:
+		// PR_SMTP_ADDRESS
+		res.SMTPAddress, _ = data.(string)
+	case 0x3000, 0x0ffe:
+		// PR_ROWID, PR_OBJECT_TYPE: Derived from the recipient table when it is written
+	default:
+		res.Properties[class] = data
+		recordPropertyType(&res.PropertyTypes, class, msgProps.Mapi, data)
+	}
+}
 
+// SetProperties sets the attachment properties, keeping the ones without a field in Properties
+func (res *Attachment) SetProperties(msgProps MessageEntryProperty) {
+	data := msgProps.Data
+	if res.Properties == nil {
+		res.Properties = make(map[int64]interface{}, 2)
+	}
+	class, err := strconv.ParseInt(msgProps.Class, 16, 32)
+	if err != nil || data == nil {
+		return
+	}
+	switch class {
+	case 0x3001:
+		// PR_DISPLAY_NAME
+		res.Name, _ = data.(string)
+	case 0x3704:
+		// PR_ATTACH_FILENAME: The 8.3 file name, used until a long file name is found
+		if res.FileName == "" {
+			res.FileName, _ = data.(string)
+		}
+		res.Properties[class] = data
+		recordPropertyType(&res.PropertyTypes, class, msgProps.Mapi, data)
+	case 0x3707:
+		// PR_ATTACH_LONG_FILENAME
+		res.FileName, _ = data.(string)
+	case 0x370e:
+		// PR_ATTACH_MIME_TAG
+		res.MimeType, _ = data.(string)
+	case 0x3712:
+		// PR_ATTACH_CONTENT_ID
+		res.ContentID, _ = data.(string)
+	case 0x3705:
+		// PR_ATTACH_METHOD
+		res.Method, _ = data.(int32)
+	case 0x3701:
+		// PR_ATTACH_DATA_BIN
+		res.Data, _ = data.([]byte)
+	case 0x0e20, 0x0e21, 0x0ffe:
+		// PR_ATTACH_SIZE, PR_ATTACH_NUM, PR_OBJECT_TYPE: Derived from the attachment table when it is written
 	default:
-		// Store other properties in the Properties map
-		if class == 0 {
-			return
-		}
-		if _, exists := res.Properties[class]; !exists {
-			if strData, ok := data.(string); ok {
-				res.Properties[class] = strData
-			} else {
-				log.Printf("Unexpected type for property %x: %T", class, data)
-			}
-		}
+		res.Properties[class] = data
+		recordPropertyType(&res.PropertyTypes, class, msgProps.Mapi, data)
 	}
 }
 
 // CleanAndAcceptBodyCandidate cleans the input and returns it if it is a valid body candidate.
+//
+// Deprecated: the body is no longer picked among candidates, see CalculateFinalBody.
 func CleanAndAcceptBodyCandidate(input string, minLen int) (string, bool) {
 	cleaned := strings.TrimSpace(input)
 	if len(cleaned) < minLen {
@@ -732,47 +323,106 @@ func (res *Message) HandleAttachment(entry *mscfb.File) {
 	res.Attachments = append(res.Attachments, attachment)
 }
 
-// CalculateFinalBody selects the best HTML or plain text body from the candidate arrays.
-//
-// Reasoning:
-// - If any HTML candidates are present, the longest one is chosen as BodyHTML (HTML is preferred for fidelity).
-// - If no HTML is present but plain text candidates exist, the longest one is chosen as BodyPlainText.
-// - If neither is present, both fields remain empty.
-// This approach ensures the richest available content is used, and avoids short/empty/partial bodies.
+// CalculateFinalBody sets the body of the message from its body properties. The body is taken from the
+// property PR_NATIVE_BODY_INFO names; without it, from PR_RTF_COMPRESSED when PR_RTF_IN_SYNC is set, then from
+// PR_HTML, PR_BODY and an RTF body that is not in sync, in that order (MS-OXCMSG 2.2.1.56.4).
+// An RTF body that encapsulates HTML sets BodyHTML and ConvertedBodyHTML, any other sets the plain text when
+// PR_BODY is missing. A missing plain text body is rendered from BodyHTML. BodySource records the property used,
+// and a message without body properties keeps its bodies.
 func (res *Message) CalculateFinalBody() {
-	if len(res.htmlCandidates) > 0 {
-		// Pick the longest valid HTML
-		best := res.htmlCandidates[0]
-		for _, h := range res.htmlCandidates[1:] {
-			if len(h) > len(best) {
-				best = h
-			}
-		}
-		res.BodyHTML = best
+	html := res.bodyHTML
+	if res.bodyHTMLRaw != nil {
+		html = DecodeCodepage(res.bodyHTMLRaw, res.internetCodepage)
+	}
+	html = strings.Trim(html, bodySpace)
+	text := strings.Trim(res.bodyText, bodySpace)
+	var rtf []byte
+	if data, ok := res.Properties[0x1009].([]byte); ok { // PR_RTF_COMPRESSED
+		rtf, _ = DecompressRTF(data)
+	}
+	native, _ := res.Properties[0x1016].(int32) // PR_NATIVE_BODY_INFO
+	inSync, _ := res.Properties[0x0E1F].(bool)  // PR_RTF_IN_SYNC
+
+	source := BodySourceNone
+	switch {
+	case native == nativeBodyPlainText && text != "":
+		source = BodySourcePlainText
+	case native == nativeBodyRTF && len(rtf) > 0:
+		source = BodySourceRTF
+	case native == nativeBodyHTML && html != "":
+		source = BodySourceHTML
+	case len(rtf) > 0 && inSync:
+		source = BodySourceRTF
+	case html != "":
+		source = BodySourceHTML
+	case text != "":
+		source = BodySourcePlainText
+	case len(rtf) > 0:
+		source = BodySourceRTF
 	}
 
-	if len(res.bodyCandidates) > 0 {
-		// Pick the longest valid plain text
-		best := res.bodyCandidates[0]
-		for _, b := range res.bodyCandidates[1:] {
-			if len(b) > len(best) {
-				best = b
+	switch source {
+	case BodySourceRTF:
+		if converted, ok := RTFToHTML(rtf); ok {
+			res.BodyHTML, res.ConvertedBodyHTML = converted, converted
+		} else {
+			res.BodyHTML = html
+			if text == "" {
+				text = strings.Trim(RTFToText(rtf), bodySpace)
 			}
 		}
-		res.BodyPlainText = best
-	}
-
-	if len(res.BodyPlainText) > 0 && len(res.BodyHTML) == 0 {
-		// If we have plain text but no HTML, set HTML to the plain text
-		res.BodyHTML = res.BodyPlainText
+	case BodySourceHTML, BodySourcePlainText:
+		res.BodyHTML = html
 	}
-	if len(res.BodyHTML) > 0 && len(res.BodyPlainText) == 0 {
-		// If we have HTML but no plain text, set plain text to the HTML
-		res.BodyPlainText = res.BodyHTML
+	if source != BodySourceNone {
+		res.BodySource = source
+		res.BodyPlainText = text
+		if text == "" && res.BodyHTML != "" {
+			res.BodyPlainText = HTMLToText(res.BodyHTML)
+		}
 	}
-	if len(res.BodyPlainText) == 0 && len(res.BodyHTML) == 0 {
-		// If both are empty, set them to a default value or leave them empty
-		res.BodyPlainText = "No content available"
-		res.BodyHTML = "No content available"
+
+	// The body properties are only needed once, drop them so a re-parsed message compares equal
+	res.bodyText = ""
+	res.bodyHTML = ""
+	res.bodyHTMLRaw = nil
+	res.internetCodepage = 0
+}
+
+// bodySpace is trimmed from the bodies, along with the terminating null some writers leave in them
+const bodySpace = " \t\r\n\x00"
+
+// Formats of PR_NATIVE_BODY_INFO
+const (
+	nativeBodyPlainText = 1
+	nativeBodyRTF       = 2
+	nativeBodyHTML      = 3
+)
+
+// CalculateAddresses fills To, CC, BCC, Address and LastRecipient from the recipient table
+func (res *Message) CalculateAddresses() {
+	for i, recip := range res.Recipients {
+		address := recip.SMTPAddress
+		if !isValidEmail(address) {
+			address = recip.EmailAddress
+		}
+		res.LastRecipient = i
+		if !isValidEmail(address) {
+			continue
+		}
+		res.Address = append(res.Address, address)
+		switch recip.Type {
+		case RecipientTo:
+			res.To = res.To + address + "; "
+		case RecipientCC:
+			res.CC = res.CC + address + "; "
+		case RecipientBCC:
+			res.BCC = res.BCC + address + "; "
+		}
 	}
 }
+
+// HasBody reports whether the message has a plain text or HTML body
+func (res *Message) HasBody() bool {
+	return res.BodyPlainText != "" || res.BodyHTML != ""
+}
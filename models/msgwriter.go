@@ -0,0 +1,548 @@
+package models
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/yuphing-ong/outlook-msg-parser/cfb"
+)
+
+// Storage and stream names of the msg format
+const (
+	propertiesStream   = "__properties_version1.0"
+	substgPrefix       = "__substg1.0_"
+	recipientPrefix    = "__recip_version1.0_#"
+	attachmentPrefix   = "__attach_version1.0_#"
+	nameIDStorage      = "__nameid_version1.0"
+	embeddedMsgStorage = "__substg1.0_3701000D"
+)
+
+// Header sizes of the __properties_version1.0 stream
+const (
+	topLevelPropsHeader  = 32
+	embeddedPropsHeader  = 24
+	subObjectPropsHeader = 8
+)
+
+// propAttributes marks a property as readable and writable (PROPATTR_READABLE | PROPATTR_WRITABLE)
+const propAttributes = 0x00000006
+
+// WriteMSG serializes the message, its recipients, attachments and named properties as an Outlook .msg compound file
+func (res *Message) WriteMSG(w io.Writer) error {
+	names := newNameMap()
+	names.collect(res)
+
+	root := cfb.New()
+	if err := writeMessage(root, res, topLevelPropsHeader, names); err != nil {
+		return err
+	}
+	names.write(root.AddStorage(nameIDStorage))
+	_, err := root.WriteTo(w)
+	return err
+}
+
+// writeMessage writes the properties, recipients and attachments of msg into st
+func writeMessage(st *cfb.Storage, msg *Message, headerSize int, names *nameMap) error {
+	props := &propertyWriter{}
+	class := msg.MessageClass
+	if class == "" {
+		class = "IPM.Note"
+	}
+	props.set(0x001A, class)
+	props.set(0x0037, msg.Subject)
+	props.set(0x1035, msg.MessageID)
+	props.set(0x0042, msg.FromName)
+	props.set(0x0C1A, msg.FromName)
+	// The parser keeps the sender addresses in Properties, which take precedence for their own tag; FromEmail
+	// only stands in for them in messages built without these properties
+	senders := strings.Split(msg.FromEmail, ", ")
+	props.set(0x0C1F, senders[0])
+	props.set(0x0065, senders[len(senders)-1])
+	props.set(0x0E04, msg.ToDisplay)
+	props.set(0x0E03, msg.CCDisplay)
+	props.set(0x0E02, msg.BCCDisplay)
+	props.set(0x1000, msg.BodyPlainText)
+	if msg.BodyHTML != "" && !convertedFromRTF(msg) {
+		// PR_HTML is binary; declare the bytes as UTF-8 through PR_INTERNET_CPID
+		props.set(0x1013, []byte(msg.BodyHTML))
+		props.set(0x3FDE, int32(65001))
+	}
+	if native := nativeBody(msg); native != 0 {
+		props.set(0x1016, native)
+	}
+	props.set(0x007D, msg.TransportMessageHeaders)
+	props.set(0x0039, msg.ClientSubmitTime)
+	props.set(0x0E06, msg.Date)
+	props.set(0x3007, msg.CreationDate)
+	props.set(0x3008, msg.LastModificationDate)
+	props.set(0x0E1B, len(msg.Attachments) > 0)
+	props.set(0x340D, int32(0x00040000)) // PR_STORE_SUPPORT_MASK: STORE_UNICODE_OK
+	if flags, ok := msg.Properties[0x0E07].(int32); ok {
+		// PR_MESSAGE_FLAGS: keep MSGFLAG_HASATTACH in sync with the attachment table
+		flags &^= 0x10
+		if len(msg.Attachments) > 0 {
+			flags |= 0x10
+		}
+		props.set(0x0E07, flags)
+	}
+	for _, id := range []uint16{0x0C1F, 0x0065} {
+		if v, ok := msg.Properties[int64(id)]; ok {
+			typ, _ := propertyType(msg.PropertyTypes, int64(id), v)
+			props.put(id, typ, v)
+		}
+	}
+	props.setAll(msg.Properties, msg.PropertyTypes, msg.NamedProperties, names)
+
+	for i, recip := range msg.Recipients {
+		rp := &propertyWriter{}
+		rp.set(0x0C15, int32(recip.Type))
+		rp.set(0x3000, int32(i))
+		rp.set(0x0FFE, int32(6)) // MAPI_MAILUSER
+		rp.set(0x3001, recip.DisplayName)
+		rp.set(0x3002, recip.AddressType)
+		rp.set(0x3003, recip.EmailAddress)
+		rp.set(0x39FE, recip.SMTPAddress)
+		rp.setAll(recip.Properties, recip.PropertyTypes, msg.NamedProperties, names)
+		if err := rp.write(st.AddStorage(fmt.Sprintf("%s%08X", recipientPrefix, i)), subObjectPropsHeader); err != nil {
+			return err
+		}
+	}
+
+	for i, att := range msg.Attachments {
+		sub := st.AddStorage(fmt.Sprintf("%s%08X", attachmentPrefix, i))
+		ap := &propertyWriter{}
+		method := att.Method
+		if method == 0 {
+			method = AttachByValue
+		}
+		if att.Embedded != nil {
+			method = AttachEmbeddedMsg
+		}
+		ap.set(0x3705, method)
+		ap.set(0x0E21, int32(i))
+		ap.set(0x0FFE, int32(7)) // MAPI_ATTACH
+		ap.set(0x3001, att.Name)
+		ap.set(0x3707, att.FileName)
+		ap.set(0x370E, att.MimeType)
+		ap.set(0x3712, att.ContentID)
+		if att.Embedded != nil {
+			ap.setObject(0x3701)
+			if err := writeMessage(sub.AddStorage(embeddedMsgStorage), att.Embedded, embeddedPropsHeader, names); err != nil {
+				return err
+			}
+		} else {
+			ap.set(0x3701, att.Data)
+			ap.set(0x0E20, int32(len(att.Data)))
+		}
+		ap.setAll(att.Properties, att.PropertyTypes, msg.NamedProperties, names)
+		if err := ap.write(sub, subObjectPropsHeader); err != nil {
+			return err
+		}
+	}
+
+	header := make([]byte, headerSize)
+	if headerSize > subObjectPropsHeader {
+		binary.LittleEndian.PutUint32(header[8:], uint32(len(msg.Recipients)))
+		binary.LittleEndian.PutUint32(header[12:], uint32(len(msg.Attachments)))
+		binary.LittleEndian.PutUint32(header[16:], uint32(len(msg.Recipients)))
+		binary.LittleEndian.PutUint32(header[20:], uint32(len(msg.Attachments)))
+	}
+	return props.writeWithHeader(st, header)
+}
+
+// msgProperty is a property waiting to be written
+type msgProperty struct {
+	id    uint16
+	typ   uint16
+	value interface{}
+}
+
+// propertyWriter collects the properties of one message, recipient or attachment object
+type propertyWriter struct {
+	props []msgProperty
+	err   error // The first value that could not be queued
+}
+
+// set queues a property, skipping zero strings, times and empty binaries since Outlook treats missing and empty alike
+func (p *propertyWriter) set(id uint16, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case []byte:
+		if len(v) == 0 {
+			return
+		}
+	case time.Time:
+		if v.IsZero() {
+			return
+		}
+	}
+	typ, ok := PropertyTypeOf(value)
+	if !ok {
+		if p.err == nil {
+			p.err = fmt.Errorf("property %04x: unsupported value type %T", id, value)
+		}
+		return
+	}
+	p.put(id, typ, value)
+}
+
+// put queues a property as is with its MAPI type, replacing an earlier value with the same id
+func (p *propertyWriter) put(id, typ uint16, value interface{}) {
+	for i := range p.props {
+		if p.props[i].id == id {
+			p.props[i] = msgProperty{id: id, typ: typ, value: value}
+			return
+		}
+	}
+	p.props = append(p.props, msgProperty{id: id, typ: typ, value: value})
+}
+
+// setAll queues the entries of a property bag that were not set from a field, translating named property ids.
+// Their types come from types, or else from their Go types.
+func (p *propertyWriter) setAll(properties map[int64]interface{}, types map[int64]uint16, named map[int64]NamedProperty, names *nameMap) {
+	ids := make([]int64, 0, len(properties))
+	for id := range properties {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		typ, ok := propertyType(types, id, properties[id])
+		if !ok {
+			if p.err == nil {
+				p.err = fmt.Errorf("property %04x: unsupported value type %T", id, properties[id])
+			}
+			continue
+		}
+		if id >= 0x8000 {
+			np, ok := named[id]
+			if !ok {
+				continue
+			}
+			p.put(names.id(np), typ, properties[id])
+		} else if !p.has(uint16(id)) {
+			p.put(uint16(id), typ, properties[id])
+		}
+	}
+}
+
+// has reports whether a property with the given id is already queued
+func (p *propertyWriter) has(id uint16) bool {
+	for _, prop := range p.props {
+		if prop.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// setObject queues a PT_OBJECT property whose content is a storage written separately
+func (p *propertyWriter) setObject(id uint16) {
+	p.props = append(p.props, msgProperty{id: id, typ: PropTypeObject})
+}
+
+func (p *propertyWriter) write(st *cfb.Storage, headerSize int) error {
+	return p.writeWithHeader(st, make([]byte, headerSize))
+}
+
+// writeWithHeader writes the __properties_version1.0 stream and one __substg1.0_ stream per variable length property
+func (p *propertyWriter) writeWithHeader(st *cfb.Storage, header []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	sort.Slice(p.props, func(i, j int) bool { return p.props[i].id < p.props[j].id })
+	stream := append([]byte{}, header...)
+	for _, prop := range p.props {
+		entry := make([]byte, 16)
+		tag := uint32(prop.id)<<16 | uint32(prop.typ)
+		binary.LittleEndian.PutUint32(entry[0:], tag)
+		binary.LittleEndian.PutUint32(entry[4:], propAttributes)
+		if fixed, ok := encodeFixed(prop.value); ok {
+			copy(entry[8:], fixed)
+			stream = append(stream, entry...)
+			continue
+		}
+		name := fmt.Sprintf("%s%08X", substgPrefix, tag)
+		switch v := prop.value.(type) {
+		case nil:
+			// PT_OBJECT, the storage is added by the caller
+			binary.LittleEndian.PutUint32(entry[8:], 0xFFFFFFFF)
+		case string:
+			var data []byte
+			switch prop.typ {
+			case PropTypeString8:
+				data = []byte(v)
+				binary.LittleEndian.PutUint32(entry[8:], uint32(len(data)+1))
+			case PropTypeCLSID:
+				guid, err := ParseGUID(v)
+				if err != nil {
+					return fmt.Errorf("property %04x: %v", prop.id, err)
+				}
+				data = guid[:]
+				binary.LittleEndian.PutUint32(entry[8:], uint32(len(data)))
+			default:
+				data = encodeUnicode(v)
+				binary.LittleEndian.PutUint32(entry[8:], uint32(len(data)+2))
+			}
+			st.AddStream(name, data)
+		case []byte:
+			binary.LittleEndian.PutUint32(entry[8:], uint32(len(v)))
+			st.AddStream(name, v)
+		case []string:
+			if prop.typ == PropTypeMultiple|PropTypeCLSID {
+				// Fixed length values, stored one after the other
+				var data []byte
+				for _, s := range v {
+					guid, err := ParseGUID(s)
+					if err != nil {
+						return fmt.Errorf("property %04x: %v", prop.id, err)
+					}
+					data = append(data, guid[:]...)
+				}
+				binary.LittleEndian.PutUint32(entry[8:], uint32(len(data)))
+				st.AddStream(name, data)
+				break
+			}
+			lengths := make([]byte, 4*len(v))
+			for i, s := range v {
+				data := append(encodeUnicode(s), 0, 0)
+				if prop.typ == PropTypeMultiple|PropTypeString8 {
+					data = append([]byte(s), 0)
+				}
+				binary.LittleEndian.PutUint32(lengths[i*4:], uint32(len(data)))
+				st.AddStream(fmt.Sprintf("%s-%08X", name, i), data)
+			}
+			binary.LittleEndian.PutUint32(entry[8:], uint32(len(lengths)))
+			st.AddStream(name, lengths)
+		case [][]byte:
+			lengths := make([]byte, 8*len(v))
+			for i, b := range v {
+				binary.LittleEndian.PutUint32(lengths[i*8:], uint32(len(b)))
+				st.AddStream(fmt.Sprintf("%s-%08X", name, i), b)
+			}
+			binary.LittleEndian.PutUint32(entry[8:], uint32(len(lengths)))
+			st.AddStream(name, lengths)
+		default:
+			data, err := encodeMultiFixed(v)
+			if err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint32(entry[8:], uint32(len(data)))
+			st.AddStream(name, data)
+		}
+		stream = append(stream, entry...)
+	}
+	st.AddStream(propertiesStream, stream)
+	return nil
+}
+
+// encodeFixed returns the 8 byte inline value of a fixed length property
+func encodeFixed(value interface{}) ([]byte, bool) {
+	b := make([]byte, 8)
+	switch v := value.(type) {
+	case int16:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case int32:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	case float32:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(v))
+	case float64:
+		binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	case bool:
+		if v {
+			b[0] = 1
+		}
+	case int64:
+		binary.LittleEndian.PutUint64(b, uint64(v))
+	case time.Time:
+		binary.LittleEndian.PutUint64(b, TimeToFiletime(v))
+	default:
+		return nil, false
+	}
+	return b, true
+}
+
+// encodeMultiFixed concatenates the values of a multi-valued fixed length property
+func encodeMultiFixed(value interface{}) ([]byte, error) {
+	var out []byte
+	switch v := value.(type) {
+	case []int16:
+		for _, x := range v {
+			out = binary.LittleEndian.AppendUint16(out, uint16(x))
+		}
+	case []int32:
+		for _, x := range v {
+			out = binary.LittleEndian.AppendUint32(out, uint32(x))
+		}
+	case []float32:
+		for _, x := range v {
+			out = binary.LittleEndian.AppendUint32(out, math.Float32bits(x))
+		}
+	case []float64:
+		for _, x := range v {
+			out = binary.LittleEndian.AppendUint64(out, math.Float64bits(x))
+		}
+	case []int64:
+		for _, x := range v {
+			out = binary.LittleEndian.AppendUint64(out, uint64(x))
+		}
+	case []time.Time:
+		for _, x := range v {
+			out = binary.LittleEndian.AppendUint64(out, TimeToFiletime(x))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported property value type %T", value)
+	}
+	return out, nil
+}
+
+// encodeUnicode encodes s as UTF-16LE without a terminating null
+func encodeUnicode(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+// nameMap assigns property ids to the named properties of a message tree and serializes the mapping
+type nameMap struct {
+	names []NamedProperty
+	ids   map[NamedProperty]uint16
+	guids []string
+}
+
+func newNameMap() *nameMap {
+	return &nameMap{ids: make(map[NamedProperty]uint16)}
+}
+
+// collect registers the named properties of msg and of its embedded messages, in property id order
+func (n *nameMap) collect(msg *Message) {
+	ids := make([]int64, 0, len(msg.NamedProperties))
+	for id := range msg.NamedProperties {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		n.id(msg.NamedProperties[id])
+	}
+	for _, att := range msg.Attachments {
+		if att.Embedded != nil {
+			n.collect(att.Embedded)
+		}
+	}
+}
+
+// id returns the property id assigned to np, assigning the next free one if needed
+func (n *nameMap) id(np NamedProperty) uint16 {
+	if id, ok := n.ids[np]; ok {
+		return id
+	}
+	id := uint16(0x8000 + len(n.names))
+	n.ids[np] = id
+	n.names = append(n.names, np)
+	if np.GUID != PSMAPI && np.GUID != PSPublicStrings && n.guidIndex(np.GUID) < 0 {
+		n.guids = append(n.guids, np.GUID)
+	}
+	return id
+}
+
+// guidIndex returns the position of guid in the GUID stream, or -1
+func (n *nameMap) guidIndex(guid string) int {
+	for i, g := range n.guids {
+		if g == guid {
+			return i
+		}
+	}
+	return -1
+}
+
+// write fills the __nameid_version1.0 storage: GUID, entry and string streams plus the name to id hash buckets
+func (n *nameMap) write(st *cfb.Storage) {
+	var guidStream, entryStream, stringStream []byte
+	for _, g := range n.guids {
+		raw, err := ParseGUID(g)
+		if err != nil {
+			raw = [16]byte{}
+		}
+		guidStream = append(guidStream, raw[:]...)
+	}
+	buckets := make(map[uint16][]byte)
+	for i, np := range n.names {
+		var guidIdx uint32
+		switch np.GUID {
+		case PSMAPI:
+			guidIdx = 1
+		case PSPublicStrings:
+			guidIdx = 2
+		default:
+			guidIdx = uint32(3 + n.guidIndex(np.GUID))
+		}
+		var key, kind uint32
+		var hashKey uint32
+		if np.Name != "" {
+			kind = 1
+			key = uint32(len(stringStream))
+			name := encodeUnicode(np.Name)
+			stringStream = binary.LittleEndian.AppendUint32(stringStream, uint32(len(name)))
+			stringStream = append(stringStream, name...)
+			for len(stringStream)%4 != 0 {
+				stringStream = append(stringStream, 0)
+			}
+			hashKey = crc32.ChecksumIEEE(name)
+		} else {
+			key = np.ID
+			hashKey = np.ID
+		}
+		indexKind := uint32(i)<<16 | guidIdx<<1 | kind
+		entryStream = binary.LittleEndian.AppendUint32(entryStream, key)
+		entryStream = binary.LittleEndian.AppendUint32(entryStream, indexKind)
+
+		bucket := uint16(0x1000 + (hashKey^(guidIdx<<1|kind))%0x1F)
+		buckets[bucket] = binary.LittleEndian.AppendUint32(buckets[bucket], hashKey)
+		buckets[bucket] = binary.LittleEndian.AppendUint32(buckets[bucket], indexKind)
+	}
+	st.AddStream(substgPrefix+"00020102", guidStream)
+	st.AddStream(substgPrefix+"00030102", entryStream)
+	st.AddStream(substgPrefix+"00040102", stringStream)
+	keys := make([]int, 0, len(buckets))
+	for k := range buckets {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		st.AddStream(fmt.Sprintf("%s%04X0102", substgPrefix, k), buckets[uint16(k)])
+	}
+}
+
+// convertedFromRTF reports whether the HTML body of msg is still the one encapsulated in its RTF body, which is
+// then kept in Properties instead of writing PR_HTML
+func convertedFromRTF(msg *Message) bool {
+	return msg.BodySource == BodySourceRTF && msg.ConvertedBodyHTML != "" && msg.BodyHTML == msg.ConvertedBodyHTML
+}
+
+// nativeBody returns the PR_NATIVE_BODY_INFO that makes the bodies written take precedence over the RTF body
+// kept in Properties, or 0 when the properties of msg already select them
+func nativeBody(msg *Message) int32 {
+	_, native := msg.Properties[0x1016]
+	inSync, _ := msg.Properties[0x0E1F].(bool)
+	switch {
+	case convertedFromRTF(msg) || !native && !inSync:
+		return 0
+	case msg.BodyHTML != "":
+		return nativeBodyHTML
+	case msg.BodyPlainText != "":
+		return nativeBodyPlainText
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package models
+
+// Named properties of PSETID_Note (MS-OXONOTE)
+const (
+	lidNoteColor  = 0x8B00 // PidLidNoteColor
+	lidNoteWidth  = 0x8B02 // PidLidNoteWidth
+	lidNoteHeight = 0x8B03 // PidLidNoteHeight
+	lidNoteX      = 0x8B04 // PidLidNoteX
+	lidNoteY      = 0x8B05 // PidLidNoteY
+)
+
+// NoteColor is the PidLidNoteColor of a sticky note
+type NoteColor int32
+
+// Note colors
+const (
+	NoteBlue   NoteColor = 0
+	NoteGreen  NoteColor = 1
+	NotePink   NoteColor = 2
+	NoteYellow NoteColor = 3
+	NoteWhite  NoteColor = 4
+)
+
+// String returns the name of the color
+func (c NoteColor) String() string {
+	switch c {
+	case NoteBlue:
+		return "blue"
+	case NoteGreen:
+		return "green"
+	case NotePink:
+		return "pink"
+	case NoteYellow:
+		return "yellow"
+	case NoteWhite:
+		return "white"
+	}
+	return "unknown"
+}
+
+// StickyNote is a view of a note (IPM.StickyNote) built from its PSETID_Note named properties
+type StickyNote struct {
+	Message *Message // The underlying message
+
+	Color  NoteColor // PidLidNoteColor
+	Width  int32     // PidLidNoteWidth, in pixels
+	Height int32     // PidLidNoteHeight, in pixels
+	X      int32     // PidLidNoteX, distance of the note window from the left of the screen in pixels
+	Y      int32     // PidLidNoteY, distance of the note window from the top of the screen in pixels
+	Body   string    // The text of the note, which Outlook keeps in PR_BODY and whose first line is the subject
+}
+
+// StickyNote returns the note view of the message, or false when its class is not IPM.StickyNote
+func (res *Message) StickyNote() (*StickyNote, bool) {
+	if !hasClass(res.MessageClass, "IPM.StickyNote") {
+		return nil, false
+	}
+	note := func(lid uint32) interface{} {
+		v, _ := res.NamedValue(PSETIDNote, lid)
+		return v
+	}
+	n := &StickyNote{
+		Message: res,
+		Color:   NoteColor(asInt32(note(lidNoteColor))),
+		Width:   asInt32(note(lidNoteWidth)),
+		Height:  asInt32(note(lidNoteHeight)),
+		X:       asInt32(note(lidNoteX)),
+		Y:       asInt32(note(lidNoteY)),
+		Body:    res.BodyPlainText,
+	}
+	if n.Body == "" {
+		n.Body = res.Subject
+	}
+	return n, true
+}
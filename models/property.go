@@ -1,8 +1,280 @@
 package models
 
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
 // MessageEntryProperty holds information about a property of a message entry in the msg file
 type MessageEntryProperty struct {
 	Class string
 	Mapi  int64
 	Data  interface{}
 }
+
+// MAPI property types (PT_*) as stored in the low word of a property tag
+const (
+	PropTypeI2       = 0x0002 // PT_I2
+	PropTypeLong     = 0x0003 // PT_LONG
+	PropTypeR4       = 0x0004 // PT_R4
+	PropTypeDouble   = 0x0005 // PT_DOUBLE
+	PropTypeCurrency = 0x0006 // PT_CURRENCY
+	PropTypeAppTime  = 0x0007 // PT_APPTIME
+	PropTypeError    = 0x000A // PT_ERROR
+	PropTypeBoolean  = 0x000B // PT_BOOLEAN
+	PropTypeObject   = 0x000D // PT_OBJECT
+	PropTypeI8       = 0x0014 // PT_I8
+	PropTypeString8  = 0x001E // PT_STRING8
+	PropTypeUnicode  = 0x001F // PT_UNICODE
+	PropTypeSysTime  = 0x0040 // PT_SYSTIME
+	PropTypeCLSID    = 0x0048 // PT_CLSID
+	PropTypeSvrEID   = 0x00FB // PT_SVREID
+	PropTypeBinary   = 0x0102 // PT_BINARY
+	PropTypeMultiple = 0x1000 // MV_FLAG, combined with one of the above
+)
+
+// Well-known property set GUIDs used by named properties
+const (
+	PSMAPI            = "00020328-0000-0000-c000-000000000046" // PS_MAPI
+	PSPublicStrings   = "00020329-0000-0000-c000-000000000046" // PS_PUBLIC_STRINGS
+	PSInternetHeaders = "00020386-0000-0000-c000-000000000046" // PS_INTERNET_HEADERS
+	PSETIDAppointment = "00062002-0000-0000-c000-000000000046" // PSETID_Appointment
+	PSETIDTask        = "00062003-0000-0000-c000-000000000046" // PSETID_Task
+	PSETIDAddress     = "00062004-0000-0000-c000-000000000046" // PSETID_Address
+	PSETIDCommon      = "00062008-0000-0000-c000-000000000046" // PSETID_Common
+	PSETIDLog         = "0006200a-0000-0000-c000-000000000046" // PSETID_Log
+	PSETIDNote        = "0006200e-0000-0000-c000-000000000046" // PSETID_Note
+	PSETIDMeeting     = "6ed8da90-450b-101b-98da-00aa003f1305" // PSETID_Meeting
+)
+
+// NamedProperty identifies a named property (ids 0x8000 and above) by its property set and either a numeric id or a string name
+type NamedProperty struct {
+	GUID string // Property set, formatted like PT_CLSID values
+	ID   uint32 // Numeric name (LID), used when Name is empty
+	Name string // String name
+}
+
+// PropertyTypeOf returns the MAPI property type used to store a Go value produced by the parser
+func PropertyTypeOf(v interface{}) (uint16, bool) {
+	switch v.(type) {
+	case int16:
+		return PropTypeI2, true
+	case int32:
+		return PropTypeLong, true
+	case float32:
+		return PropTypeR4, true
+	case float64:
+		return PropTypeDouble, true
+	case bool:
+		return PropTypeBoolean, true
+	case int64:
+		return PropTypeI8, true
+	case string:
+		return PropTypeUnicode, true
+	case time.Time:
+		return PropTypeSysTime, true
+	case []byte:
+		return PropTypeBinary, true
+	case []int16:
+		return PropTypeMultiple | PropTypeI2, true
+	case []int32:
+		return PropTypeMultiple | PropTypeLong, true
+	case []float32:
+		return PropTypeMultiple | PropTypeR4, true
+	case []float64:
+		return PropTypeMultiple | PropTypeDouble, true
+	case []int64:
+		return PropTypeMultiple | PropTypeI8, true
+	case []string:
+		return PropTypeMultiple | PropTypeUnicode, true
+	case []time.Time:
+		return PropTypeMultiple | PropTypeSysTime, true
+	case [][]byte:
+		return PropTypeMultiple | PropTypeBinary, true
+	}
+	return 0, false
+}
+
+// recordPropertyType keeps in types the MAPI type a value of a property bag was read with, when PropertyTypeOf
+// would not derive it from the Go type of the value, such as PT_STRING8, PT_CURRENCY or PT_CLSID
+func recordPropertyType(types *map[int64]uint16, id, mapi int64, value interface{}) {
+	if typ, ok := PropertyTypeOf(value); mapi <= 0 || mapi > 0xFFFF || ok && typ == uint16(mapi) {
+		return
+	}
+	if *types == nil {
+		*types = make(map[int64]uint16)
+	}
+	(*types)[id] = uint16(mapi)
+}
+
+// propertyType returns the MAPI type of a value of a property bag: the one recorded in types, or else the one of
+// its Go type
+func propertyType(types map[int64]uint16, id int64, value interface{}) (uint16, bool) {
+	if typ, ok := types[id]; ok {
+		return typ, true
+	}
+	return PropertyTypeOf(value)
+}
+
+// FiletimeToTime converts a Windows FILETIME (100-nanosecond intervals since January 1, 1601) to a time.Time
+func FiletimeToTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	// Seconds and remainder, as nanoseconds since 1970 overflow int64 after 2262
+	return time.Unix(int64(ft/1e7)-11644473600, int64(ft%1e7)*100)
+}
+
+// TimeToFiletime converts a time.Time to a Windows FILETIME
+func TimeToFiletime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix()+11644473600)*1e7 + uint64(t.Nanosecond()/100)
+}
+
+// FormatGUID formats a 16 byte little-endian GUID the same way PT_CLSID values are formatted
+func FormatGUID(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8]), binary.BigEndian.Uint16(b[8:10]), b[10:16])
+}
+
+// ParseGUID converts a GUID string produced by FormatGUID back to its 16 byte little-endian form
+func ParseGUID(s string) ([16]byte, error) {
+	var res [16]byte
+	raw, err := hex.DecodeString(strings.ReplaceAll(strings.Trim(s, "{}"), "-", ""))
+	if err != nil || len(raw) != 16 {
+		return res, fmt.Errorf("invalid GUID %q", s)
+	}
+	binary.LittleEndian.PutUint32(res[0:4], binary.BigEndian.Uint32(raw[0:4]))
+	binary.LittleEndian.PutUint16(res[4:6], binary.BigEndian.Uint16(raw[4:6]))
+	binary.LittleEndian.PutUint16(res[6:8], binary.BigEndian.Uint16(raw[6:8]))
+	copy(res[8:], raw[8:])
+	return res, nil
+}
+
+// DecodeCodepage converts text stored in a Windows code page (as found in PR_INTERNET_CPID or PR_MESSAGE_CODEPAGE) to UTF-8.
+// A zero code page means unknown: valid UTF-8 is kept as is and anything else is read as Windows-1252.
+func DecodeCodepage(data []byte, codepage int32) string {
+	var label string
+	switch {
+	case codepage == 65001:
+		return string(data)
+	case codepage == 0:
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		label = "windows-1252"
+	case codepage == 1200:
+		label = "utf-16le"
+	case codepage >= 1250 && codepage <= 1258:
+		label = fmt.Sprintf("windows-%d", codepage)
+	case codepage >= 28591 && codepage <= 28605:
+		label = fmt.Sprintf("iso-8859-%d", codepage-28590)
+	case codepage == 874:
+		label = "windows-874"
+	case codepage == 932:
+		label = "shift_jis"
+	case codepage == 936:
+		label = "gbk"
+	case codepage == 949:
+		label = "euc-kr"
+	case codepage == 950:
+		label = "big5"
+	case codepage == 20866:
+		label = "koi8-r"
+	case codepage == 21866:
+		label = "koi8-u"
+	case codepage == 50220, codepage == 50221, codepage == 50222:
+		label = "iso-2022-jp"
+	case codepage == 51932:
+		label = "euc-jp"
+	case codepage == 54936:
+		label = "gb18030"
+	default:
+		return string(data)
+	}
+	enc, _ := charset.Lookup(label)
+	if enc == nil {
+		enc = charmap.Windows1252
+	}
+	decoded, err := ioutil.ReadAll(transform.NewReader(bytes.NewReader(data), enc.NewDecoder()))
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+// NamedValue returns the value of the named property with the given property set and LID
+func (res *Message) NamedValue(guid string, lid uint32) (interface{}, bool) {
+	return res.namedIn(res.Properties, NamedProperty{GUID: guid, ID: lid})
+}
+
+// NamedValueByName returns the value of the named property with the given property set and string name
+func (res *Message) NamedValueByName(guid, name string) (interface{}, bool) {
+	return res.namedIn(res.Properties, NamedProperty{GUID: guid, Name: name})
+}
+
+// namedIn looks a named property up in a property bag of the message, its recipients or attachments
+func (res *Message) namedIn(properties map[int64]interface{}, np NamedProperty) (interface{}, bool) {
+	np.GUID = strings.ToLower(np.GUID)
+	for id, candidate := range res.NamedProperties {
+		if candidate == np {
+			v, ok := properties[id]
+			return v, ok
+		}
+	}
+	return nil, false
+}
+
+// asString returns a string property value, or "" when it is missing or of another type
+func asString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// asText returns a string property value, also accepting text stored as PT_BINARY
+func asText(v interface{}) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return asString(v)
+}
+
+// asTime returns a PT_SYSTIME property value, or the zero time
+func asTime(v interface{}) time.Time {
+	t, _ := v.(time.Time)
+	return t
+}
+
+// asInt32 returns a PT_LONG property value, also accepting PT_I2
+func asInt32(v interface{}) int32 {
+	switch n := v.(type) {
+	case int32:
+		return n
+	case int16:
+		return int32(n)
+	}
+	return 0
+}
+
+// asBool returns a PT_BOOLEAN property value
+func asBool(v interface{}) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// asBytes returns a PT_BINARY property value
+func asBytes(v interface{}) []byte {
+	b, _ := v.([]byte)
+	return b
+}
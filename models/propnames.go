@@ -0,0 +1,340 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// propertyNames maps property ids below 0x8000 to their canonical MS-OXPROPS names
+var propertyNames = map[uint16]string{
+	0x0001: "PidTagTemplateData",
+	0x0002: "PidTagAlternateRecipientAllowed",
+	0x0004: "PidTagScriptData",
+	0x0005: "PidTagAutoForwarded",
+	0x000F: "PidTagDeferredDeliveryTime",
+	0x0010: "PidTagDeliverTime",
+	0x0015: "PidTagExpiryTime",
+	0x0017: "PidTagImportance",
+	0x001A: "PidTagMessageClass",
+	0x0023: "PidTagOriginatorDeliveryReportRequested",
+	0x0025: "PidTagParentKey",
+	0x0026: "PidTagPriority",
+	0x0029: "PidTagReadReceiptRequested",
+	0x002A: "PidTagReceiptTime",
+	0x002B: "PidTagRecipientReassignmentProhibited",
+	0x002E: "PidTagOriginalSensitivity",
+	0x0030: "PidTagReplyTime",
+	0x0031: "PidTagReportTag",
+	0x0032: "PidTagReportTime",
+	0x0036: "PidTagSensitivity",
+	0x0037: "PidTagSubject",
+	0x0039: "PidTagClientSubmitTime",
+	0x003B: "PidTagSentRepresentingSearchKey",
+	0x003D: "PidTagSubjectPrefix",
+	0x003F: "PidTagReceivedByEntryId",
+	0x0040: "PidTagReceivedByName",
+	0x0041: "PidTagSentRepresentingEntryId",
+	0x0042: "PidTagSentRepresentingName",
+	0x0043: "PidTagReceivedRepresentingEntryId",
+	0x0044: "PidTagReceivedRepresentingName",
+	0x0045: "PidTagReportEntryId",
+	0x0046: "PidTagReadReceiptEntryId",
+	0x0047: "PidTagMessageSubmissionId",
+	0x0049: "PidTagOriginalSubject",
+	0x004B: "PidTagOriginalMessageClass",
+	0x004E: "PidTagOriginalSubmitTime",
+	0x004F: "PidTagReplyRecipientEntries",
+	0x0050: "PidTagReplyRecipientNames",
+	0x0051: "PidTagReceivedBySearchKey",
+	0x0052: "PidTagReceivedRepresentingSearchKey",
+	0x0053: "PidTagReadReceiptSearchKey",
+	0x0054: "PidTagReportSearchKey",
+	0x0055: "PidTagOriginalDeliveryTime",
+	0x0057: "PidTagMessageToMe",
+	0x0058: "PidTagMessageCcMe",
+	0x0059: "PidTagMessageRecipientMe",
+	0x005A: "PidTagOriginalSenderName",
+	0x005B: "PidTagOriginalSenderEntryId",
+	0x005C: "PidTagOriginalSenderSearchKey",
+	0x005D: "PidTagOriginalSentRepresentingName",
+	0x005E: "PidTagOriginalSentRepresentingEntryId",
+	0x005F: "PidTagOriginalSentRepresentingSearchKey",
+	0x0060: "PidTagStartDate",
+	0x0061: "PidTagEndDate",
+	0x0062: "PidTagOwnerAppointmentId",
+	0x0063: "PidTagResponseRequested",
+	0x0064: "PidTagSentRepresentingAddressType",
+	0x0065: "PidTagSentRepresentingEmailAddress",
+	0x0066: "PidTagOriginalSenderAddressType",
+	0x0067: "PidTagOriginalSenderEmailAddress",
+	0x0068: "PidTagOriginalSentRepresentingAddressType",
+	0x0069: "PidTagOriginalSentRepresentingEmailAddress",
+	0x0070: "PidTagConversationTopic",
+	0x0071: "PidTagConversationIndex",
+	0x0072: "PidTagOriginalDisplayBcc",
+	0x0073: "PidTagOriginalDisplayCc",
+	0x0074: "PidTagOriginalDisplayTo",
+	0x0075: "PidTagReceivedByAddressType",
+	0x0076: "PidTagReceivedByEmailAddress",
+	0x0077: "PidTagReceivedRepresentingAddressType",
+	0x0078: "PidTagReceivedRepresentingEmailAddress",
+	0x007D: "PidTagTransportMessageHeaders",
+	0x007F: "PidTagTnefCorrelationKey",
+	0x0080: "PidTagReportDisposition",
+	0x0081: "PidTagReportDispositionMode",
+	0x0C04: "PidTagNonDeliveryReportReasonCode",
+	0x0C05: "PidTagNonDeliveryReportDiagCode",
+	0x0C06: "PidTagNonReceiptNotificationRequested",
+	0x0C08: "PidTagOriginatorNonDeliveryReportRequested",
+	0x0C15: "PidTagRecipientType",
+	0x0C17: "PidTagReplyRequested",
+	0x0C19: "PidTagSenderEntryId",
+	0x0C1A: "PidTagSenderName",
+	0x0C1B: "PidTagSupplementaryInfo",
+	0x0C1D: "PidTagSenderSearchKey",
+	0x0C1E: "PidTagSenderAddressType",
+	0x0C1F: "PidTagSenderEmailAddress",
+	0x0C20: "PidTagNonDeliveryReportStatusCode",
+	0x0C21: "PidTagRemoteMessageTransferAgent",
+	0x0E01: "PidTagDeleteAfterSubmit",
+	0x0E02: "PidTagDisplayBcc",
+	0x0E03: "PidTagDisplayCc",
+	0x0E04: "PidTagDisplayTo",
+	0x0E06: "PidTagMessageDeliveryTime",
+	0x0E07: "PidTagMessageFlags",
+	0x0E08: "PidTagMessageSize",
+	0x0E0F: "PidTagResponsibility",
+	0x0E12: "PidTagMessageRecipients",
+	0x0E13: "PidTagMessageAttachments",
+	0x0E17: "PidTagMessageStatus",
+	0x0E1B: "PidTagHasAttachments",
+	0x0E1D: "PidTagNormalizedSubject",
+	0x0E1F: "PidTagRtfInSync",
+	0x0E20: "PidTagAttachSize",
+	0x0E21: "PidTagAttachNumber",
+	0x0E28: "PidTagPrimarySendAccount",
+	0x0E29: "PidTagNextSendAcct",
+	0x0E2B: "PidTagToDoItemFlags",
+	0x0E79: "PidTagTrustSender",
+	0x0FF4: "PidTagAccess",
+	0x0FF6: "PidTagInstanceKey",
+	0x0FF7: "PidTagAccessLevel",
+	0x0FF8: "PidTagMappingSignature",
+	0x0FF9: "PidTagRecordKey",
+	0x0FFB: "PidTagStoreEntryId",
+	0x0FFE: "PidTagObjectType",
+	0x0FFF: "PidTagEntryId",
+	0x1000: "PidTagBody",
+	0x1001: "PidTagReportText",
+	0x1006: "PidTagRtfSyncBodyCrc",
+	0x1007: "PidTagRtfSyncBodyCount",
+	0x1008: "PidTagRtfSyncBodyTag",
+	0x1009: "PidTagRtfCompressed",
+	0x1010: "PidTagRtfSyncPrefixCount",
+	0x1011: "PidTagRtfSyncTrailingCount",
+	0x1013: "PidTagHtml",
+	0x1014: "PidTagBodyContentLocation",
+	0x1015: "PidTagBodyContentId",
+	0x1016: "PidTagNativeBody",
+	0x1035: "PidTagInternetMessageId",
+	0x1039: "PidTagInternetReferences",
+	0x1042: "PidTagInReplyToId",
+	0x1043: "PidTagListHelp",
+	0x1044: "PidTagListSubscribe",
+	0x1045: "PidTagListUnsubscribe",
+	0x1046: "PidTagOriginalMessageId",
+	0x1080: "PidTagIconIndex",
+	0x1081: "PidTagLastVerbExecuted",
+	0x1082: "PidTagLastVerbExecutionTime",
+	0x1090: "PidTagFlagStatus",
+	0x1091: "PidTagFlagCompleteTime",
+	0x10C3: "PidTagICalendarStartTime",
+	0x10C4: "PidTagICalendarEndTime",
+	0x10F4: "PidTagAttributeHidden",
+	0x10F6: "PidTagAttributeReadOnly",
+	0x3000: "PidTagRowid",
+	0x3001: "PidTagDisplayName",
+	0x3002: "PidTagAddressType",
+	0x3003: "PidTagEmailAddress",
+	0x3004: "PidTagComment",
+	0x3007: "PidTagCreationTime",
+	0x3008: "PidTagLastModificationTime",
+	0x300B: "PidTagSearchKey",
+	0x3010: "PidTagTargetEntryId",
+	0x3013: "PidTagConversationId",
+	0x3016: "PidTagConversationIndexTracking",
+	0x340D: "PidTagStoreSupportMask",
+	0x3613: "PidTagContainerClass",
+	0x3701: "PidTagAttachDataBinary",
+	0x3702: "PidTagAttachEncoding",
+	0x3703: "PidTagAttachExtension",
+	0x3704: "PidTagAttachFilename",
+	0x3705: "PidTagAttachMethod",
+	0x3707: "PidTagAttachLongFilename",
+	0x3708: "PidTagAttachPathname",
+	0x3709: "PidTagAttachRendering",
+	0x370A: "PidTagAttachTag",
+	0x370B: "PidTagRenderingPosition",
+	0x370C: "PidTagAttachTransportName",
+	0x370D: "PidTagAttachLongPathname",
+	0x370E: "PidTagAttachMimeTag",
+	0x370F: "PidTagAttachAdditionalInformation",
+	0x3711: "PidTagAttachContentBase",
+	0x3712: "PidTagAttachContentId",
+	0x3713: "PidTagAttachContentLocation",
+	0x3714: "PidTagAttachFlags",
+	0x3719: "PidTagAttachPayloadProviderGuidString",
+	0x371A: "PidTagAttachPayloadClass",
+	0x371D: "PidTagTextAttachmentCharset",
+	0x3900: "PidTagDisplayType",
+	0x3902: "PidTagTemplateid",
+	0x3905: "PidTagDisplayTypeEx",
+	0x39FE: "PidTagSmtpAddress",
+	0x39FF: "PidTag7BitDisplayName",
+	0x3A00: "PidTagAccount",
+	0x3A02: "PidTagCallbackTelephoneNumber",
+	0x3A05: "PidTagGeneration",
+	0x3A06: "PidTagGivenName",
+	0x3A08: "PidTagBusinessTelephoneNumber",
+	0x3A09: "PidTagHomeTelephoneNumber",
+	0x3A0A: "PidTagInitials",
+	0x3A11: "PidTagSurname",
+	0x3A16: "PidTagCompanyName",
+	0x3A17: "PidTagTitle",
+	0x3A18: "PidTagDepartmentName",
+	0x3A19: "PidTagOfficeLocation",
+	0x3A1A: "PidTagPrimaryTelephoneNumber",
+	0x3A1B: "PidTagBusiness2TelephoneNumber",
+	0x3A1C: "PidTagMobileTelephoneNumber",
+	0x3A1D: "PidTagRadioTelephoneNumber",
+	0x3A1E: "PidTagCarTelephoneNumber",
+	0x3A1F: "PidTagOtherTelephoneNumber",
+	0x3A20: "PidTagTransmittableDisplayName",
+	0x3A21: "PidTagPagerTelephoneNumber",
+	0x3A23: "PidTagPrimaryFaxNumber",
+	0x3A24: "PidTagBusinessFaxNumber",
+	0x3A25: "PidTagHomeFaxNumber",
+	0x3A26: "PidTagCountry",
+	0x3A27: "PidTagLocality",
+	0x3A28: "PidTagStateOrProvince",
+	0x3A29: "PidTagStreetAddress",
+	0x3A2A: "PidTagPostalCode",
+	0x3A2B: "PidTagPostOfficeBox",
+	0x3A2D: "PidTagIsdnNumber",
+	0x3A2E: "PidTagAssistantTelephoneNumber",
+	0x3A2F: "PidTagHome2TelephoneNumber",
+	0x3A40: "PidTagSendRichInfo",
+	0x3A41: "PidTagWeddingAnniversary",
+	0x3A42: "PidTagBirthday",
+	0x3A44: "PidTagMiddleName",
+	0x3A45: "PidTagDisplayNamePrefix",
+	0x3A4B: "PidTagTtyTddPhoneNumber",
+	0x3A4E: "PidTagManagerName",
+	0x3A4F: "PidTagNickname",
+	0x3A50: "PidTagPersonalHomePage",
+	0x3A51: "PidTagBusinessHomePage",
+	0x3A57: "PidTagCompanyMainTelephoneNumber",
+	0x3A59: "PidTagHomeAddressCity",
+	0x3A5A: "PidTagHomeAddressCountry",
+	0x3A5B: "PidTagHomeAddressPostalCode",
+	0x3A5C: "PidTagHomeAddressStateOrProvince",
+	0x3A5D: "PidTagHomeAddressStreet",
+	0x3A5E: "PidTagHomeAddressPostOfficeBox",
+	0x3A5F: "PidTagOtherAddressCity",
+	0x3A60: "PidTagOtherAddressCountry",
+	0x3A61: "PidTagOtherAddressPostalCode",
+	0x3A62: "PidTagOtherAddressStateOrProvince",
+	0x3A63: "PidTagOtherAddressStreet",
+	0x3A64: "PidTagOtherAddressPostOfficeBox",
+	0x3A71: "PidTagSendInternetEncoding",
+	0x3FDE: "PidTagInternetCodepage",
+	0x3FDF: "PidTagAutoResponseSuppress",
+	0x3FE3: "PidTagDelegatedByRule",
+	0x3FF1: "PidTagMessageLocaleId",
+	0x3FF8: "PidTagCreatorName",
+	0x3FF9: "PidTagCreatorEntryId",
+	0x3FFA: "PidTagLastModifierName",
+	0x3FFB: "PidTagLastModifierEntryId",
+	0x3FFD: "PidTagMessageCodepage",
+	0x4019: "PidTagSenderFlags",
+	0x401A: "PidTagSentRepresentingFlags",
+	0x4029: "PidTagReadReceiptAddressType",
+	0x402A: "PidTagReadReceiptEmailAddress",
+	0x402B: "PidTagReadReceiptName",
+	0x4030: "PidTagSenderSimpleDisplayName",
+	0x4031: "PidTagSentRepresentingSimpleDisplayName",
+	0x5902: "PidTagInternetMailOverrideFormat",
+	0x5909: "PidTagMessageEditorFormat",
+	0x5D01: "PidTagSenderSmtpAddress",
+	0x5D02: "PidTagSentRepresentingSmtpAddress",
+	0x5D07: "PidTagReceivedBySmtpAddress",
+	0x5FDF: "PidTagRecipientOrder",
+	0x5FE5: "PidTagRecipientSipUri",
+	0x5FF6: "PidTagRecipientDisplayName",
+	0x5FF7: "PidTagRecipientEntryId",
+	0x5FFB: "PidTagRecipientTrackStatusTime",
+	0x5FFD: "PidTagRecipientFlags",
+	0x5FFF: "PidTagRecipientTrackStatus",
+	0x6619: "PidTagUserEntryId",
+	0x6740: "PidTagSentMailSvrEID",
+	0x7D01: "PidTagProcessed",
+	0x7FF9: "PidTagExceptionReplaceTime",
+	0x7FFA: "PidTagAttachmentLinkId",
+	0x7FFB: "PidTagExceptionStartTime",
+	0x7FFC: "PidTagExceptionEndTime",
+	0x7FFD: "PidTagAttachmentFlags",
+	0x7FFE: "PidTagAttachmentHidden",
+	0x7FFF: "PidTagAttachmentContactPhoto",
+}
+
+// propertyTypeNames maps the MAPI property types to their PT_* names
+var propertyTypeNames = map[uint16]string{
+	PropTypeI2:       "PT_I2",
+	PropTypeLong:     "PT_LONG",
+	PropTypeR4:       "PT_R4",
+	PropTypeDouble:   "PT_DOUBLE",
+	PropTypeCurrency: "PT_CURRENCY",
+	PropTypeAppTime:  "PT_APPTIME",
+	PropTypeError:    "PT_ERROR",
+	PropTypeBoolean:  "PT_BOOLEAN",
+	PropTypeObject:   "PT_OBJECT",
+	PropTypeI8:       "PT_I8",
+	PropTypeString8:  "PT_STRING8",
+	PropTypeUnicode:  "PT_UNICODE",
+	PropTypeSysTime:  "PT_SYSTIME",
+	PropTypeCLSID:    "PT_CLSID",
+	PropTypeSvrEID:   "PT_SVREID",
+	PropTypeBinary:   "PT_BINARY",
+}
+
+// PropertyName returns the canonical name of a property id below 0x8000, or an empty string if it is not known
+func PropertyName(id uint16) string {
+	return propertyNames[id]
+}
+
+// PropertyTypeName returns the PT_* name of a property type, with an MV_ prefix for multi-valued types
+func PropertyTypeName(typ uint16) string {
+	name, ok := propertyTypeNames[typ&^PropTypeMultiple]
+	if !ok {
+		name = fmt.Sprintf("0x%04X", typ&^PropTypeMultiple)
+	}
+	if typ&PropTypeMultiple != 0 {
+		return "PT_MV_" + strings.TrimPrefix(name, "PT_")
+	}
+	return name
+}
+
+// FormatPropertyTag formats a property id and type as a hex property tag such as 0x0037001F
+func FormatPropertyTag(id, typ uint16) string {
+	return fmt.Sprintf("0x%04X%04X", id, typ)
+}
+
+// ParsePropertyTag splits a hex property tag produced by FormatPropertyTag into its id and type
+func ParsePropertyTag(tag string) (uint16, uint16, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(tag, "0x"), "0X"), 16, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid property tag %q", tag)
+	}
+	return uint16(v >> 16), uint16(v), nil
+}
@@ -0,0 +1,407 @@
+package models
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// RecurFrequency is the RecurFrequency field of a recurrence pattern
+type RecurFrequency uint16
+
+// Recurrence frequencies
+const (
+	RecurDaily   RecurFrequency = 0x200A
+	RecurWeekly  RecurFrequency = 0x200B
+	RecurMonthly RecurFrequency = 0x200C
+	RecurYearly  RecurFrequency = 0x200D
+)
+
+// RecurPatternType is the PatternType field of a recurrence pattern
+type RecurPatternType uint16
+
+// Recurrence pattern types
+const (
+	PatternDay        RecurPatternType = 0x0000
+	PatternWeek       RecurPatternType = 0x0001
+	PatternMonth      RecurPatternType = 0x0002
+	PatternMonthNth   RecurPatternType = 0x0003
+	PatternMonthEnd   RecurPatternType = 0x0004
+	PatternHjMonth    RecurPatternType = 0x000A
+	PatternHjMonthNth RecurPatternType = 0x000B
+	PatternHjMonthEnd RecurPatternType = 0x000C
+)
+
+// RecurEndType is the EndType field of a recurrence pattern
+type RecurEndType uint32
+
+// Recurrence end types
+const (
+	EndAfterDate        RecurEndType = 0x2021
+	EndAfterOccurrences RecurEndType = 0x2022
+	EndNever            RecurEndType = 0x2023
+)
+
+// Override flags of an exception (ARO_*)
+const (
+	overrideSubject       = 0x0001
+	overrideMeetingType   = 0x0002
+	overrideReminderDelta = 0x0004
+	overrideReminder      = 0x0008
+	overrideLocation      = 0x0010
+	overrideBusyStatus    = 0x0020
+	overrideAttachment    = 0x0040
+	overrideSubType       = 0x0080
+	overrideColor         = 0x0100
+)
+
+// ErrUnsupportedRecurrence is returned by RRule for patterns iCalendar cannot express, such as Hijri calendar recurrences
+var ErrUnsupportedRecurrence = errors.New("unsupported recurrence pattern")
+
+// RecurrencePattern is a decoded RecurrencePattern or AppointmentRecurrencePattern structure (MS-OXOCAL 2.2.1.44).
+// Times are wall clock times in the time zone of the series, returned with the UTC location; see InLocation.
+type RecurrencePattern struct {
+	Frequency       RecurFrequency
+	PatternType     RecurPatternType
+	CalendarType    uint16
+	FirstDateTime   uint32
+	Period          uint32 // Minutes for daily patterns, weeks for weekly and months for monthly and yearly ones
+	SlidingFlag     uint32
+	DaysOfWeek      uint32 // Bit mask, 0x01 for Sunday to 0x40 for Saturday
+	DayOfMonth      uint32 // Month patterns
+	WeekOfMonth     uint32 // MonthNth patterns, 1 to 4, or 5 for the last week
+	EndType         RecurEndType
+	OccurrenceCount uint32
+	FirstDayOfWeek  uint32      // 0 for Sunday
+	DeletedDates    []time.Time // Original dates of the deleted and the modified instances
+	ModifiedDates   []time.Time // Dates the modified instances were moved to
+	StartDate       time.Time   // Date of the first instance
+	EndDate         time.Time   // Date of the last instance, far in the future for series without end
+
+	// Set for appointment recurrences only
+	StartTimeOffset time.Duration // Start of each instance after midnight
+	EndTimeOffset   time.Duration // End of each instance after midnight of its start date
+	Exceptions      []RecurrenceException
+}
+
+// RecurrenceException is a modified instance of a series. Fields other than the times are nil unless the instance overrides them.
+type RecurrenceException struct {
+	Start         time.Time
+	End           time.Time
+	OriginalStart time.Time
+	Subject       *string
+	Location      *string
+	MeetingType   *int32
+	ReminderDelta *int32
+	ReminderSet   *bool
+	BusyStatus    *BusyStatus
+	HasAttachment *bool
+	AllDay        *bool
+	Color         *int32
+}
+
+// ParseRecurrencePattern decodes a RecurrencePattern, including the appointment specific part and exceptions of an AppointmentRecurrencePattern when present
+func ParseRecurrencePattern(data []byte) (*RecurrencePattern, error) {
+	r := &blobReader{data: data}
+	res := &RecurrencePattern{}
+	r.uint16() // ReaderVersion
+	r.uint16() // WriterVersion
+	res.Frequency = RecurFrequency(r.uint16())
+	res.PatternType = RecurPatternType(r.uint16())
+	res.CalendarType = r.uint16()
+	res.FirstDateTime = r.uint32()
+	res.Period = r.uint32()
+	res.SlidingFlag = r.uint32()
+	switch res.PatternType {
+	case PatternWeek:
+		res.DaysOfWeek = r.uint32()
+	case PatternMonth, PatternMonthEnd, PatternHjMonth, PatternHjMonthEnd:
+		res.DayOfMonth = r.uint32()
+	case PatternMonthNth, PatternHjMonthNth:
+		res.DaysOfWeek = r.uint32()
+		res.WeekOfMonth = r.uint32()
+	}
+	res.EndType = RecurEndType(r.uint32())
+	res.OccurrenceCount = r.uint32()
+	res.FirstDayOfWeek = r.uint32()
+	for n := r.count(4); n > 0; n-- {
+		res.DeletedDates = append(res.DeletedDates, minutesToTime(r.uint32()))
+	}
+	for n := r.count(4); n > 0; n-- {
+		res.ModifiedDates = append(res.ModifiedDates, minutesToTime(r.uint32()))
+	}
+	res.StartDate = minutesToTime(r.uint32())
+	res.EndDate = minutesToTime(r.uint32())
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.remaining() == 0 {
+		return res, nil
+	}
+
+	r.uint32() // ReaderVersion2
+	writerVersion2 := r.uint32()
+	res.StartTimeOffset = time.Duration(r.uint32()) * time.Minute
+	res.EndTimeOffset = time.Duration(r.uint32()) * time.Minute
+	res.Exceptions = make([]RecurrenceException, r.count16(14))
+	flags := make([]uint16, len(res.Exceptions))
+	for i := range res.Exceptions {
+		ex := &res.Exceptions[i]
+		ex.Start = minutesToTime(r.uint32())
+		ex.End = minutesToTime(r.uint32())
+		ex.OriginalStart = minutesToTime(r.uint32())
+		flags[i] = r.uint16()
+		if flags[i]&overrideSubject != 0 {
+			r.uint16() // SubjectLength
+			s := string(r.bytes(int(r.uint16())))
+			ex.Subject = &s
+		}
+		if flags[i]&overrideMeetingType != 0 {
+			v := int32(r.uint32())
+			ex.MeetingType = &v
+		}
+		if flags[i]&overrideReminderDelta != 0 {
+			v := int32(r.uint32())
+			ex.ReminderDelta = &v
+		}
+		if flags[i]&overrideReminder != 0 {
+			v := r.uint32() != 0
+			ex.ReminderSet = &v
+		}
+		if flags[i]&overrideLocation != 0 {
+			r.uint16() // LocationLength
+			s := string(r.bytes(int(r.uint16())))
+			ex.Location = &s
+		}
+		if flags[i]&overrideBusyStatus != 0 {
+			v := BusyStatus(r.uint32())
+			ex.BusyStatus = &v
+		}
+		if flags[i]&overrideAttachment != 0 {
+			v := r.uint32() != 0
+			ex.HasAttachment = &v
+		}
+		if flags[i]&overrideSubType != 0 {
+			v := r.uint32() != 0
+			ex.AllDay = &v
+		}
+		if flags[i]&overrideColor != 0 {
+			v := int32(r.uint32())
+			ex.Color = &v
+		}
+	}
+	r.bytes(int(r.uint32())) // ReservedBlock1
+
+	// ExtendedException: the subject and location in Unicode
+	for i := range res.Exceptions {
+		if r.err != nil || r.remaining() == 0 {
+			break
+		}
+		if writerVersion2 >= 0x3009 {
+			r.bytes(int(r.uint32())) // ChangeHighlight
+		}
+		r.bytes(int(r.uint32())) // ReservedBlockEE1
+		if flags[i]&(overrideSubject|overrideLocation) == 0 {
+			continue
+		}
+		r.bytes(12) // StartDateTime, EndDateTime, OriginalStartDate
+		if flags[i]&overrideSubject != 0 {
+			s := r.utf16(int(r.uint16()))
+			res.Exceptions[i].Subject = &s
+		}
+		if flags[i]&overrideLocation != 0 {
+			s := r.utf16(int(r.uint16()))
+			res.Exceptions[i].Location = &s
+		}
+		r.bytes(int(r.uint32())) // ReservedBlockEE2
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return res, nil
+}
+
+// DeletedInstances returns the original start of the deleted instances, leaving out the modified ones that are listed as exceptions
+func (p *RecurrencePattern) DeletedInstances() []time.Time {
+	// DeletedDates lists the original date of modified instances too, while ModifiedDates has their new date
+	modified := make(map[time.Time]bool, len(p.Exceptions))
+	for _, ex := range p.Exceptions {
+		modified[ex.OriginalStart.Truncate(24*time.Hour)] = true
+	}
+	var res []time.Time
+	for _, d := range p.DeletedDates {
+		if !modified[d] {
+			res = append(res, d.Add(p.StartTimeOffset))
+		}
+	}
+	return res
+}
+
+// RRule returns the pattern as an RFC 5545 RRULE value (without the "RRULE:" prefix).
+// loc is the time zone of the series, used to express UNTIL in UTC; a nil loc writes a floating UNTIL.
+// UNTIL is a date for all-day series.
+func (p *RecurrencePattern) RRule(loc *time.Location, allDay bool) (string, error) {
+	if p.CalendarType != 0 && p.CalendarType != 1 {
+		return "", ErrUnsupportedRecurrence
+	}
+	var parts []string
+	switch {
+	case p.Frequency == RecurDaily && p.PatternType == PatternDay:
+		parts = append(parts, "FREQ=DAILY")
+		if days := p.Period / 1440; days > 1 {
+			parts = append(parts, fmt.Sprintf("INTERVAL=%d", days))
+		}
+	case p.PatternType == PatternWeek:
+		// Daily recurrences "every weekday" are stored as weekly ones
+		parts = append(parts, "FREQ=WEEKLY")
+		if p.Period > 1 && p.Frequency == RecurWeekly {
+			parts = append(parts, fmt.Sprintf("INTERVAL=%d", p.Period))
+		}
+		parts = append(parts, "BYDAY="+byDay(p.DaysOfWeek, ""))
+	case p.Frequency == RecurMonthly || p.Frequency == RecurYearly:
+		if p.Frequency == RecurYearly {
+			parts = append(parts, "FREQ=YEARLY")
+			if p.Period > 12 {
+				parts = append(parts, fmt.Sprintf("INTERVAL=%d", p.Period/12))
+			}
+			parts = append(parts, fmt.Sprintf("BYMONTH=%d", int(p.StartDate.Month())))
+		} else {
+			parts = append(parts, "FREQ=MONTHLY")
+			if p.Period > 1 {
+				parts = append(parts, fmt.Sprintf("INTERVAL=%d", p.Period))
+			}
+		}
+		switch p.PatternType {
+		case PatternMonth:
+			parts = append(parts, fmt.Sprintf("BYMONTHDAY=%d", p.DayOfMonth))
+		case PatternMonthEnd:
+			parts = append(parts, "BYMONTHDAY=-1")
+		case PatternMonthNth:
+			pos := int(p.WeekOfMonth)
+			if pos == 5 {
+				pos = -1
+			}
+			parts = append(parts, "BYDAY="+byDay(p.DaysOfWeek, ""), fmt.Sprintf("BYSETPOS=%d", pos))
+		default:
+			return "", ErrUnsupportedRecurrence
+		}
+	default:
+		return "", ErrUnsupportedRecurrence
+	}
+
+	switch p.EndType {
+	case EndAfterOccurrences:
+		parts = append(parts, fmt.Sprintf("COUNT=%d", p.OccurrenceCount))
+	case EndAfterDate:
+		if allDay {
+			parts = append(parts, "UNTIL="+p.EndDate.Format("20060102"))
+		} else if loc == nil {
+			parts = append(parts, "UNTIL="+p.EndDate.Add(p.StartTimeOffset).Format("20060102T150405"))
+		} else {
+			parts = append(parts, "UNTIL="+InLocation(p.EndDate.Add(p.StartTimeOffset), loc).UTC().Format("20060102T150405Z"))
+		}
+	}
+	if p.FirstDayOfWeek != 1 && p.FirstDayOfWeek < 7 && p.PatternType == PatternWeek {
+		parts = append(parts, "WKST="+weekdayCodes[p.FirstDayOfWeek])
+	}
+	return strings.Join(parts, ";"), nil
+}
+
+// weekdayCodes are the iCalendar weekday names, starting with Sunday like the DaysOfWeek bit mask
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// byDay formats a DaysOfWeek bit mask as a BYDAY list, with an optional ordinal prefix
+func byDay(mask uint32, prefix string) string {
+	var days []string
+	for i, code := range weekdayCodes {
+		if mask&(1<<uint(i)) != 0 {
+			days = append(days, prefix+code)
+		}
+	}
+	return strings.Join(days, ",")
+}
+
+// InLocation interprets the wall clock time t, as found in recurrence patterns, in the time zone loc
+func InLocation(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// minutesToTime converts minutes since January 1, 1601 to a wall clock time
+func minutesToTime(minutes uint32) time.Time {
+	return time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(minutes/1440)).Add(time.Duration(minutes%1440) * time.Minute)
+}
+
+// blobReader reads little-endian values from a binary property, remembering the first error
+type blobReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+var errShortBlob = errors.New("structure is truncated")
+
+func (r *blobReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.data) {
+		r.err = errShortBlob
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *blobReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *blobReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// count reads a 32 bit element count, checking that the elements of the given size fit in the remaining data
+func (r *blobReader) count(size int) int {
+	n := int(r.uint32())
+	if n*size > r.remaining() {
+		r.err = errShortBlob
+		return 0
+	}
+	return n
+}
+
+// count16 reads a 16 bit element count, checking that elements of at least the given size fit in the remaining data
+func (r *blobReader) count16(size int) int {
+	n := int(r.uint16())
+	if n*size > r.remaining() {
+		r.err = errShortBlob
+		return 0
+	}
+	return n
+}
+
+// utf16 reads n UTF-16LE code units
+func (r *blobReader) utf16(n int) string {
+	b := r.bytes(n * 2)
+	u := make([]uint16, n)
+	for i := range u {
+		if b != nil {
+			u[i] = binary.LittleEndian.Uint16(b[i*2:])
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+func (r *blobReader) remaining() int {
+	return len(r.data) - r.pos
+}
@@ -0,0 +1,402 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// SegmentKind tells what part of a reply a BodySegment is
+type SegmentKind int
+
+// Kinds of body segments
+const (
+	SegmentReply     SegmentKind = iota // New content of the message
+	SegmentSignature                    // Signature closing the new content
+	SegmentQuoted                       // Earlier message quoted or forwarded in the body
+)
+
+// QuotedHeader is the header of a quoted message, from an Outlook header block ("From: ... Sent: ...") or an
+// attribution line ("On ..., ... wrote:")
+type QuotedHeader struct {
+	From    string
+	Sent    string    // As written in the body
+	Date    time.Time // Sent, when its format is known
+	To      string
+	CC      string
+	Subject string
+}
+
+// BodySegment is a part of a body split by SegmentText or SegmentHTML
+type BodySegment struct {
+	Kind   SegmentKind
+	Text   string        // Text of the segment, without its header and > quoting
+	Header *QuotedHeader // Header of a quoted message, nil for quoted text without header
+}
+
+// BodySegments are the parts of a body, in the order they appear
+type BodySegments []BodySegment
+
+// Reply returns the new content of the message, without signature
+func (s BodySegments) Reply() string {
+	return s.join(SegmentReply)
+}
+
+// Signature returns the signature of the new content
+func (s BodySegments) Signature() string {
+	return s.join(SegmentSignature)
+}
+
+// Quoted returns the quoted messages, the most recent first
+func (s BodySegments) Quoted() []BodySegment {
+	var res []BodySegment
+	for _, seg := range s {
+		if seg.Kind == SegmentQuoted {
+			res = append(res, seg)
+		}
+	}
+	return res
+}
+
+func (s BodySegments) join(kind SegmentKind) string {
+	var parts []string
+	for _, seg := range s {
+		if seg.Kind == kind && seg.Text != "" {
+			parts = append(parts, seg.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// SegmentBody splits the body of the message with SegmentHTML, or with SegmentText when it has no HTML body
+func (res *Message) SegmentBody() BodySegments {
+	if res.BodyHTML != "" {
+		return SegmentHTML(res.BodyHTML)
+	}
+	return SegmentText(res.BodyPlainText)
+}
+
+// SegmentHTML splits an HTML body like SegmentText, once rendered as text. The reply headers of Outlook
+// (divRplyFwdMsg and the bordered header of the desktop client) separate quoted messages, and signatures marked
+// by Outlook, Gmail and Thunderbird are recognized.
+func SegmentHTML(body string) BodySegments {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	marks := make(map[*html.Node]string)
+	walkElements(doc, func(n *html.Node) {
+		id, class := strings.ToLower(attr(n, "id")), strings.ToLower(attr(n, "class"))
+		style := strings.ToLower(strings.ReplaceAll(attr(n, "style"), " ", ""))
+		switch {
+		case strings.HasSuffix(id, "divrplyfwdmsg"), strings.HasPrefix(style, "border:none;border-top:solid"):
+			marks[n] = outlookSeparator
+		case strings.HasSuffix(id, "signature"), strings.Contains(class, "gmail_signature"), strings.Contains(class, "moz-signature"):
+			marks[n] = "-- "
+		}
+	})
+	for n, mark := range marks {
+		if n.Parent == nil {
+			continue
+		}
+		div := &html.Node{Type: html.ElementNode, Data: "div"}
+		div.AppendChild(&html.Node{Type: html.TextNode, Data: mark})
+		n.Parent.InsertBefore(div, n)
+	}
+	return SegmentText(renderText(doc, false))
+}
+
+// SegmentText splits a plain text body into the new content of the message, its signature and the quoted
+// messages. Quoted messages start at an Outlook header block ("From: ... Sent: ...", after an optional
+// separator line) or at > quoting, with the attribution line before it as header. The signature follows a
+// "-- " line, a closing such as "Best regards" or ends the body with a line such as "Sent from my iPhone".
+func SegmentText(text string) BodySegments {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var res BodySegments
+	for _, seg := range segmentLines(lines, SegmentReply) {
+		if seg.Kind != SegmentReply {
+			res = append(res, seg)
+			continue
+		}
+		reply, signature := splitSignature(strings.Split(seg.Text, "\n"))
+		if reply != "" {
+			res = append(res, BodySegment{Kind: SegmentReply, Text: reply})
+		}
+		if signature != "" {
+			res = append(res, BodySegment{Kind: SegmentSignature, Text: signature})
+		}
+	}
+	return res
+}
+
+// segmentLines splits lines at header blocks and > quoting; the text before the first one is of the given kind
+func segmentLines(lines []string, kind SegmentKind) BodySegments {
+	var res BodySegments
+	current := BodySegment{Kind: kind}
+	var buf []string
+	flush := func() {
+		current.Text = strings.TrimSpace(strings.Join(buf, "\n"))
+		if current.Text != "" || current.Header != nil {
+			res = append(res, current)
+		}
+		buf = nil
+	}
+
+	for i := 0; i < len(lines); {
+		if header, next, ok := headerBlock(lines, i); ok {
+			flush()
+			current = BodySegment{Kind: SegmentQuoted, Header: header}
+			i = next
+			continue
+		}
+		if !isQuoted(lines[i]) {
+			buf = append(buf, lines[i])
+			i++
+			continue
+		}
+
+		// A run of quoted lines, which may contain blank lines
+		end := i
+		for j := i; j < len(lines); j++ {
+			if isQuoted(lines[j]) {
+				end = j + 1
+			} else if strings.TrimSpace(lines[j]) != "" {
+				break
+			}
+		}
+		var header *QuotedHeader
+		buf, header = attributionBefore(buf)
+		flush()
+		quoted := make([]string, 0, end-i)
+		for _, line := range lines[i:end] {
+			quoted = append(quoted, unquote(line))
+		}
+		nested := segmentLines(quoted, SegmentQuoted)
+		if len(nested) > 0 && nested[0].Header == nil {
+			nested[0].Header = header
+		} else if header != nil {
+			nested = append(BodySegments{{Kind: SegmentQuoted, Header: header}}, nested...)
+		}
+		res = append(res, nested...)
+		// The text after the quote goes on with the message that quoted it
+		current = BodySegment{Kind: current.Kind}
+		i = end
+	}
+	flush()
+	return res
+}
+
+func isQuoted(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+// unquote removes a level of > quoting from a line
+func unquote(line string) string {
+	line = strings.TrimLeft(line, " ")
+	line = strings.TrimPrefix(line, ">")
+	return strings.TrimPrefix(line, " ")
+}
+
+// outlookSeparator is the line Outlook writes above the header of the message it replies to in plain text
+const outlookSeparator = "________________________________"
+
+// separatorLine matches the lines written above a header block
+var separatorLine = regexp.MustCompile(`(?i)^\s*(?:_{10,}|-{10,}|-{3,}\s*(?:original message|forwarded message|mensaje original|mensaje reenviado|message d'origine|message transféré|ursprüngliche nachricht|weitergeleitete nachricht|oorspronkelijk bericht|doorgestuurd bericht|messaggio originale|messaggio inoltrato|mensagem original|mensagem encaminhada)\s*-{3,})\s*$`)
+
+// headerField matches a line of a header block, in bold in some renderings
+var headerField = regexp.MustCompile(`^\s*\*?([^\s:*][^:*]{0,20}?)\*?\s*:\*?\s*(.*)$`)
+
+// Fields of a header block, by their name in the languages Outlook writes them in
+var headerFields = map[string]string{
+	"from": "from", "de": "from", "von": "from", "van": "from", "da": "from", "från": "from", "fra": "from", "od": "from",
+	"sent": "sent", "date": "sent", "envoyé": "sent", "gesendet": "sent", "enviado": "sent", "enviado el": "sent",
+	"fecha": "sent", "verzonden": "sent", "inviato": "sent", "data": "sent", "datum": "sent", "skickat": "sent",
+	"sendt": "sent", "wysłano": "sent", "to": "to", "à": "to", "a": "to", "an": "to", "aan": "to", "para": "to",
+	"per": "to", "till": "to", "til": "to", "do": "to", "cc": "cc", "subject": "subject", "objet": "subject",
+	"betreff": "subject", "asunto": "subject", "onderwerp": "subject", "oggetto": "subject", "assunto": "subject",
+	"ämne": "subject", "emne": "subject", "temat": "subject",
+}
+
+// headerBlock reads the header block starting at lines[i], if any, and returns it with the index of the line
+// following it. A block starts with the sender, and has a date or a subject unless a separator line precedes it.
+func headerBlock(lines []string, i int) (*QuotedHeader, int, bool) {
+	j := i
+	separated := false
+	for j < len(lines) && separatorLine.MatchString(lines[j]) {
+		separated = true
+		j++
+	}
+	for separated && j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+		j++
+	}
+
+	header := &QuotedHeader{}
+	fields := make(map[string]bool)
+	last := ""
+	for ; j < len(lines) && strings.TrimSpace(lines[j]) != ""; j++ {
+		m := headerField.FindStringSubmatch(lines[j])
+		field := ""
+		if m != nil {
+			field = headerFields[strings.ToLower(m[1])]
+		}
+		if field == "" || fields[field] {
+			if last == "to" || last == "cc" {
+				// Outlook wraps long recipient lists
+				header.setField(last, header.field(last)+" "+strings.TrimSpace(lines[j]))
+				continue
+			}
+			break
+		}
+		if len(fields) == 0 && field != "from" {
+			return nil, i, false
+		}
+		fields[field], last = true, field
+		header.setField(field, strings.TrimSpace(m[2]))
+	}
+	if !fields["from"] || !(separated || fields["sent"] || fields["subject"]) {
+		return nil, i, false
+	}
+	header.Date = parseSent(header.Sent)
+	return header, j, true
+}
+
+func (h *QuotedHeader) field(name string) string {
+	switch name {
+	case "to":
+		return h.To
+	case "cc":
+		return h.CC
+	}
+	return ""
+}
+
+func (h *QuotedHeader) setField(name, value string) {
+	switch name {
+	case "from":
+		h.From = value
+	case "sent":
+		h.Sent = value
+	case "to":
+		h.To = value
+	case "cc":
+		h.CC = value
+	case "subject":
+		h.Subject = value
+	}
+}
+
+// attribution matches the line written above quoted text, with the date and sender in the middle
+var attribution = regexp.MustCompile(`(?i)^\s*(?:on|el|le|il|em|den|dnia)\s+(.+?)\s*(?:wrote|escribió|a écrit|ha scritto|escreveu|skrev|napisał)\s*:\s*$`)
+
+// attributionAfter matches an attribution line with the sender after the verb
+var attributionAfter = regexp.MustCompile(`(?i)^\s*(?:am|op)\s+(.+?)\s+(?:schrieb|schreef)\s+(.+?)\s*:\s*$`)
+
+// attributionSender separates the date from the sender, which follows the last comma or time of day
+var attributionSender = regexp.MustCompile(`^(.*(?:\d:\d{2}(?::\d{2})?(?:\s*[AaPp]\.?[Mm]\.?)?|,))\s+(\S.*)$`)
+
+// attributionBefore removes the attribution line ending lines, which can be wrapped on two lines, and returns
+// it as a header
+func attributionBefore(lines []string) ([]string, *QuotedHeader) {
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	for n := 1; n <= 2 && n <= end; n++ {
+		var parts []string
+		for _, line := range lines[end-n : end] {
+			parts = append(parts, strings.TrimSpace(line))
+		}
+		line := strings.Join(parts, " ")
+		header := &QuotedHeader{}
+		if m := attributionAfter.FindStringSubmatch(line); m != nil {
+			header.Sent, header.From = m[1], m[2]
+		} else if m := attribution.FindStringSubmatch(line); m != nil {
+			header.Sent = m[1]
+			if s := attributionSender.FindStringSubmatch(m[1]); s != nil {
+				header.Sent, header.From = strings.TrimRight(s[1], ", "), s[2]
+			}
+		} else {
+			continue
+		}
+		header.Date = parseSent(header.Sent)
+		return lines[:end-n], header
+	}
+	return lines, nil
+}
+
+// sentLayouts are the date formats of headers and attribution lines
+var sentLayouts = []string{
+	"Monday, January 2, 2006 3:04 PM",
+	"Monday, January 2, 2006 3:04:05 PM",
+	"Monday, 2 January 2006 15:04",
+	"Monday, 2 January 2006 3:04 PM",
+	"Mon, Jan 2, 2006 at 3:04 PM",
+	"Mon, 2 Jan 2006 at 15:04",
+	"Mon, Jan 2, 2006, 3:04 PM",
+	"January 2, 2006 3:04 PM",
+	"2 January 2006 15:04",
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02 15:04",
+}
+
+// parseSent parses the date of a header, or returns the zero time
+func parseSent(sent string) time.Time {
+	sent = strings.Join(strings.Fields(sent), " ")
+	for _, layout := range sentLayouts {
+		if t, err := time.Parse(layout, sent); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// valediction matches the closing line a signature follows
+var valediction = regexp.MustCompile(`(?i)^\s*(?:(?:best|kind|warm|many thanks and|with)?\s*regards|best(?: wishes)?|cheers|thanks(?: again| and regards)?|thank you|many thanks|sincerely|yours(?: sincerely| truly| faithfully)?|un saludo|saludos(?: cordiales)?|atentamente|cordialement|bien à vous|(?:mit )?(?:freundlichen|besten) grüßen|viele grüße|gruß|met vriendelijke groet(?:en)?|cordiali saluti|distinti saluti|atenciosamente|abraços|med vänlig hälsning)\s*[,.!]?\s*$`)
+
+// mobileSignature matches the line mail apps end the body with
+var mobileSignature = regexp.MustCompile(`(?i)^\s*(?:sent from|sent with|get outlook for|enviado desde|envoyé de|von meinem|verzonden vanaf|inviato da)\b`)
+
+// Signatures after a closing are short
+const (
+	maxSignatureLines = 10
+	maxSignatureWidth = 80
+)
+
+// splitSignature separates the signature ending the lines of a reply from the text before it
+func splitSignature(lines []string) (string, string) {
+	join := func(lines []string) string {
+		return strings.TrimSpace(strings.Join(lines, "\n"))
+	}
+	for i, line := range lines {
+		if strings.TrimRight(line, " ") == "--" {
+			return join(lines[:i]), join(lines[i+1:])
+		}
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		if !valediction.MatchString(lines[i]) {
+			continue
+		}
+		count, short := 0, true
+		for _, line := range lines[i+1:] {
+			if strings.TrimSpace(line) != "" {
+				count++
+				short = short && len([]rune(line)) <= maxSignatureWidth
+			}
+		}
+		if count > 0 && count <= maxSignatureLines && short {
+			return join(lines[:i+1]), join(lines[i+1:])
+		}
+		break
+	}
+	last := len(lines) - 1
+	for last >= 0 && strings.TrimSpace(lines[last]) == "" {
+		last--
+	}
+	if last >= 0 && mobileSignature.MatchString(lines[last]) {
+		return join(lines[:last]), join(lines[last:])
+	}
+	return join(lines), ""
+}
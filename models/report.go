@@ -0,0 +1,279 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ReportKind tells what a report message (REPORT.*) reports on its original message
+type ReportKind int
+
+// Kinds of reports, from the suffix of the message class
+const (
+	ReportNonDelivery ReportKind = iota // REPORT.<class>.NDR
+	ReportDelivery                      // REPORT.<class>.DR
+	ReportDelayed                       // REPORT.<class>.Delayed.DR, delivery is still being attempted
+	ReportRelayed                       // REPORT.<class>.Relayed.DR, relayed to a system that sends no delivery reports
+	ReportExpanded                      // REPORT.<class>.Expanded.DR, delivered to the members of a distribution list
+	ReportRead                          // REPORT.<class>.IPNRN
+	ReportNotRead                       // REPORT.<class>.IPNNRN
+)
+
+// NDRReason is the PidTagNonDeliveryReportReasonCode of a recipient a message could not be delivered to
+type NDRReason int32
+
+// Non-delivery reasons (MS-OXOMSG 2.2.2.2.1)
+const (
+	NDRReasonNone                    NDRReason = -1 // The recipient has no reason code, it was not rejected
+	NDRTransferFailed                NDRReason = 0
+	NDRUnableToTransfer              NDRReason = 1
+	NDRConversionNotPerformed        NDRReason = 2
+	NDRPhysicalRenditionNotPerformed NDRReason = 3
+	NDRPhysicalDeliveryNotPerformed  NDRReason = 4
+	NDRRestrictedDelivery            NDRReason = 5
+	NDRDirectoryOperationFailed      NDRReason = 6
+	NDRDeferredDeliveryNotPerformed  NDRReason = 7
+	NDRTransferImpossible            NDRReason = 8
+)
+
+var ndrReasons = []string{
+	"the message could not be transferred",
+	"the message could not be transferred to the recipient",
+	"the message could not be converted",
+	"the message could not be rendered physically",
+	"the message could not be delivered physically",
+	"delivery to the recipient is restricted",
+	"the directory lookup of the recipient failed",
+	"the deferred delivery of the message could not be performed",
+	"the transfer of the message is impossible",
+}
+
+// String returns a description of the reason
+func (r NDRReason) String() string {
+	if r == NDRReasonNone {
+		return ""
+	}
+	if r >= 0 && int(r) < len(ndrReasons) {
+		return ndrReasons[r]
+	}
+	return fmt.Sprintf("unknown reason %d", int32(r))
+}
+
+// NDRDiagnostic is the PidTagNonDeliveryReportDiagCode of a recipient a message could not be delivered to
+type NDRDiagnostic int32
+
+// NDRDiagnosticNone is MAPI_DIAG_NO_DIAGNOSTIC
+const NDRDiagnosticNone NDRDiagnostic = -1
+
+// ndrDiagnostics describes the MAPI_DIAG_* codes in order
+var ndrDiagnostics = []string{
+	"the recipient name is not recognized",
+	"the recipient name is ambiguous",
+	"the message transfer system is congested",
+	"the message loops",
+	"the recipient is unavailable",
+	"the maximum time for delivery expired",
+	"the encoded information types are unsupported",
+	"the message is too long",
+	"the conversion is impractical",
+	"the conversion is prohibited",
+	"the recipient did not subscribe to the conversion",
+	"the parameters are invalid",
+	"the content has a syntax error",
+	"a length constraint was violated",
+	"a number constraint was violated",
+	"the content type is unsupported",
+	"there are too many recipients",
+	"there is no bilateral agreement",
+	"a critical function is unsupported",
+	"the conversion would lose information",
+	"a line is too long",
+	"a page is too long",
+	"a pictorial symbol would be lost",
+	"a punctuation symbol would be lost",
+	"an alphabetic character would be lost",
+	"several kinds of information would be lost",
+	"reassignment is prohibited",
+	"the redirection loops",
+	"distribution list expansion is prohibited",
+	"submission is prohibited",
+	"distribution list expansion failed",
+	"the rendition is unsupported",
+	"the mail address is incorrect",
+	"the mail office is incorrect or invalid",
+	"the mail address is incomplete",
+	"the recipient is unknown",
+	"the recipient is deceased",
+	"the recipient organization expired",
+	"the recipient refused the message",
+	"the message was not claimed",
+	"the recipient moved",
+	"the recipient is travelling",
+	"the recipient departed",
+	"the new address of the recipient is unknown",
+	"the recipient does not want forwarding",
+	"forwarding is prohibited",
+	"a secure messaging error occurred",
+	"the message cannot be downgraded",
+}
+
+// String returns a description of the diagnostic
+func (d NDRDiagnostic) String() string {
+	if d == NDRDiagnosticNone {
+		return ""
+	}
+	if d >= 0 && int(d) < len(ndrDiagnostics) {
+		return ndrDiagnostics[d]
+	}
+	return fmt.Sprintf("unknown diagnostic %d", int32(d))
+}
+
+// DeliveryReport is a view of a delivery, non-delivery or read report (REPORT.*)
+type DeliveryReport struct {
+	Message *Message // The underlying message
+
+	Kind               ReportKind
+	OriginalClass      string    // Class of the reported message, such as IPM.Note
+	OriginalSubject    string    // PR_ORIGINAL_SUBJECT
+	OriginalMessageID  string    // PR_ORIGINAL_MESSAGE_ID, the Message-ID of the reported message
+	OriginalSubmitTime time.Time // PR_ORIGINAL_SUBMIT_TIME
+	OriginalDisplayTo  string    // PR_ORIGINAL_DISPLAY_TO
+	ReportText         string    // PR_REPORT_TEXT
+	ReportTime         time.Time // PR_REPORT_TIME, when the message was delivered or read
+	Recipients         []ReportRecipient
+}
+
+// ReportRecipient is a recipient of the reported message, with the outcome of its delivery
+type ReportRecipient struct {
+	Recipient Recipient // The row of the recipient table
+
+	Reason            NDRReason     // PR_NDR_REASON_CODE, NDRReasonNone if the recipient was not rejected
+	Diagnostic        NDRDiagnostic // PR_NDR_DIAG_CODE
+	StatusCode        int32         // PR_NDR_STATUS_CODE
+	Status            string        // Enhanced status code (RFC 3463) found in the supplementary information, such as 5.1.1
+	ReportText        string        // PR_REPORT_TEXT
+	SupplementaryInfo string        // PR_SUPPLEMENTARY_INFO, usually the response of the remote server
+	RemoteMTA         string        // PR_REMOTE_MTA
+	DeliverTime       time.Time     // PR_DELIVER_TIME
+	ReportTime        time.Time     // PR_REPORT_TIME
+}
+
+// Failed reports whether the message could not be delivered to the recipient
+func (r ReportRecipient) Failed() bool {
+	return r.Reason != NDRReasonNone
+}
+
+// Description returns a human readable explanation of why delivery to the recipient failed, or "" if it did not
+func (r ReportRecipient) Description() string {
+	if !r.Failed() {
+		return ""
+	}
+	var parts []string
+	if d := r.Diagnostic.String(); d != "" {
+		parts = append(parts, d)
+	} else {
+		parts = append(parts, r.Reason.String())
+	}
+	if r.Status != "" {
+		parts = append(parts, "status "+r.Status)
+	}
+	if r.SupplementaryInfo != "" {
+		parts = append(parts, r.SupplementaryInfo)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// enhancedStatus matches an RFC 3463 status code, which Exchange writes as #5.1.1 in PR_SUPPLEMENTARY_INFO
+var enhancedStatus = regexp.MustCompile(`\b[245]\.\d{1,3}\.\d{1,3}\b`)
+
+// DeliveryReport returns the report view of the message, or false when its class is not REPORT.*
+func (res *Message) DeliveryReport() (*DeliveryReport, bool) {
+	if !hasClass(res.MessageClass, "REPORT") {
+		return nil, false
+	}
+	r := &DeliveryReport{
+		Message:            res,
+		OriginalSubject:    asString(res.Properties[0x0049]), // PR_ORIGINAL_SUBJECT
+		OriginalMessageID:  asString(res.Properties[0x1046]), // PR_ORIGINAL_MESSAGE_ID
+		OriginalSubmitTime: asTime(res.Properties[0x004E]),   // PR_ORIGINAL_SUBMIT_TIME
+		OriginalDisplayTo:  asString(res.Properties[0x0074]), // PR_ORIGINAL_DISPLAY_TO
+		ReportText:         asText(res.Properties[0x1001]),   // PR_REPORT_TEXT
+		ReportTime:         asTime(res.Properties[0x0032]),   // PR_REPORT_TIME
+	}
+
+	parts := strings.Split(res.MessageClass, ".")[1:]
+	suffix := ""
+	if len(parts) > 0 {
+		suffix = strings.ToUpper(parts[len(parts)-1])
+		parts = parts[:len(parts)-1]
+	}
+	switch suffix {
+	case "NDR":
+		r.Kind = ReportNonDelivery
+	case "IPNRN":
+		r.Kind = ReportRead
+	case "IPNNRN":
+		r.Kind = ReportNotRead
+	default:
+		r.Kind = ReportDelivery
+		if len(parts) > 0 {
+			switch strings.ToUpper(parts[len(parts)-1]) {
+			case "DELAYED":
+				r.Kind = ReportDelayed
+			case "RELAYED":
+				r.Kind = ReportRelayed
+			case "EXPANDED":
+				r.Kind = ReportExpanded
+			}
+			if r.Kind != ReportDelivery {
+				parts = parts[:len(parts)-1]
+			}
+		}
+	}
+	r.OriginalClass = strings.Join(parts, ".")
+	if r.OriginalSubject == "" {
+		r.OriginalSubject = res.Subject
+	}
+
+	for _, recip := range res.Recipients {
+		if recip.Type == RecipientOriginator {
+			continue
+		}
+		rr := ReportRecipient{
+			Recipient:         recip,
+			Reason:            NDRReasonNone,
+			Diagnostic:        NDRDiagnosticNone,
+			StatusCode:        asInt32(recip.Properties[0x0C20]),  // PR_NDR_STATUS_CODE
+			ReportText:        asText(recip.Properties[0x1001]),   // PR_REPORT_TEXT
+			SupplementaryInfo: asString(recip.Properties[0x0C1B]), // PR_SUPPLEMENTARY_INFO
+			RemoteMTA:         asString(recip.Properties[0x0C21]), // PR_REMOTE_MTA
+			DeliverTime:       asTime(recip.Properties[0x0010]),   // PR_DELIVER_TIME
+			ReportTime:        asTime(recip.Properties[0x0032]),   // PR_REPORT_TIME
+		}
+		if v, ok := recip.Properties[0x0C04].(int32); ok { // PR_NDR_REASON_CODE
+			rr.Reason = NDRReason(v)
+		}
+		if v, ok := recip.Properties[0x0C05].(int32); ok { // PR_NDR_DIAG_CODE
+			rr.Diagnostic = NDRDiagnostic(v)
+		}
+		rr.Status = enhancedStatus.FindString(rr.SupplementaryInfo)
+		if rr.Status == "" {
+			rr.Status = enhancedStatus.FindString(rr.ReportText)
+		}
+		r.Recipients = append(r.Recipients, rr)
+	}
+	return r, true
+}
+
+// Failed returns the recipients the message could not be delivered to
+func (r *DeliveryReport) Failed() []ReportRecipient {
+	var failed []ReportRecipient
+	for _, recip := range r.Recipients {
+		if recip.Failed() {
+			failed = append(failed, recip)
+		}
+	}
+	return failed
+}
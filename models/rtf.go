@@ -0,0 +1,296 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Compression types of a PR_RTF_COMPRESSED header (MS-OXRTFCP 2.1.3.1.1)
+const (
+	rtfCompressed   = 0x75465A4C // "LZFu"
+	rtfUncompressed = 0x414C454D // "MELA"
+)
+
+// rtfDictionary is the initial content of the dictionary of compressed RTF
+const rtfDictionary = `{\rtf1\ansi\mac\deff0\deftab720{\fonttbl;}{\f0\fnil \froman \fswiss \fmodern \fscript \fdecor MS Sans SerifSymbolArialTimes New RomanCourier{\colortbl\red0\green0\blue0` + "\r\n" + `\par \pard\plain\f0\fs20\b\i\u\tab\tx`
+
+// ErrInvalidRTF is returned by DecompressRTF for data that is not a valid PR_RTF_COMPRESSED value
+var ErrInvalidRTF = errors.New("rtf: invalid compressed RTF")
+
+// DecompressRTF decompresses a PR_RTF_COMPRESSED value (MS-OXRTFCP). Its CRC is not verified.
+func DecompressRTF(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, ErrInvalidRTF
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	input := data[16:]
+	if compressed := int(binary.LittleEndian.Uint32(data)) - 12; compressed >= 0 && compressed < len(input) {
+		input = input[:compressed]
+	}
+	switch binary.LittleEndian.Uint32(data[8:]) {
+	case rtfUncompressed:
+		if size > len(input) {
+			return nil, ErrInvalidRTF
+		}
+		return input[:size], nil
+	case rtfCompressed:
+	default:
+		return nil, ErrInvalidRTF
+	}
+
+	var dict [4096]byte
+	pos := copy(dict[:], rtfDictionary)
+	// The size comes from the header and is not trusted for the allocation, only to stop the output
+	res := make([]byte, 0, min(size, len(input)*8+len(rtfDictionary)))
+	for i := 0; i < len(input) && len(res) < size; {
+		control := input[i]
+		i++
+		for bit := 0; bit < 8 && i < len(input) && len(res) < size; bit++ {
+			if control&(1<<bit) == 0 {
+				res = append(res, input[i])
+				dict[pos] = input[i]
+				pos = (pos + 1) % len(dict)
+				i++
+				continue
+			}
+			if i+2 > len(input) {
+				return nil, ErrInvalidRTF
+			}
+			ref := int(binary.BigEndian.Uint16(input[i:]))
+			i += 2
+			offset, length := ref>>4, ref&0xF+2
+			if offset == pos {
+				return res, nil
+			}
+			for j := 0; j < length && len(res) < size; j++ {
+				b := dict[(offset+j)%len(dict)]
+				res = append(res, b)
+				dict[pos] = b
+				pos = (pos + 1) % len(dict)
+			}
+		}
+	}
+	return res, nil
+}
+
+// IsRTFFromHTML reports whether an RTF document encapsulates an HTML body (\fromhtml, MS-OXRTFEX)
+func IsRTFFromHTML(rtf []byte) bool {
+	return bytes.Contains(rtf[:min(len(rtf), 1024)], []byte(`\fromhtml1`))
+}
+
+// RTFToHTML returns the HTML body encapsulated in an RTF document by Outlook (MS-OXRTFEX), or false when it
+// encapsulates none
+func RTFToHTML(rtf []byte) (string, bool) {
+	if !IsRTFFromHTML(rtf) {
+		return "", false
+	}
+	return rtfWalk(rtf, true), true
+}
+
+// RTFToText returns the text of an RTF document
+func RTFToText(rtf []byte) string {
+	return rtfWalk(rtf, false)
+}
+
+// rtfSkippedDestinations hold no text of the document
+var rtfSkippedDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true, "pict": true, "object": true,
+	"header": true, "headerl": true, "headerr": true, "headerf": true, "footer": true, "footerl": true,
+	"footerr": true, "footerf": true, "listtable": true, "listoverridetable": true, "rsidtbl": true,
+	"xmlnstbl": true, "filetbl": true, "revtbl": true, "themedata": true, "colorschememapping": true,
+	"datastore": true, "latentstyles": true, "generator": true, "pgdsctbl": true, "fldinst": true,
+}
+
+// rtfSymbols are the control words that stand for a character
+var rtfSymbols = map[string]string{
+	"tab": "\t", "emdash": "—", "endash": "–", "bullet": "•", "lquote": "‘", "rquote": "’",
+	"ldblquote": "“", "rdblquote": "”", "emspace": " ", "enspace": " ", "qmspace": " ",
+}
+
+// rtfGroup is the state of an RTF group, restored when it ends
+type rtfGroup struct {
+	skip    bool // The group is a destination without text
+	htmlrtf bool // \htmlrtf: the content is only there for RTF readers, not part of the HTML
+	uc      int  // Characters standing in for a \u character, for readers that do not support it
+}
+
+// rtfWalk returns the text of an RTF document. With html, it returns the encapsulated HTML instead:
+// the content of \htmltag destinations and the text outside \htmlrtf regions.
+func rtfWalk(rtf []byte, html bool) string {
+	var out bytes.Buffer
+	var pending []byte // bytes of the ANSI code page, decoded once a Unicode character or the end follows
+	codepage := int32(1252)
+	flush := func() {
+		if len(pending) > 0 {
+			out.WriteString(DecodeCodepage(pending, codepage))
+			pending = pending[:0]
+		}
+	}
+	emit := func(s string) {
+		flush()
+		out.WriteString(s)
+	}
+
+	state := rtfGroup{uc: 1}
+	var stack []rtfGroup
+	skipChars := 0    // Characters left to skip after a \u character
+	destination := "" // Set at the start of a group until its first control word is read
+	starred := false
+	var high rune // High surrogate of a character outside the BMP, whose low surrogate follows
+	visible := func() bool {
+		return !state.skip && !(html && state.htmlrtf)
+	}
+
+	for i := 0; i < len(rtf); {
+		c := rtf[i]
+		switch c {
+		case '{':
+			stack = append(stack, state)
+			destination, starred = "{", false
+			i++
+			continue
+		case '}':
+			if len(stack) > 0 {
+				state, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+			destination = ""
+			i++
+			continue
+		case '\r', '\n':
+			i++
+			continue
+		case '\\':
+		default:
+			if skipChars > 0 {
+				skipChars--
+			} else if visible() {
+				pending = append(pending, c)
+			}
+			destination = ""
+			i++
+			continue
+		}
+
+		// Control symbol or control word
+		if i+1 >= len(rtf) {
+			break
+		}
+		next := rtf[i+1]
+		if !isRTFLetter(next) {
+			i += 2
+			switch next {
+			case '*':
+				if destination == "{" {
+					starred = true
+				}
+				continue
+			case '\'':
+				if i+2 <= len(rtf) {
+					if b, err := strconv.ParseUint(string(rtf[i:i+2]), 16, 8); err == nil {
+						if skipChars > 0 {
+							skipChars--
+						} else if visible() {
+							pending = append(pending, byte(b))
+						}
+					}
+					i += 2
+				}
+			case '\\', '{', '}':
+				if skipChars > 0 {
+					skipChars--
+				} else if visible() {
+					pending = append(pending, next)
+				}
+			case '~':
+				if visible() {
+					emit(" ")
+				}
+			case '_':
+				if visible() {
+					emit("-")
+				}
+			case '\r', '\n':
+				if visible() {
+					emit("\r\n")
+				}
+			}
+			destination = ""
+			continue
+		}
+
+		start := i + 1
+		i = start
+		for i < len(rtf) && isRTFLetter(rtf[i]) {
+			i++
+		}
+		word := string(rtf[start:i])
+		numStart := i
+		if i < len(rtf) && rtf[i] == '-' {
+			i++
+		}
+		for i < len(rtf) && rtf[i] >= '0' && rtf[i] <= '9' {
+			i++
+		}
+		param, hasParam := 0, i > numStart
+		if hasParam {
+			param, _ = strconv.Atoi(string(rtf[numStart:i]))
+		}
+		if i < len(rtf) && rtf[i] == ' ' {
+			i++
+		}
+
+		if destination == "{" {
+			// The first control word of a group may make it a destination
+			if starred && !(html && word == "htmltag") || rtfSkippedDestinations[word] {
+				state.skip = true
+			}
+		}
+		destination = ""
+
+		switch word {
+		case "bin":
+			i += max(param, 0)
+		case "htmlrtf":
+			state.htmlrtf = !hasParam || param != 0
+		case "ansicpg":
+			flush()
+			codepage = int32(param)
+		case "uc":
+			state.uc = param
+		case "u":
+			if visible() {
+				if param < 0 {
+					param += 0x10000
+				}
+				r := rune(param)
+				switch {
+				case utf16.IsSurrogate(r) && r < 0xDC00:
+					high = r
+				case utf16.IsSurrogate(r):
+					emit(string(utf16.DecodeRune(high, r)))
+				case utf8.ValidRune(r):
+					emit(string(r))
+				}
+			}
+			skipChars = state.uc
+		case "par", "line":
+			if visible() {
+				emit("\r\n")
+			}
+		default:
+			if s, ok := rtfSymbols[word]; ok && visible() {
+				emit(s)
+			}
+		}
+	}
+	flush()
+	return out.String()
+}
+
+func isRTFLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,493 @@
+package models
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SanitizePolicy is the allowlist SanitizeHTML applies to a body
+type SanitizePolicy struct {
+	Elements          map[string][]string // Allowed elements and their attributes besides GlobalAttributes; other elements are replaced by their content
+	GlobalAttributes  []string            // Attributes allowed on every allowed element
+	URLSchemes        []string            // Schemes allowed in links, image sources and CSS url(); data: is only allowed for images
+	StyleProperties   []string            // CSS properties allowed in style attributes, nil to allow all but mso- and unsafe ones
+	BlockRemoteImages bool                // Remove every image loaded from the network, not only tracking pixels
+	InlineCSS         bool                // Copy the declarations of <style> rules to the style attribute of the elements they match
+}
+
+// DefaultSanitizePolicy returns a policy keeping the formatting, links and images of a message
+func DefaultSanitizePolicy() *SanitizePolicy {
+	cell := []string{"colspan", "rowspan", "width", "height", "bgcolor", "valign", "nowrap"}
+	elements := map[string][]string{
+		"a":          {"href", "name", "title"},
+		"blockquote": {"cite"},
+		"col":        {"span", "width"},
+		"colgroup":   {"span", "width"},
+		"font":       {"color", "face", "size"},
+		"img":        {"src", "alt", "title", "width", "height", "border"},
+		"ol":         {"start", "type"},
+		"table":      {"border", "cellpadding", "cellspacing", "width", "bgcolor"},
+		"td":         cell,
+		"th":         cell,
+		"tr":         {"bgcolor", "valign"},
+		"ul":         {"type"},
+	}
+	for _, name := range []string{
+		"abbr", "address", "article", "b", "big", "br", "caption", "center", "cite", "code", "dd", "del", "div", "dl", "dt",
+		"em", "figcaption", "figure", "footer", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hr", "i", "ins", "kbd", "li",
+		"mark", "p", "pre", "q", "s", "section", "small", "span", "strike", "strong", "sub", "sup", "tbody", "tfoot",
+		"thead", "tt", "u", "wbr",
+	} {
+		elements[name] = nil
+	}
+	return &SanitizePolicy{
+		Elements:         elements,
+		GlobalAttributes: []string{"align", "dir", "lang", "style", "title"},
+		URLSchemes:       []string{"http", "https", "mailto", "cid", "data"},
+	}
+}
+
+// droppedElements are removed with their content: they run code, load other documents or hold no displayable text.
+// Word adds the xml and VML (v:) elements, which only Outlook renders.
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true, "object": true, "embed": true,
+	"applet": true, "noscript": true, "head": true, "title": true, "meta": true, "link": true, "base": true, "xml": true,
+	"template": true, "svg": true, "math": true, "form": true, "input": true, "button": true, "select": true,
+	"textarea": true, "audio": true, "video": true, "canvas": true,
+}
+
+// urlAttributes hold a URL checked against the schemes of the policy
+var urlAttributes = map[string]bool{"href": true, "src": true, "background": true, "cite": true}
+
+// unsafeCSS matches the CSS values that run code or that could hide it from these checks
+var unsafeCSS = regexp.MustCompile(`(?i)expression\s*\(|javascript:|vbscript:|\\`)
+
+// pixelDimension matches a width or height in pixels in a style attribute without spaces
+var pixelDimension = regexp.MustCompile(`(?:^|;)(?:width|height):(\d+)px`)
+
+// cssURLFunction matches the start of the CSS functions that load images: url() and the functions taking their
+// URLs as strings
+var cssURLFunction = regexp.MustCompile(`(?i)(?:url|image|image-set|-webkit-image-set|cross-fade|-webkit-cross-fade)\(`)
+
+// SanitizeHTML returns the content of the body of an HTML document restricted to the allowlist of policy, or of
+// DefaultSanitizePolicy when it is nil. Scripts, event handlers, forms, embedded documents and comments, which
+// include Outlook conditional comments, are removed with their content, as are remote images that are tracking
+// pixels: at most 2 pixels wide or high, or hidden. Style attributes lose their mso- properties and anything that
+// could run code.
+func SanitizeHTML(body string, policy *SanitizePolicy) (string, error) {
+	if policy == nil {
+		policy = DefaultSanitizePolicy()
+	}
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	if policy.InlineCSS {
+		inlineCSS(doc)
+	}
+	root := findElement(doc, "body")
+	if root == nil {
+		root = doc
+	}
+	s := &sanitizer{policy: policy}
+	s.clean(root)
+
+	var buf bytes.Buffer
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// SanitizedHTML returns BodyHTML sanitized with SanitizeHTML
+func (res *Message) SanitizedHTML(policy *SanitizePolicy) (string, error) {
+	return SanitizeHTML(res.BodyHTML, policy)
+}
+
+type sanitizer struct {
+	policy *SanitizePolicy
+}
+
+// clean sanitizes the children of n in place
+func (s *sanitizer) clean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			name := strings.ToLower(c.Data)
+			attrs, allowed := s.policy.Elements[name]
+			switch {
+			case droppedElements[name] || strings.HasPrefix(name, "v:") || c.Namespace != "":
+				n.RemoveChild(c)
+			case !allowed:
+				// Unknown elements, such as the o:p paragraphs of Word, are replaced by their content
+				s.clean(c)
+				for gc := c.FirstChild; gc != nil; {
+					gcNext := gc.NextSibling
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+					gc = gcNext
+				}
+				n.RemoveChild(c)
+			default:
+				c.Attr = s.attributes(name, c.Attr, attrs)
+				if name == "img" && (attr(c, "src") == "" || isTrackingPixel(c)) {
+					n.RemoveChild(c)
+					break
+				}
+				s.clean(c)
+			}
+		default:
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+// attributes returns the allowed attributes of an element, with their URLs and styles checked
+func (s *sanitizer) attributes(element string, attrs []html.Attribute, allowed []string) []html.Attribute {
+	var res []html.Attribute
+	for _, a := range attrs {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" || (!contains(allowed, key) && !contains(s.policy.GlobalAttributes, key)) {
+			continue
+		}
+		switch {
+		case urlAttributes[key]:
+			if !s.safeURL(a.Val, element == "img" || key == "background") {
+				continue
+			}
+		case key == "style":
+			if a.Val = s.style(a.Val); a.Val == "" {
+				continue
+			}
+		}
+		res = append(res, html.Attribute{Key: key, Val: a.Val})
+	}
+	return res
+}
+
+// safeURL reports whether a URL has an allowed scheme; image sources may also be data: URLs of images,
+// and must not be remote when the policy blocks remote images
+func (s *sanitizer) safeURL(u string, image bool) bool {
+	// Browsers ignore whitespace and control characters in the scheme
+	normalized := strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, u))
+	if strings.HasPrefix(normalized, "//") {
+		return !image || !s.policy.BlockRemoteImages
+	}
+	i := strings.IndexAny(normalized, ":/?#")
+	if i < 0 || normalized[i] != ':' {
+		return true // relative
+	}
+	scheme := normalized[:i]
+	switch {
+	case !contains(s.policy.URLSchemes, scheme):
+		return false
+	case scheme == "data":
+		return image && strings.HasPrefix(normalized, "data:image/")
+	case scheme == "http" || scheme == "https":
+		return !image || !s.policy.BlockRemoteImages
+	}
+	return true
+}
+
+// style returns the safe declarations of a style attribute
+func (s *sanitizer) style(style string) string {
+	var res []string
+	for _, decl := range strings.Split(style, ";") {
+		i := strings.Index(decl, ":")
+		if i < 0 {
+			continue
+		}
+		property, value := strings.ToLower(strings.TrimSpace(decl[:i])), strings.TrimSpace(decl[i+1:])
+		if property == "" || value == "" || strings.HasPrefix(property, "mso-") || property == "behavior" || property == "-moz-binding" {
+			continue
+		}
+		if s.policy.StyleProperties != nil && !contains(s.policy.StyleProperties, property) {
+			continue
+		}
+		if unsafeCSS.MatchString(value) {
+			continue
+		}
+		urls, closed := cssURLs(value)
+		if !closed && s.policy.BlockRemoteImages {
+			// Browsers load the URL of a function left open, which may hide more than these checks see
+			continue
+		}
+		safe := true
+		for _, u := range urls {
+			safe = safe && s.safeURL(u, true)
+		}
+		if safe {
+			res = append(res, property+": "+value)
+		}
+	}
+	return strings.Join(res, "; ")
+}
+
+// cssURLs returns the URLs loaded by the functions of a CSS value, and whether all those functions are closed
+func cssURLs(value string) ([]string, bool) {
+	var urls []string
+	closed := true
+	for _, loc := range cssURLFunction.FindAllStringIndex(value, -1) {
+		args, ok := cssArguments(value[loc[1]:])
+		closed = closed && ok
+		if strings.EqualFold(value[loc[0]:loc[1]], "url(") {
+			urls = append(urls, strings.Trim(strings.TrimSpace(args), `'"`))
+			continue
+		}
+		// Other functions take URLs as strings, nested url() are matched on their own
+		for rest := args; ; {
+			i := strings.IndexAny(rest, `'"`)
+			if i < 0 {
+				break
+			}
+			end := strings.IndexByte(rest[i+1:], rest[i])
+			if end < 0 {
+				urls = append(urls, rest[i+1:])
+				closed = false
+				break
+			}
+			urls = append(urls, rest[i+1:i+1+end])
+			rest = rest[i+2+end:]
+		}
+	}
+	return urls, closed
+}
+
+// cssArguments returns the arguments of a CSS function up to its closing parenthesis, or the rest of the value and
+// false when it is not closed
+func cssArguments(s string) (string, bool) {
+	depth := 1
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth--; depth == 0 {
+				return s[:i], true
+			}
+		}
+	}
+	return s, false
+}
+
+// isTrackingPixel reports whether an image is remote and too small or hidden to be seen
+func isTrackingPixel(img *html.Node) bool {
+	src := strings.ToLower(strings.TrimSpace(attr(img, "src")))
+	if !strings.HasPrefix(src, "http:") && !strings.HasPrefix(src, "https:") && !strings.HasPrefix(src, "//") {
+		return false
+	}
+	style := strings.ToLower(strings.ReplaceAll(attr(img, "style"), " ", ""))
+	if strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden") {
+		return true
+	}
+	dimensions := []string{attr(img, "width"), attr(img, "height")}
+	for _, m := range pixelDimension.FindAllStringSubmatch(style, -1) {
+		dimensions = append(dimensions, m[1])
+	}
+	for _, value := range dimensions {
+		if n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "px")); err == nil && n <= 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// cssRule is a rule of a style sheet whose selectors are all simple: an element name, an id and classes
+type cssRule struct {
+	selectors    []cssSelector
+	declarations string
+}
+
+type cssSelector struct {
+	element string
+	id      string
+	classes []string
+}
+
+// simpleSelector matches the selectors inlineCSS supports
+var simpleSelector = regexp.MustCompile(`^([a-zA-Z][\w-]*)?((?:[.#][\w-]+)*)$`)
+
+// selectorPart matches the id or a class of a simple selector
+var selectorPart = regexp.MustCompile(`[.#][\w-]+`)
+
+// cssComment matches the comments of a style sheet and the HTML comment markers that hide it from old clients
+var cssComment = regexp.MustCompile(`(?s)/\*.*?\*/|<!--|-->`)
+
+// inlineCSS prepends the declarations of the rules of the <style> elements of doc to the style attribute of the
+// elements they match, in the order of the rules and without regard to their specificity. Rules with other selectors
+// and at-rules such as @media are ignored.
+func inlineCSS(doc *html.Node) {
+	var rules []cssRule
+	walkElements(doc, func(n *html.Node) {
+		if strings.ToLower(n.Data) == "style" {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.TextNode {
+					rules = append(rules, parseCSS(c.Data)...)
+				}
+			}
+		}
+	})
+	if len(rules) == 0 {
+		return
+	}
+	walkElements(doc, func(n *html.Node) {
+		var decls []string
+		for _, rule := range rules {
+			for _, sel := range rule.selectors {
+				if sel.matches(n) {
+					decls = append(decls, rule.declarations)
+					break
+				}
+			}
+		}
+		if len(decls) == 0 {
+			return
+		}
+		if style := strings.TrimSpace(attr(n, "style")); style != "" {
+			decls = append(decls, style)
+		}
+		setAttr(n, "style", strings.Join(decls, "; "))
+	})
+}
+
+// parseCSS returns the rules of a style sheet that have at least one simple selector
+func parseCSS(css string) []cssRule {
+	css = cssComment.ReplaceAllString(css, "")
+	var rules []cssRule
+	for {
+		open := strings.Index(css, "{")
+		if open < 0 {
+			return rules
+		}
+		prelude := strings.TrimSpace(css[:open])
+		// Find the matching brace, at-rules such as @media nest blocks
+		depth, end := 0, -1
+		for i := open; i < len(css) && end < 0; i++ {
+			switch css[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			return rules
+		}
+		body := strings.TrimSpace(css[open+1 : end])
+		css = css[end+1:]
+		if strings.HasPrefix(prelude, "@") || body == "" {
+			continue
+		}
+		rule := cssRule{declarations: strings.TrimSuffix(body, ";")}
+		for _, sel := range strings.Split(prelude, ",") {
+			m := simpleSelector.FindStringSubmatch(strings.TrimSpace(sel))
+			if m == nil || m[0] == "" {
+				continue
+			}
+			selector := cssSelector{element: strings.ToLower(m[1])}
+			for _, part := range selectorPart.FindAllString(m[2], -1) {
+				if part[0] == '#' {
+					selector.id = part[1:]
+				} else {
+					selector.classes = append(selector.classes, part[1:])
+				}
+			}
+			rule.selectors = append(rule.selectors, selector)
+		}
+		if len(rule.selectors) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+}
+
+// matches reports whether the selector matches an element
+func (sel cssSelector) matches(n *html.Node) bool {
+	if sel.element != "" && !strings.EqualFold(n.Data, sel.element) {
+		return false
+	}
+	if sel.id != "" && attr(n, "id") != sel.id {
+		return false
+	}
+	classes := strings.Fields(attr(n, "class"))
+	for _, class := range sel.classes {
+		if !contains(classes, class) {
+			return false
+		}
+	}
+	return true
+}
+
+// walkElements calls fn for the elements below n in document order
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			fn(c)
+		}
+		walkElements(c, fn)
+	}
+}
+
+// findElement returns the first element named name below n, or nil
+func findElement(n *html.Node, name string) *html.Node {
+	var res *html.Node
+	walkElements(n, func(c *html.Node) {
+		if res == nil && c.Data == name {
+			res = c
+		}
+	})
+	return res
+}
+
+// attr returns the value of an attribute of an element, or ""
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// setAttr sets an attribute of an element
+func setAttr(n *html.Node, key, value string) {
+	for i, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
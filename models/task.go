@@ -0,0 +1,211 @@
+package models
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Named properties of PSETID_Task (MS-OXOTASK)
+const (
+	lidTaskStatus          = 0x8101 // PidLidTaskStatus
+	lidPercentComplete     = 0x8102 // PidLidPercentComplete
+	lidTaskStartDate       = 0x8104 // PidLidTaskStartDate
+	lidTaskDueDate         = 0x8105 // PidLidTaskDueDate
+	lidTaskDateCompleted   = 0x810F // PidLidTaskDateCompleted
+	lidTaskActualEffort    = 0x8110 // PidLidTaskActualEffort
+	lidTaskEstimatedEffort = 0x8111 // PidLidTaskEstimatedEffort
+	lidTaskLastUpdate      = 0x8115 // PidLidTaskLastUpdate
+	lidTaskRecurrence      = 0x8116 // PidLidTaskRecurrence
+	lidTaskHistory         = 0x811A // PidLidTaskHistory
+	lidTaskComplete        = 0x811C // PidLidTaskComplete
+	lidTaskOwner           = 0x811F // PidLidTaskOwner
+	lidTaskAssigner        = 0x8121 // PidLidTaskAssigner
+	lidTaskLastUser        = 0x8122 // PidLidTaskLastUser
+	lidTaskFRecurring      = 0x8126 // PidLidTaskFRecurring
+	lidTaskOwnership       = 0x8129 // PidLidTaskOwnership
+	lidTaskAcceptanceState = 0x812A // PidLidTaskAcceptanceState
+)
+
+// lidTaskGlobalID is PidLidTaskGlobalId in PSETID_Common
+const lidTaskGlobalID = 0x8519
+
+// TaskStatus is the PidLidTaskStatus of a task
+type TaskStatus int32
+
+// Task statuses
+const (
+	TaskNotStarted TaskStatus = 0 // tsvNotStarted
+	TaskInProgress TaskStatus = 1 // tsvInProgress
+	TaskComplete   TaskStatus = 2 // tsvComplete
+	TaskWaiting    TaskStatus = 3 // tsvWaiting, waiting on someone else
+	TaskDeferred   TaskStatus = 4 // tsvDeferred
+)
+
+// TaskOwnership is the PidLidTaskOwnership of a task
+type TaskOwnership int32
+
+// Task ownerships
+const (
+	TaskNotAssigned   TaskOwnership = 0 // olNewTask
+	TaskAssignersCopy TaskOwnership = 1 // olDelegatedTask
+	TaskAssigneesCopy TaskOwnership = 2 // olOwnTask
+)
+
+// TaskAcceptance is the PidLidTaskAcceptanceState of an assigned task
+type TaskAcceptance int32
+
+// Task acceptance states
+const (
+	TaskAcceptanceNone     TaskAcceptance = 0 // olTaskNotDelegated
+	TaskAcceptanceUnknown  TaskAcceptance = 1 // olTaskDelegationUnknown
+	TaskAcceptanceAccepted TaskAcceptance = 2 // olTaskDelegationAccepted
+	TaskAcceptanceRejected TaskAcceptance = 3 // olTaskDelegationDeclined
+)
+
+// TaskHistory is the PidLidTaskHistory of a task, the last change of its assignment
+type TaskHistory int32
+
+// Task history values
+const (
+	TaskHistoryNone            TaskHistory = 0
+	TaskHistoryAccepted        TaskHistory = 1
+	TaskHistoryRejected        TaskHistory = 2
+	TaskHistoryPropertyChanged TaskHistory = 3
+	TaskHistoryDueDateChanged  TaskHistory = 4
+	TaskHistoryAssigned        TaskHistory = 5
+)
+
+// Task is a view of a task (IPM.Task) built from its PSETID_Task named properties
+type Task struct {
+	Message *Message // The underlying message, holding subject, body and every other property
+
+	Status          TaskStatus         // PidLidTaskStatus
+	PercentComplete float64            // PidLidPercentComplete, from 0 to 1
+	StartDate       time.Time          // PidLidTaskStartDate, at midnight UTC of the date
+	DueDate         time.Time          // PidLidTaskDueDate, at midnight UTC of the date
+	CompletedDate   time.Time          // PidLidTaskDateCompleted
+	Complete        bool               // PidLidTaskComplete
+	ActualEffort    time.Duration      // PidLidTaskActualEffort
+	EstimatedEffort time.Duration      // PidLidTaskEstimatedEffort
+	Owner           string             // PidLidTaskOwner
+	Assigner        string             // PidLidTaskAssigner
+	LastUser        string             // PidLidTaskLastUser
+	LastUpdate      time.Time          // PidLidTaskLastUpdate
+	Ownership       TaskOwnership      // PidLidTaskOwnership
+	AcceptanceState TaskAcceptance     // PidLidTaskAcceptanceState
+	History         TaskHistory        // PidLidTaskHistory
+	Recurring       bool               // PidLidTaskFRecurring
+	Recurrence      *RecurrencePattern // PidLidTaskRecurrence, nil unless it holds a valid pattern
+	Reminder        *Reminder          // Set when PidLidReminderSet is true
+}
+
+// Task returns the task view of the message, or false when its class is not IPM.Task
+func (res *Message) Task() (*Task, bool) {
+	if !hasClass(res.MessageClass, "IPM.Task") {
+		return nil, false
+	}
+	task := func(lid uint32) interface{} {
+		v, _ := res.NamedValue(PSETIDTask, lid)
+		return v
+	}
+	t := &Task{
+		Message:         res,
+		Status:          TaskStatus(asInt32(task(lidTaskStatus))),
+		StartDate:       dateOf(asTime(task(lidTaskStartDate))),
+		DueDate:         dateOf(asTime(task(lidTaskDueDate))),
+		CompletedDate:   asTime(task(lidTaskDateCompleted)),
+		Complete:        asBool(task(lidTaskComplete)),
+		ActualEffort:    time.Duration(asInt32(task(lidTaskActualEffort))) * time.Minute,
+		EstimatedEffort: time.Duration(asInt32(task(lidTaskEstimatedEffort))) * time.Minute,
+		Owner:           asString(task(lidTaskOwner)),
+		Assigner:        asString(task(lidTaskAssigner)),
+		LastUser:        asString(task(lidTaskLastUser)),
+		LastUpdate:      asTime(task(lidTaskLastUpdate)),
+		Ownership:       TaskOwnership(asInt32(task(lidTaskOwnership))),
+		AcceptanceState: TaskAcceptance(asInt32(task(lidTaskAcceptanceState))),
+		History:         TaskHistory(asInt32(task(lidTaskHistory))),
+		Recurring:       asBool(task(lidTaskFRecurring)),
+		Reminder:        res.reminder(),
+	}
+	t.PercentComplete, _ = task(lidPercentComplete).(float64)
+	if blob := asBytes(task(lidTaskRecurrence)); len(blob) > 0 {
+		t.Recurrence, _ = ParseRecurrencePattern(blob)
+	}
+	return t, true
+}
+
+// dateOf returns the date of t at midnight UTC, or the zero time when t is zero or Outlook's 4501-01-01 "none" value,
+// which may be shifted by a time zone
+func dateOf(t time.Time) time.Time {
+	if t = t.UTC(); t.IsZero() || t.Year() >= 4500 {
+		return time.Time{}
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// WriteICS writes the task as an iCalendar (RFC 5545) object holding a VTODO
+func (t *Task) WriteICS(w io.Writer) error {
+	ics := &lineWriter{}
+	ics.line("BEGIN", "VCALENDAR")
+	ics.line("PRODID", "-//outlook-msg-parser//EN")
+	ics.line("VERSION", "2.0")
+	ics.line("BEGIN", "VTODO")
+
+	uid := fallbackUID(t.Message, t.StartDate)
+	if v, _ := t.Message.NamedValue(PSETIDCommon, lidTaskGlobalID); len(asBytes(v)) > 0 {
+		uid = strings.ToUpper(hex.EncodeToString(asBytes(v)))
+	}
+	ics.line("UID", uid)
+	stamp := firstTime(t.LastUpdate, t.Message.LastModificationDate, t.Message.CreationDate, time.Now()).UTC()
+	ics.line("DTSTAMP", stamp.Format(icsDateTime+"Z"))
+	ics.text("SUMMARY", t.Message.Subject)
+	ics.text("DESCRIPTION", t.Message.BodyPlainText)
+	if !t.StartDate.IsZero() {
+		ics.wallTime("DTSTART", t.StartDate, nil, true)
+	}
+	if !t.DueDate.IsZero() {
+		ics.wallTime("DUE", t.DueDate, nil, true)
+	}
+	if t.Recurrence != nil && !t.StartDate.IsZero() {
+		if rule, err := t.Recurrence.RRule(nil, true); err == nil {
+			ics.line("RRULE", rule)
+		}
+	}
+
+	switch {
+	case t.Complete || t.Status == TaskComplete:
+		ics.line("STATUS", "COMPLETED")
+		if !t.CompletedDate.IsZero() {
+			ics.line("COMPLETED", t.CompletedDate.UTC().Format(icsDateTime+"Z"))
+		}
+	case t.Status == TaskInProgress:
+		ics.line("STATUS", "IN-PROCESS")
+	default:
+		ics.line("STATUS", "NEEDS-ACTION")
+	}
+	if t.PercentComplete > 0 {
+		ics.line("PERCENT-COMPLETE", fmt.Sprint(int(t.PercentComplete*100+0.5)))
+	}
+	if priority, ok := map[int32]string{0: "9", 1: "5", 2: "1"}[asInt32(t.Message.Properties[0x0017])]; ok { // PR_IMPORTANCE
+		if _, set := t.Message.Properties[0x0017]; set {
+			ics.line("PRIORITY", priority)
+		}
+	}
+	if t.Owner != "" {
+		ics.text("X-OUTLOOK-TASK-OWNER", t.Owner)
+	}
+	if t.Reminder != nil && !t.Reminder.Time.IsZero() {
+		ics.line("BEGIN", "VALARM")
+		ics.line("ACTION", "DISPLAY")
+		ics.line("DESCRIPTION", "Reminder")
+		ics.line("TRIGGER;VALUE=DATE-TIME", t.Reminder.Time.UTC().Format(icsDateTime+"Z"))
+		ics.line("END", "VALARM")
+	}
+	ics.line("END", "VTODO")
+	ics.line("END", "VCALENDAR")
+	_, err := w.Write(ics.buf.Bytes())
+	return err
+}
@@ -0,0 +1,312 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Flags of a TZRule
+const (
+	TZRuleRecurCurrent = 0x0001 // TZRULE_FLAG_RECUR_CURRENT_TZREG, the rule used for recurring series
+	TZRuleEffective    = 0x0002 // TZRULE_FLAG_EFFECTIVE_TZREG, the rule in effect when the item was saved
+)
+
+// SystemTime is a Windows SYSTEMTIME as used by time zone rules.
+// When Year is 0 it describes a yearly transition: Day is the week of the month (1 to 4, 5 for the last) and DayOfWeek the weekday, 0 for Sunday.
+type SystemTime struct {
+	Year        int
+	Month       int
+	DayOfWeek   int
+	Day         int
+	Hour        int
+	Minute      int
+	Second      int
+	Millisecond int
+}
+
+// TimeZoneRule holds the offsets and daylight saving transitions of a time zone from a given year on.
+// Biases are in minutes, with UTC = local time + Bias + StandardBias (or DaylightBias during daylight saving time).
+type TimeZoneRule struct {
+	Year         int // First year the rule applies to, 0 for all
+	Flags        uint16
+	Bias         int32
+	StandardBias int32
+	DaylightBias int32
+	StandardDate SystemTime // Transition to standard time, Month is 0 for zones without daylight saving time
+	DaylightDate SystemTime // Transition to daylight saving time
+}
+
+// TimeZoneDefinition is a decoded TimeZoneDefinition structure (PidLidAppointmentTimeZoneDefinitionStartDisplay and friends, MS-OXOCAL 2.2.1.41)
+// or a PidLidTimeZoneStruct, which has a single rule and no key name
+type TimeZoneDefinition struct {
+	KeyName string // Windows time zone name, such as "W. Europe Standard Time"
+	Rules   []TimeZoneRule
+}
+
+// ParseTimeZoneDefinition decodes a TimeZoneDefinition structure
+func ParseTimeZoneDefinition(data []byte) (*TimeZoneDefinition, error) {
+	r := &blobReader{data: data}
+	r.bytes(2) // bMajorVersion, bMinorVersion
+	header := int(r.uint16())
+	start := r.pos
+	r.uint16() // wReserved
+	res := &TimeZoneDefinition{KeyName: r.utf16(int(r.uint16()))}
+	rules := int(r.uint16())
+	if r.err == nil && r.pos != start+header {
+		r.pos = start + header
+		if r.pos > len(data) {
+			r.err = errShortBlob
+		}
+	}
+	for i := 0; i < rules && r.err == nil; i++ {
+		r.bytes(4) // bMajorVersion, bMinorVersion, wReserved
+		rule := TimeZoneRule{Flags: r.uint16(), Year: int(r.uint16())}
+		r.bytes(14) // X
+		rule.Bias = int32(r.uint32())
+		rule.StandardBias = int32(r.uint32())
+		rule.DaylightBias = int32(r.uint32())
+		rule.StandardDate = r.systemTime()
+		rule.DaylightDate = r.systemTime()
+		res.Rules = append(res.Rules, rule)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	sort.SliceStable(res.Rules, func(i, j int) bool { return res.Rules[i].Year < res.Rules[j].Year })
+	return res, nil
+}
+
+// ParseTimeZoneStruct decodes a PidLidTimeZoneStruct (TZSTRUCT) into a definition with a single rule
+func ParseTimeZoneStruct(data []byte) (*TimeZoneDefinition, error) {
+	r := &blobReader{data: data}
+	rule := TimeZoneRule{Flags: TZRuleRecurCurrent | TZRuleEffective}
+	rule.Bias = int32(r.uint32())
+	rule.StandardBias = int32(r.uint32())
+	rule.DaylightBias = int32(r.uint32())
+	r.uint16() // wStandardYear
+	rule.StandardDate = r.systemTime()
+	r.uint16() // wDaylightYear
+	rule.DaylightDate = r.systemTime()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &TimeZoneDefinition{Rules: []TimeZoneRule{rule}}, nil
+}
+
+func (r *blobReader) systemTime() SystemTime {
+	return SystemTime{
+		Year:        int(r.uint16()),
+		Month:       int(r.uint16()),
+		DayOfWeek:   int(r.uint16()),
+		Day:         int(r.uint16()),
+		Hour:        int(r.uint16()),
+		Minute:      int(r.uint16()),
+		Second:      int(r.uint16()),
+		Millisecond: int(r.uint16()),
+	}
+}
+
+// HasDaylightSaving reports whether the rule switches between standard and daylight saving time
+func (rule TimeZoneRule) HasDaylightSaving() bool {
+	return rule.StandardDate.Month != 0 && rule.DaylightDate.Month != 0
+}
+
+// StandardOffset returns the offset from UTC in standard time
+func (rule TimeZoneRule) StandardOffset() time.Duration {
+	return -time.Duration(rule.Bias+rule.StandardBias) * time.Minute
+}
+
+// DaylightOffset returns the offset from UTC in daylight saving time
+func (rule TimeZoneRule) DaylightOffset() time.Duration {
+	return -time.Duration(rule.Bias+rule.DaylightBias) * time.Minute
+}
+
+// transition returns the wall clock time of a transition in the given year
+func (st SystemTime) transition(year int) time.Time {
+	clock := time.Duration(st.Hour)*time.Hour + time.Duration(st.Minute)*time.Minute + time.Duration(st.Second)*time.Second
+	if st.Year != 0 {
+		return time.Date(st.Year, time.Month(st.Month), st.Day, 0, 0, 0, 0, time.UTC).Add(clock)
+	}
+	first := time.Date(year, time.Month(st.Month), 1, 0, 0, 0, 0, time.UTC)
+	day := first.AddDate(0, 0, (st.DayOfWeek-int(first.Weekday())+7)%7+(st.Day-1)*7)
+	for day.Month() != first.Month() {
+		day = day.AddDate(0, 0, -7)
+	}
+	return day.Add(clock)
+}
+
+// Rule returns the rule that applies to the given year
+func (d *TimeZoneDefinition) Rule(year int) TimeZoneRule {
+	if len(d.Rules) == 0 {
+		return TimeZoneRule{}
+	}
+	res := d.Rules[0]
+	for _, rule := range d.Rules {
+		if rule.Year <= year {
+			res = rule
+		}
+	}
+	return res
+}
+
+// EffectiveRule returns the rule flagged as effective, or the latest one
+func (d *TimeZoneDefinition) EffectiveRule() TimeZoneRule {
+	for _, rule := range d.Rules {
+		if rule.Flags&TZRuleEffective != 0 {
+			return rule
+		}
+	}
+	if len(d.Rules) == 0 {
+		return TimeZoneRule{}
+	}
+	return d.Rules[len(d.Rules)-1]
+}
+
+// IANAName returns the IANA name of the Windows time zone, or "" if the key name is unknown
+func (d *TimeZoneDefinition) IANAName() string {
+	return WindowsToIANA(d.KeyName)
+}
+
+// TZID returns the identifier used for the zone in iCalendar: the IANA name if known, else the key name,
+// else a name built from the standard offset
+func (d *TimeZoneDefinition) TZID() string {
+	if name := d.IANAName(); name != "" {
+		return name
+	}
+	if d.KeyName != "" {
+		return d.KeyName
+	}
+	return "UTC" + formatOffset(d.EffectiveRule().StandardOffset(), ":")
+}
+
+// Location returns the zone as a *time.Location: the IANA zone when the time zone database has it,
+// else a zone following the effective rule of the definition
+func (d *TimeZoneDefinition) Location() *time.Location {
+	if name := d.IANAName(); name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	if loc, err := time.LoadLocationFromTZData(d.TZID(), tzif(d.EffectiveRule())); err == nil {
+		return loc
+	}
+	return time.FixedZone(d.TZID(), int(d.EffectiveRule().StandardOffset()/time.Second))
+}
+
+// tzif builds a TZif file without transitions whose footer describes the rule as a POSIX TZ string
+func tzif(rule TimeZoneRule) []byte {
+	std := zoneAbbreviation(rule.StandardOffset())
+	tz := "<" + std + ">" + posixOffset(rule.StandardOffset())
+	if rule.HasDaylightSaving() {
+		tz += "<" + zoneAbbreviation(rule.DaylightOffset()) + ">" + posixOffset(rule.DaylightOffset()) +
+			"," + posixTransition(rule.DaylightDate) + "," + posixTransition(rule.StandardDate)
+	}
+
+	var buf bytes.Buffer
+	// The version 1 and version 2 blocks are identical as there are no transitions
+	for i := 0; i < 2; i++ {
+		buf.WriteString("TZif2")
+		buf.Write(make([]byte, 15))
+		// isutcnt, isstdcnt, leapcnt, timecnt, typecnt, charcnt
+		for _, n := range []uint32{0, 0, 0, 0, 1, uint32(len(std) + 1)} {
+			binary.Write(&buf, binary.BigEndian, n)
+		}
+		binary.Write(&buf, binary.BigEndian, int32(rule.StandardOffset()/time.Second))
+		buf.Write([]byte{0, 0}) // isdst, abbreviation index
+		buf.WriteString(std + "\x00")
+	}
+	buf.WriteString("\n" + tz + "\n")
+	return buf.Bytes()
+}
+
+// posixOffset formats an offset the POSIX way, positive west of Greenwich
+func posixOffset(offset time.Duration) string {
+	return strings.TrimPrefix(formatOffset(-offset, ":"), "+")
+}
+
+// posixTransition formats a yearly transition as a POSIX Mm.w.d/time rule, or a Jn day of the year for a fixed date
+func posixTransition(st SystemTime) string {
+	clock := fmt.Sprintf("/%d:%02d:%02d", st.Hour, st.Minute, st.Second)
+	if st.Year != 0 {
+		day := time.Date(2001, time.Month(st.Month), st.Day, 0, 0, 0, 0, time.UTC).YearDay()
+		return fmt.Sprintf("J%d", day) + clock
+	}
+	return fmt.Sprintf("M%d.%d.%d", st.Month, st.Day, st.DayOfWeek) + clock
+}
+
+// zoneAbbreviation returns a numeric abbreviation such as +01 or -0330
+func zoneAbbreviation(offset time.Duration) string {
+	s := formatOffset(offset, "")
+	return strings.TrimSuffix(s, "00")
+}
+
+// formatOffset formats an offset as +hhmm, with sep between hours and minutes
+func formatOffset(offset time.Duration, sep string) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	minutes := int(offset / time.Minute)
+	return fmt.Sprintf("%s%02d%s%02d", sign, minutes/60, sep, minutes%60)
+}
+
+// WriteVTimezone writes the definition as an iCalendar VTIMEZONE component, with one STANDARD and DAYLIGHT pair per rule
+func (d *TimeZoneDefinition) WriteVTimezone(w io.Writer) error {
+	lines := []string{"BEGIN:VTIMEZONE", "TZID:" + d.TZID()}
+	rules := d.Rules
+	if len(rules) == 0 {
+		rules = []TimeZoneRule{{}}
+	}
+	for i, rule := range rules {
+		first, last := rule.Year, 0
+		if i == 0 || first == 0 {
+			first = 1601
+		}
+		if i+1 < len(rules) {
+			last = rules[i+1].Year - 1
+		}
+		if !rule.HasDaylightSaving() {
+			lines = append(lines, observance("STANDARD", time.Date(first, 1, 1, 0, 0, 0, 0, time.UTC), "", rule.StandardOffset(), rule.StandardOffset())...)
+			continue
+		}
+		lines = append(lines, observance("STANDARD", rule.StandardDate.transition(first),
+			yearlyRule(rule.StandardDate, rule.DaylightOffset(), last), rule.DaylightOffset(), rule.StandardOffset())...)
+		lines = append(lines, observance("DAYLIGHT", rule.DaylightDate.transition(first),
+			yearlyRule(rule.DaylightDate, rule.StandardOffset(), last), rule.StandardOffset(), rule.DaylightOffset())...)
+	}
+	lines = append(lines, "END:VTIMEZONE")
+	_, err := io.WriteString(w, strings.Join(lines, "\r\n")+"\r\n")
+	return err
+}
+
+// observance returns the lines of a STANDARD or DAYLIGHT component
+func observance(kind string, start time.Time, rrule string, from, to time.Duration) []string {
+	lines := []string{"BEGIN:" + kind, "DTSTART:" + start.Format("20060102T150405")}
+	if rrule != "" {
+		lines = append(lines, "RRULE:"+rrule)
+	}
+	return append(lines, "TZOFFSETFROM:"+formatOffset(from, ""), "TZOFFSETTO:"+formatOffset(to, ""), "END:"+kind)
+}
+
+// yearlyRule returns the RRULE of a yearly transition, ending in the year last unless it is 0.
+// from is the offset in effect before the transition, which UNTIL is converted with.
+func yearlyRule(st SystemTime, from time.Duration, last int) string {
+	if st.Year != 0 {
+		return ""
+	}
+	week := st.Day
+	if week == 5 {
+		week = -1
+	}
+	res := fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", st.Month, week, weekdayCodes[st.DayOfWeek%7])
+	if last != 0 {
+		res += ";UNTIL=" + st.transition(last).Add(-from).Format("20060102T150405Z")
+	}
+	return res
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
@@ -11,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf16"
 
 	"github.com/richardlehane/mscfb"
 	"github.com/saintfish/chardet"
@@ -28,6 +30,15 @@ const PropsKey = "__properties_version1.0"
 const PropertyStreamPrefix = "__substg1.0_"
 const RecepientStreamPrefix = "__recip_version1.0_"
 
+// AttachmentStoragePrefix is the prefix of the storage holding one attachment
+const AttachmentStoragePrefix = "__attach_version1.0_#"
+
+// NameIDStorage is the storage holding the named property mapping of a msg file
+const NameIDStorage = "__nameid_version1.0"
+
+// EmbeddedMessageStorage is the storage holding an attached message inside an attachment storage
+const EmbeddedMessageStorage = PropertyStreamPrefix + "3701000D"
+
 // ReplyToRegExp is a regex to extract the reply to header
 const ReplyToRegExp = "^Reply-To:\\s*(?:<?(?<nameOrAddress>.*?)>?)?\\s*(?:<(?<address>.*?)>)?$"
 
@@ -41,14 +52,33 @@ func ParseMsgFile(file string) (res *models.Message, err error) {
 	return parseMsgFile(file, false)
 }
 
+// ParseReader parses a msg file read from r
+func ParseReader(r io.Reader) (res *models.Message, err error) {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		ra = bytes.NewReader(data)
+	}
+	return parseMsg(ra, false)
+}
+
 // parseMsgFile is the internal function that parses the msg file and sets the properties
 func parseMsgFile(file string, debug bool) (res *models.Message, err error) {
-	res = &models.Message{}
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
-	doc, err := mscfb.New(f)
+	defer f.Close()
+	return parseMsg(f, debug)
+}
+
+// parseMsg reads the compound file and builds the message
+func parseMsg(ra io.ReaderAt, debug bool) (res *models.Message, err error) {
+	res = &models.Message{}
+	doc, err := mscfb.New(ra)
 	if err != nil {
 		return nil, err
 	}
@@ -59,51 +89,234 @@ func parseMsgFile(file string, debug bool) (res *models.Message, err error) {
 	}
 
 	res.CalculateFinalBody()
+	expandTNEF(res)
 
 	return res, nil
 }
 
-// processEntries iterates through the entries in the mscfb.Reader and processes each entry
+// propertySetter is implemented by the objects a property stream can belong to: messages, recipients and attachments
+type propertySetter interface {
+	SetProperties(msgProps models.MessageEntryProperty)
+}
+
+// msgState collects the objects of one msg file while Walk visits its entries
+type msgState struct {
+	messages    map[string]*models.Message
+	recipients  map[string]*models.Recipient
+	attachments map[string]*models.Attachment
+	children    map[string][]string                // message path -> recipient and attachment paths, in file order
+	multiValues map[string]map[int64][]interface{} // object path -> tag -> values of multi-valued variable length properties
+	multiTypes  map[string]map[int64]int64         // object path -> tag -> property type
+	names       map[int64]models.NamedProperty     // named property map of the file
+	debug       bool
+}
+
+// processEntries walks the entries in the mscfb.Reader and builds res from them
 func processEntries(doc *mscfb.Reader, res *models.Message, debug bool) error {
-	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
-		if debug {
-			log.Printf("\n\n-->Processing entry: %s, size: %d, path: %s", entry.Name, entry.Size, entry.Path)
+	state := &msgState{
+		messages:    map[string]*models.Message{"": res},
+		recipients:  make(map[string]*models.Recipient),
+		attachments: make(map[string]*models.Attachment),
+		children:    make(map[string][]string),
+		multiValues: make(map[string]map[int64][]interface{}),
+		multiTypes:  make(map[string]map[int64]int64),
+		debug:       debug,
+	}
+	if err := walk(doc, state); err != nil {
+		return err
+	}
+	state.finish()
+	return nil
+}
+
+// OnNamedPropertyMap keeps the named property map, which is copied to every message once all entries are read
+func (state *msgState) OnNamedPropertyMap(names map[int64]models.NamedProperty) error {
+	state.names = names
+	return nil
+}
+
+// OnStorage logs storages in debug mode, objects are created when their storage is recognized
+func (state *msgState) OnStorage(path []string, entry *mscfb.File) error {
+	if state.debug {
+		log.Printf("\n\n-->Processing storage: %s, path: %s", entry.Name, path)
+	}
+	return nil
+}
+
+// OnRecipient creates the recipient and adds it to its message in file order
+func (state *msgState) OnRecipient(loc Location, entry *mscfb.File) error {
+	key := loc.Key()
+	state.recipients[key] = &models.Recipient{Properties: make(map[int64]interface{})}
+	state.children[parentKey(loc)] = append(state.children[parentKey(loc)], key)
+	return nil
+}
+
+// OnAttachment creates the attachment and adds it to its message in file order
+func (state *msgState) OnAttachment(loc Location, entry *mscfb.File) error {
+	key := loc.Key()
+	state.attachments[key] = &models.Attachment{Properties: make(map[int64]interface{})}
+	state.children[parentKey(loc)] = append(state.children[parentKey(loc)], key)
+	return nil
+}
+
+// OnPropertyStream decodes the properties of a stream into the object it belongs to
+func (state *msgState) OnPropertyStream(loc Location, entry *mscfb.File) error {
+	if state.debug {
+		log.Printf("\n\n-->Processing entry: %s, size: %d, path: %s", entry.Name, entry.Size, entry.Path)
+	}
+	key := loc.Key()
+	target := state.object(key)
+	if target == nil {
+		if loc.Kind != ObjectMessage {
+			return nil
 		}
-		/*if strings.HasPrefix(entry.Name, "__recip_version1.0") {
-			processRecipientStream(entry, res)
-		} else if strings.HasPrefix(entry.Name, "__attach_version1.0_") {
-			processAttachmentStream(entry, res)
-		} else if strings.HasPrefix(entry.Name, "__substg1.0_") {
-			processPropertyStream(entry, res, debug)
-		} else if entry.Name == "__properties_version1.0" {
-			processPropertiesStream(entry, res,debug)
-		} else {
-			// Handle other types of streams if necessary
-		}*/
-		if strings.HasPrefix(entry.Name, "__substg1.0_") {
-			processPropertyStream(entry, res, debug)
+		// The first stream of an embedded message creates it on its attachment
+		att, ok := state.attachments[strings.Join(loc.Path[:len(loc.Path)-1], "/")]
+		if !ok {
+			return nil
+		}
+		att.Embedded = &models.Message{}
+		state.messages[key] = att.Embedded
+		target = att.Embedded
+	}
+	if entry.Name == PropsKey {
+		processPropertiesStream(entry, target, loc.HeaderSize)
+	} else {
+		processPropertyStream(entry, target, key, state, state.debug)
+	}
+	return nil
+}
+
+// OnUnknownStream skips streams the msg format does not describe, logging their content in debug mode
+func (state *msgState) OnUnknownStream(path []string, entry *mscfb.File) error {
+	if !state.debug {
+		return nil
+	}
+	log.Printf("Skipping entry: %s, size: %d, path: %s", entry.Name, entry.Size, path)
+	if entry.Size != 0 {
+		entryBytes := make([]byte, entry.Size)
+		if _, err := entry.Read(entryBytes); err != nil {
+			log.Printf("Error reading entry bytes: %v", err)
 		} else {
-			if debug {
-				log.Printf("Skipping entry: %s, size: %d, path: %s", entry.Name, entry.Size, entry.Path)
+			log.Printf("Entry bytes: %x", entryBytes)
+		}
+	}
+	return nil
+}
+
+// parentKey returns the key of the message a recipient or attachment belongs to
+func parentKey(loc Location) string {
+	return strings.Join(loc.Path[:len(loc.Path)-1], "/")
+}
+
+// finish sets the collected multi-valued properties and named property mapping, and links recipients and attachments to their messages
+func (state *msgState) finish() {
+	for key, values := range state.multiValues {
+		target := state.object(key)
+		for tag, list := range values {
+			property := models.MessageEntryProperty{Class: fmt.Sprintf("%04x", tag), Mapi: state.multiTypes[key][tag]}
+			switch property.Mapi {
+			case 0x101E, 0x101F:
+				strs := make([]string, len(list))
+				for i, v := range list {
+					strs[i], _ = v.(string)
+				}
+				property.Data = strs
+			case 0x1102:
+				bins := make([][]byte, len(list))
+				for i, v := range list {
+					bins[i], _ = v.([]byte)
+				}
+				property.Data = bins
+			}
+			target.SetProperties(property)
+		}
+	}
+
+	for key, msg := range state.messages {
+		if len(state.names) > 0 {
+			msg.NamedProperties = make(map[int64]models.NamedProperty, len(state.names))
+			for id, np := range state.names {
+				msg.NamedProperties[id] = np
 			}
-			if entry.Size != 0 {
-				entryBytes := make([]byte, entry.Size)
-				_, err := entry.Read(entryBytes)
-				if debug {
-					if err != nil {
-						log.Printf("Error reading entry bytes: %v", err)
-					} else {
-						log.Printf("Entry bytes: %x", entryBytes)
-					}
+		}
+		msg.ApplyNamedPropertyHandlers()
+		for _, child := range state.children[key] {
+			if recip, ok := state.recipients[child]; ok {
+				msg.Recipients = append(msg.Recipients, *recip)
+			} else if att, ok := state.attachments[child]; ok {
+				if att.Method != models.AttachEmbeddedMsg {
+					// PR_ATTACH_DATA_OBJ of an OLE attachment is not a message
+					att.Embedded = nil
 				}
+				msg.Attachments = append(msg.Attachments, *att)
 			}
 		}
+		msg.CalculateAddresses()
+		if key != "" {
+			msg.CalculateFinalBody()
+			expandTNEF(msg)
+		}
+	}
+}
 
+// object returns the message, recipient or attachment stored at key
+func (state *msgState) object(key string) propertySetter {
+	if msg, ok := state.messages[key]; ok {
+		return msg
+	}
+	if recip, ok := state.recipients[key]; ok {
+		return recip
+	}
+	if att, ok := state.attachments[key]; ok {
+		return att
 	}
 	return nil
 }
 
-func processPropertiesStream(entry *mscfb.File, res *models.Message) {
+// parseNameID decodes the GUID, entry and string streams of the __nameid_version1.0 storage into a map of property id to name
+func parseNameID(streams map[string][]byte) map[int64]models.NamedProperty {
+	guids := streams[PropertyStreamPrefix+"00020102"]
+	entries := streams[PropertyStreamPrefix+"00030102"]
+	strs := streams[PropertyStreamPrefix+"00040102"]
+	res := make(map[int64]models.NamedProperty)
+	for offset := 0; offset+8 <= len(entries); offset += 8 {
+		key := binary.LittleEndian.Uint32(entries[offset:])
+		indexKind := binary.LittleEndian.Uint32(entries[offset+4:])
+		np := models.NamedProperty{}
+		switch guidIndex := int(indexKind>>1) & 0x7FFF; guidIndex {
+		case 1:
+			np.GUID = models.PSMAPI
+		case 2:
+			np.GUID = models.PSPublicStrings
+		default:
+			start := (guidIndex - 3) * 16
+			if start < 0 || start+16 > len(guids) {
+				continue
+			}
+			np.GUID = models.FormatGUID(guids[start : start+16])
+		}
+		if indexKind&1 == 0 {
+			np.ID = key
+		} else {
+			if int(key)+4 > len(strs) {
+				continue
+			}
+			size := int(binary.LittleEndian.Uint32(strs[key:]))
+			end := int(key) + 4 + size
+			if end > len(strs) {
+				continue
+			}
+			np.Name = decodeUTF16(strs[key+4 : end])
+		}
+		res[int64(0x8000+(indexKind>>16))] = np
+	}
+	return res
+}
+
+// processPropertiesStream decodes the fixed length properties of the __properties_version1.0 stream.
+// Variable length properties only have their size here, their value comes from their own stream.
+func processPropertiesStream(entry *mscfb.File, res propertySetter, headerSize int) {
 	if entry.Size == 0 {
 		//log.Printf("Properties stream %s has size 0", entry.Name)
 		return
@@ -116,53 +329,18 @@ func processPropertiesStream(entry *mscfb.File, res *models.Message) {
 		//log.Fatalf("Failed to read properties stream: %v", err)
 	}
 
-	// Parse the properties from the data
-	offset := 0
-	for offset < len(data) {
-		// Each property is typically stored with a property tag and value
-		if offset+8 > len(data) {
-			break
-		}
-
-		// Read the property tag (4 bytes for property ID and 4 bytes for property type)
+	// Each property is 16 bytes: the tag (type in the low word, id in the high word), flags and an 8 byte value
+	for offset := headerSize; offset+16 <= len(data); offset += 16 {
 		propTag := binary.LittleEndian.Uint32(data[offset : offset+4])
-		propType := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
-		offset += 8
-
-		// Determine the length of the property value based on the property type
-		var valueLen int
-		switch propType {
-		case 0x0002: // PT_I2
-			valueLen = 2
-		case 0x0003: // PT_LONG
-			valueLen = 4
-		case 0x000B: // PT_BOOLEAN
-			valueLen = 2
-		case 0x0014: // PT_I8
-			valueLen = 8
-		case 0x0048: // PT_CLSID
-			valueLen = 16
-		case 0x00FB: // PT_SVREID
-			valueLen = int(binary.LittleEndian.Uint32(data[offset : offset+4]))
-			offset += 4
-		case 0x1E, 0x1F: // PT_STRING8, PT_UNICODE
-			valueLen = int(binary.LittleEndian.Uint32(data[offset : offset+4]))
-			offset += 4
-		default:
-			valueLen = int(binary.LittleEndian.Uint32(data[offset : offset+4]))
-			offset += 4
-		}
-
-		// Read the property value
-		if offset+valueLen > len(data) {
-			break
+		propType := propTag & 0xFFFF
+		if !isFixedLengthType(propType) {
+			continue
 		}
-		propValue := data[offset : offset+valueLen]
-		offset += valueLen
+		propValue := data[offset+8 : offset+16]
 
 		// Create a MessageEntryProperty and set the property in the message
 		property := models.MessageEntryProperty{
-			Class: fmt.Sprintf("%04x", propTag),
+			Class: fmt.Sprintf("%04x", propTag>>16),
 			Mapi:  int64(propType),
 			Data:  extractDataFromBytes(propValue, propType),
 		}
@@ -173,25 +351,13 @@ func processPropertiesStream(entry *mscfb.File, res *models.Message) {
 	}
 }
 
-// processSubStorageStream processes a sub-storage stream and iterates through its entries
-func processSubStorageStream(entry *mscfb.File, res *models.Message, debug bool) {
-
-	subStorage, err := mscfb.New(entry)
-	if err != nil {
-		//log.Fatalf("Failed to parse sub-storage: %v", err)
-	}
-	for subEntry, err := subStorage.Next(); err == nil; subEntry, err = subStorage.Next() {
-		if debug {
-			log.Printf("Processing sub-entry: %s, size: %d", subEntry.Name, subEntry.Size)
-		}
-		/*if strings.HasPrefix(subEntry.Name, "__recip_version1.0_") {
-			processRecipientStream(subEntry, res)
-		} else if strings.HasPrefix(subEntry.Name, "__attach_version1.0_") {
-			processAttachmentStream(subEntry, res)
-		} else {
-			processPropertyStream(subEntry, res, debug)
-		}*/
+// isFixedLengthType reports whether values of the property type are stored inline in the properties stream
+func isFixedLengthType(propType uint32) bool {
+	switch propType {
+	case 0x0002, 0x0003, 0x0004, 0x0005, 0x0006, 0x0007, 0x000A, 0x000B, 0x0014, 0x0040:
+		return true
 	}
+	return false
 }
 
 // extractMessageProperty processes an entry and returns a MessageEntryProperty
@@ -231,89 +397,61 @@ func parseEntryName(entry *mscfb.File) models.MessageEntryProperty {
 	return res
 }
 
-func processPropertyStream(entry *mscfb.File, res *models.Message, debug bool) {
+// processPropertyStream decodes a __substg1.0_ stream and sets it on the object owning it
+func processPropertyStream(entry *mscfb.File, res propertySetter, key string, state *msgState, debug bool) {
 
-	msg := extractMessageProperty(entry)
+	msg := parseEntryName(entry)
 
-	if debug {
-		log.Printf("***** Processing Property Stream: %+v", msg)
+	// Multi-valued variable length properties have a stream of lengths plus one stream per value, suffixed with its index
+	if msg.Mapi == 0x101E || msg.Mapi == 0x101F || msg.Mapi == 0x1102 {
+		processMultiValueStream(entry, msg, key, state)
+		return
 	}
+	msg.Data = extractData(entry, msg)
 
-	if len(entry.Path) > 0 && strings.Contains(entry.Path[0], "__recip_version1.0_") {
-		// Recipient stream
-		processRecipientStream(entry, &msg, res)
-	} else {
-		if debug {
-			log.Printf("Skipping entry path: %s, size: %d, path: %s", entry.Name, entry.Size, entry.Path)
-		}
+	if debug {
+		log.Printf("***** Processing Property Stream: %+v", msg)
 	}
 
 	res.SetProperties(msg)
 
 }
 
-func processRecipientStream(entry *mscfb.File, msg *models.MessageEntryProperty, res *models.Message) {
-
-	// Determine recipient type and email address
-
-	//log.Printf("############# Recipient Data: %v", msg.Data)
-
-	recipientIDStr := entry.Path[0][len("__recip_version1.0_#"):]
-
-	/*switch recipientID {
-	case "00000000":
-		msg.Class = "RecipientType"
-		msg.Mapi = 0x0C15
-		msg.Data = "Originator"
-	case "00000001":
-		msg.Class = "RecipientType"
-		msg.Mapi = 0x0C15
-		msg.Data = "To"
-	case "00000002":
-		msg.Class = "RecipientType"
-		msg.Mapi = 0x0C15
-		msg.Data = "CC"
-	case "00000003":
-		msg.Class = "RecipientType"
-		msg.Mapi = 0x0C15
-		msg.Data = "BCC"
-	}*/
-
-	// If recipient ID is not 0, set it as TO
-
-	recipientID, err := strconv.Atoi(recipientIDStr)
+// processMultiValueStream collects one stream of a multi-valued string or binary property
+func processMultiValueStream(entry *mscfb.File, msg models.MessageEntryProperty, key string, state *msgState) {
+	tag, err := strconv.ParseInt(msg.Class, 16, 64)
 	if err != nil {
 		return
 	}
-	if recipientID != 0 {
-		res.LastRecipient = recipientID
+	if state.multiValues[key] == nil {
+		state.multiValues[key] = make(map[int64][]interface{})
+		state.multiTypes[key] = make(map[int64]int64)
 	}
-	////log.Printf("##################>Parsed Recipient: %+v", msg)
-}
-
-// processAttachmentStream processes an attachment stream and sets the attachment properties in the Message instance
-func processAttachmentStream(entry *mscfb.File, msg *models.Message) {
-	// Iterate through the properties in the attachment stream
-	/*for {
-		prop, err := entry.Next()
-		if err == mscfb.EOF {
-			break
+	state.multiTypes[key][tag] = msg.Mapi
+	values := state.multiValues[key][tag]
+
+	suffix := strings.LastIndex(entry.Name, "-")
+	if suffix < 0 {
+		// The length stream: 4 bytes per string, 8 bytes per binary value
+		size := int64(4)
+		if msg.Mapi == 0x1102 {
+			size = 8
 		}
-		if err != nil {
-			log.Fatalf("Failed to read property: %v", err)
+		for int64(len(values)) < entry.Size/size {
+			values = append(values, nil)
 		}
-
-		// Parse the property name and extract data
-		property := parseEntryName(prop)
-		data := extractData(prop, property)
-		property.Data = data
-
-		// Set the properties of the message
-		msg.SetProperties(property)
+		state.multiValues[key][tag] = values
+		return
 	}
-
-	// Print the parsed attachment for manual verification
-	log.Printf("Parsed Attachment: %+v", msg)*/
+	index, err := strconv.ParseInt(entry.Name[suffix+1:], 16, 64)
+	if err != nil || index > 0xFFFF {
+		return
+	}
+	for int64(len(values)) <= index {
+		values = append(values, nil)
+	}
+	values[index] = extractData(entry, models.MessageEntryProperty{Class: msg.Class, Mapi: msg.Mapi &^ 0x1000})
+	state.multiValues[key][tag] = values
 }
 
 // extractData extracts the data from the entry based on the analysis result
@@ -368,32 +506,13 @@ func extractData(entry *mscfb.File, info models.MessageEntryProperty) interface{
 				decoded = string(bytes2)
 			}
 		}
-		return decoded
+		// Like PT_UNICODE, drop the terminating null characters
+		return strings.TrimRight(decoded, "\x00")
 	case 0x1f:
 		// PT_UNICODE: A null-terminated Unicode string (UTF-16LE)
 		bytes2 := make([]byte, entry.Size)
 		entry.Read(bytes2)
-		u16s := make([]uint16, len(bytes2)/2)
-		for i := 0; i < len(bytes2)-1; i += 2 {
-			u16s[i/2] = binary.LittleEndian.Uint16(bytes2[i : i+2])
-		}
-		// Use unicode/utf16 for robust decoding
-		importU16 := func(u []uint16) []rune {
-			// Use utf16.Decode if available
-			// fallback: convert directly
-			runes := make([]rune, len(u))
-			for i, v := range u {
-				runes[i] = rune(v)
-			}
-			return runes
-		}
-		// Try to use utf16.Decode if available
-		var runes []rune
-		// This import is only for demonstration, in real code, import "unicode/utf16" at the top
-		// runes = utf16.Decode(u16s)
-		// For now, fallback to direct conversion
-		runes = importU16(u16s)
-		return string(runes)
+		return decodeUTF16(bytes2)
 	case 0x102:
 		// PT_BINARY: A binary value
 		bytes2 := make([]byte, entry.Size)
@@ -403,12 +522,8 @@ func extractData(entry *mscfb.File, info models.MessageEntryProperty) interface{
 		// PT_SYSTIME: A 64-bit integer representing the number of 100-nanosecond intervals since January 1, 1601
 		bytes := make([]byte, entry.Size)
 		entry.Read(bytes)
-		if len(bytes) > 0 {
-			buf := bytes[:8]
-			a := binary.LittleEndian.Uint64(buf)
-			a /= 10000
-			a -= 11644473600000
-			return time.Unix(0, int64(a)*int64(time.Millisecond)).String()
+		if len(bytes) >= 8 {
+			return models.FiletimeToTime(binary.LittleEndian.Uint64(bytes[:8]))
 		}
 	case 0x0002:
 		// PT_I2: A 16-bit integer
@@ -533,31 +648,6 @@ func extractData(entry *mscfb.File, info models.MessageEntryProperty) interface{
 			values[i] = time.Unix(0, int64(a)*int64(time.Millisecond))
 		}
 		return values
-	case 0x101E:
-		// PT_MV_STRING8: A multiple-value null-terminated 8-bit character string
-		bytes := make([]byte, entry.Size)
-		entry.Read(bytes)
-		strs := strings.Split(string(bytes), "\x00")
-		return strs[:len(strs)-1] // Remove the last empty string after the final null terminator
-	case 0x101F:
-		// PT_MV_UNICODE: A multiple-value null-terminated Unicode string
-		bytes := make([]byte, entry.Size)
-		entry.Read(bytes)
-		runes := make([]rune, len(bytes)/2)
-		c := 0
-		for i := 0; i < len(bytes)-1; i += 2 {
-			ch := (int)(bytes[i+1])
-			cl := (int)(bytes[i]) & 0xff
-			runes[c] = (rune)((ch << 8) + cl)
-			c++
-		}
-		strs := strings.Split(string(runes), "\x00")
-		return strs[:len(strs)-1] // Remove the last empty string after the final null terminator
-	case 0x1102:
-		// PT_MV_BINARY: A multiple-value binary value
-		bytes := make([]byte, entry.Size)
-		entry.Read(bytes)
-		return bytes
 	case 0x1048:
 		// PT_MV_CLSID: A multiple-value GUID
 		count := entry.Size / 16
@@ -594,14 +684,27 @@ func extractDataFromBytes(data []byte, propType uint32) interface{} {
 	case 0x1E: // PT_STRING8
 		return string(data)
 	case 0x1F: // PT_UNICODE
-		runes := make([]rune, len(data)/2)
-		for i := 0; i < len(data)-1; i += 2 {
-			ch := (int)(data[i+1])
-			cl := (int)(data[i]) & 0xff
-			runes[i/2] = (rune)((ch << 8) + cl)
-		}
-		return string(runes)
+		return decodeUTF16(data)
+	case 0x0004: // PT_R4
+		return math.Float32frombits(binary.LittleEndian.Uint32(data))
+	case 0x0005, 0x0007: // PT_DOUBLE, PT_APPTIME
+		return math.Float64frombits(binary.LittleEndian.Uint64(data))
+	case 0x0006: // PT_CURRENCY
+		return int64(binary.LittleEndian.Uint64(data))
+	case 0x000A: // PT_ERROR
+		return int32(binary.LittleEndian.Uint32(data))
+	case 0x0040: // PT_SYSTIME
+		return models.FiletimeToTime(binary.LittleEndian.Uint64(data))
 	default:
 		return data
 	}
 }
+
+// decodeUTF16 decodes a UTF-16LE string, dropping its terminating null characters
+func decodeUTF16(data []byte) string {
+	u16s := make([]uint16, len(data)/2)
+	for i := range u16s {
+		u16s[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return strings.TrimRight(string(utf16.Decode(u16s)), "\x00")
+}
@@ -0,0 +1,299 @@
+package msgparser
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// Content types of CMS (RFC 5652) content infos
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+)
+
+// errBER is returned for PKCS #7 data that is not valid BER
+var errBER = errors.New("pkcs7: invalid BER encoding")
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// parseContentInfo decodes a BER or DER encoded CMS ContentInfo
+func parseContentInfo(data []byte) (*contentInfo, error) {
+	der, rest, err := berToDER(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.Trim(rest, "\x00")) > 0 {
+		return nil, errBER
+	}
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	}
+	return &ci, nil
+}
+
+// signedData decodes the content of a SignedData content info
+func (ci *contentInfo) signedData() (*signedData, error) {
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	return &sd, nil
+}
+
+// certificates returns the certificates carried by the signed data
+func (sd *signedData) certificates() ([]*x509.Certificate, error) {
+	if len(sd.Certificates.Bytes) == 0 {
+		return nil, nil
+	}
+	return x509.ParseCertificates(sd.Certificates.Bytes)
+}
+
+// signer returns the certificate of certs identified by the signer info, or nil
+func (si *signerInfo) signer(certs []*x509.Certificate) *x509.Certificate {
+	for _, cert := range certs {
+		if identifies(si.SID, cert) {
+			return cert
+		}
+	}
+	return nil
+}
+
+// berToDER converts the first BER element of data to DER, which encoding/asn1 requires:
+// indefinite lengths become definite and constructed OCTET STRINGs, which Outlook uses for
+// the content of opaque signed messages, are merged into primitive ones
+func berToDER(data []byte) (der, rest []byte, err error) {
+	tag, content, constructed, rest, err := berElement(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !constructed {
+		return derElement(tag, content), rest, nil
+	}
+	var children [][]byte
+	for len(content) > 0 {
+		var child []byte
+		if child, content, err = berToDER(content); err != nil {
+			return nil, nil, err
+		}
+		children = append(children, child)
+	}
+	if len(tag) == 1 && tag[0] == 0x24 { // constructed OCTET STRING
+		var merged []byte
+		for _, child := range children {
+			if child[0] != 0x04 {
+				return nil, nil, errBER
+			}
+			_, value, _, _, _ := berElement(child)
+			merged = append(merged, value...)
+		}
+		return derElement([]byte{0x04}, merged), rest, nil
+	}
+	return derElement(tag, bytes.Join(children, nil)), rest, nil
+}
+
+// berElement splits the first BER element of data into its tag, content and the data that follows it.
+// The content of an indefinite length element runs up to its end-of-contents marker, which is dropped.
+func berElement(data []byte) (tag, content []byte, constructed bool, rest []byte, err error) {
+	if len(data) < 2 {
+		return nil, nil, false, nil, errBER
+	}
+	i := 1
+	if data[0]&0x1F == 0x1F {
+		for i < len(data) && data[i]&0x80 != 0 {
+			i++
+		}
+		i++
+	}
+	if i >= len(data) {
+		return nil, nil, false, nil, errBER
+	}
+	tag, constructed = data[:i], data[0]&0x20 != 0
+	length := int(data[i])
+	i++
+	switch {
+	case length == 0x80:
+		if !constructed {
+			return nil, nil, false, nil, errBER
+		}
+		// Walk the nested elements to find the end-of-contents marker
+		start, pos := i, i
+		for {
+			if pos+2 > len(data) {
+				return nil, nil, false, nil, errBER
+			}
+			if data[pos] == 0 && data[pos+1] == 0 {
+				return tag, data[start:pos], true, data[pos+2:], nil
+			}
+			_, _, _, next, err := berElement(data[pos:])
+			if err != nil {
+				return nil, nil, false, nil, err
+			}
+			pos = len(data) - len(next)
+		}
+	case length&0x80 != 0:
+		n := length & 0x7F
+		if n > 4 || i+n > len(data) {
+			return nil, nil, false, nil, errBER
+		}
+		length = 0
+		for _, b := range data[i : i+n] {
+			length = length<<8 | int(b)
+		}
+		i += n
+	}
+	if length < 0 || i+length > len(data) {
+		return nil, nil, false, nil, errBER
+	}
+	return tag, data[i : i+length], constructed, data[i+length:], nil
+}
+
+// derElement encodes an element with a definite length
+func derElement(tag, content []byte) []byte {
+	res := append([]byte{}, tag...)
+	switch n := len(content); {
+	case n < 0x80:
+		res = append(res, byte(n))
+	default:
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		res = append(res, 0x80|byte(len(length)))
+		res = append(res, length...)
+	}
+	return append(res, content...)
+}
+
+// Attributes of signer infos and algorithms of signatures and enveloped data
+var (
+	oidAttrContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAOAEP       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidRSASHA1       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidRSASHA256     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidRSASHA384     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidRSASHA512     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSASHA1     = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSASHA256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSASHA384   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSASHA512   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidECPublicKey   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type oaepParams struct {
+	Hash pkix.AlgorithmIdentifier `asn1:"explicit,optional,tag:0"`
+}
+
+// envelopedData decodes the content of an EnvelopedData content info
+func (ci *contentInfo) envelopedData() (*envelopedData, error) {
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, err
+	}
+	return &ed, nil
+}
+
+// identifies reports whether a SignerIdentifier or RecipientIdentifier designates cert
+func identifies(id asn1.RawValue, cert *x509.Certificate) bool {
+	if id.Class == asn1.ClassContextSpecific && id.Tag == 0 {
+		return bytes.Equal(cert.SubjectKeyId, id.Bytes)
+	}
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(id.FullBytes, &ias); err != nil {
+		return false
+	}
+	return bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.SerialNumber) == 0
+}
+
+// content returns the encrypted content, which BER encoders may split into several OCTET STRINGs
+func (eci *encryptedContentInfo) content() []byte {
+	if !eci.EncryptedContent.IsCompound {
+		return eci.EncryptedContent.Bytes
+	}
+	var res []byte
+	for rest := eci.EncryptedContent.Bytes; len(rest) > 0; {
+		var chunk []byte
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &chunk); err != nil {
+			return nil
+		}
+		res = append(res, chunk...)
+	}
+	return res
+}
@@ -0,0 +1,524 @@
+package msgparser
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// Errors returned by UnwrapSMIME
+var (
+	ErrNotSMIME       = errors.New("smime: message is neither signed nor encrypted")
+	ErrSMIMEEncrypted = errors.New("smime: message is encrypted")
+	ErrSMIMEMalformed = errors.New("smime: malformed message")
+
+	ErrSMIMENotRecipient = errors.New("smime: certificate is not a recipient of the message")
+	ErrSMIMEUnsupported  = errors.New("smime: unsupported algorithm")
+)
+
+// maxSMIMEWrapLevels is the number of nested MIME entities and PKCS #7 structures unwrapped at most
+const maxSMIMEWrapLevels = 8
+
+// SMIMEMessage is the content of an S/MIME signed message (IPM.Note.SMIME and IPM.Note.SMIME.MultipartSigned)
+type SMIMEMessage struct {
+	Message      *models.Message     // The inner message: the envelope of the outer message with the body and attachments of the signed content
+	Encrypted    bool                // Whether the message was encrypted, see DecryptSMIME
+	Detached     bool                // Whether the message is clear signed (multipart/signed) rather than opaque signed (application/pkcs7-mime)
+	Content      []byte              // The MIME entity that was signed, exactly as it was signed
+	Signers      []*x509.Certificate // Certificates of the signers, in the order of their signatures
+	Certificates []*x509.Certificate // Every certificate the signatures carry, including the signers and their issuers
+
+	signatures []smimeSignature
+	cert       *x509.Certificate // Recipient certificate and key enveloped layers are decrypted with
+	key        crypto.Decrypter
+}
+
+// smimeSignature is one signed layer of a message
+type smimeSignature struct {
+	data    *signedData
+	content []byte
+	certs   []*x509.Certificate
+}
+
+// IsSMIME reports whether the message class is an S/MIME class, whose content is kept in a single attachment
+func IsSMIME(msg *models.Message) bool {
+	class := strings.ToLower(msg.MessageClass)
+	return class == "ipm.note.smime" || strings.HasPrefix(class, "ipm.note.smime.")
+}
+
+// UnwrapSMIME decodes the S/MIME attachment of a signed message into its inner message and signer certificates.
+// It returns ErrNotSMIME for other messages and ErrSMIMEEncrypted for encrypted ones. Signatures are not verified.
+func UnwrapSMIME(msg *models.Message) (*SMIMEMessage, error) {
+	return unwrapSMIME(msg, &SMIMEMessage{})
+}
+
+// DecryptSMIME is UnwrapSMIME for encrypted messages: enveloped layers are decrypted with key, the private key of cert,
+// which must be one of the recipients. RSA key transport with AES-CBC or Triple DES content encryption is supported.
+func DecryptSMIME(msg *models.Message, cert *x509.Certificate, key crypto.Decrypter) (*SMIMEMessage, error) {
+	return unwrapSMIME(msg, &SMIMEMessage{cert: cert, key: key})
+}
+
+// unwrapSMIME unwraps the S/MIME attachment of msg into s
+func unwrapSMIME(msg *models.Message, s *SMIMEMessage) (*SMIMEMessage, error) {
+	att := smimeAttachment(msg)
+	if att == nil {
+		return nil, ErrNotSMIME
+	}
+	var err error
+	if mimeType := strings.ToLower(att.MimeType); strings.Contains(mimeType, "pkcs7") || len(att.Data) > 0 && att.Data[0] == 0x30 {
+		// IPM.Note.SMIME keeps the bare PKCS #7 content
+		err = s.unwrapPKCS7(msg, att.Data, 0)
+	} else {
+		err = s.unwrapEntity(msg, att.Data, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// smimeAttachment returns the attachment holding the S/MIME content of msg, or nil
+func smimeAttachment(msg *models.Message) *models.Attachment {
+	for i := range msg.Attachments {
+		att := &msg.Attachments[i]
+		switch strings.ToLower(att.MimeType) {
+		case "multipart/signed", "application/pkcs7-mime", "application/x-pkcs7-mime":
+			return att
+		}
+	}
+	if IsSMIME(msg) && len(msg.Attachments) == 1 {
+		return &msg.Attachments[0]
+	}
+	return nil
+}
+
+// unwrapEntity unwraps a MIME entity, headers included, until it reaches content that is neither signed nor encrypted
+func (s *SMIMEMessage) unwrapEntity(msg *models.Message, raw []byte, level int) error {
+	if level > maxSMIMEWrapLevels {
+		return ErrSMIMEMalformed
+	}
+	entity, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return ErrSMIMEMalformed
+	}
+	header := textproto.MIMEHeader(entity.Header)
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/signed":
+		body, _ := ioutil.ReadAll(entity.Body)
+		parts := splitMultipart(body, params["boundary"])
+		if len(parts) != 2 {
+			return ErrSMIMEMalformed
+		}
+		sigEntity, err := mail.ReadMessage(bytes.NewReader(parts[1]))
+		if err != nil {
+			return ErrSMIMEMalformed
+		}
+		sig, err := ioutil.ReadAll(decodeTransferEncoding(sigEntity.Header.Get("Content-Transfer-Encoding"), sigEntity.Body))
+		if err != nil {
+			return ErrSMIMEMalformed
+		}
+		ci, err := parseContentInfo(sig)
+		if err != nil || !ci.ContentType.Equal(oidSignedData) {
+			return ErrSMIMEMalformed
+		}
+		if err := s.addSignature(ci, parts[0]); err != nil {
+			return err
+		}
+		s.Detached = true
+		return s.unwrapEntity(msg, parts[0], level+1)
+	case "application/pkcs7-mime", "application/x-pkcs7-mime":
+		data, err := ioutil.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), entity.Body))
+		if err != nil {
+			return ErrSMIMEMalformed
+		}
+		return s.unwrapPKCS7(msg, data, level+1)
+	}
+
+	inner := *msg
+	inner.MessageClass = "IPM.Note"
+	inner.BodyPlainText, inner.BodyHTML = "", ""
+	inner.Attachments = nil
+	inner.Properties = make(map[int64]interface{}, len(msg.Properties))
+	for id, v := range msg.Properties {
+		inner.Properties[id] = v
+	}
+	if err := parseMimePart(&inner, header, entity.Body); err != nil {
+		return err
+	}
+	s.Message = &inner
+	return nil
+}
+
+// unwrapPKCS7 unwraps the content of an opaque signed or enveloped PKCS #7 structure
+func (s *SMIMEMessage) unwrapPKCS7(msg *models.Message, data []byte, level int) error {
+	ci, err := parseContentInfo(data)
+	if err != nil {
+		return ErrSMIMEMalformed
+	}
+	switch {
+	case ci.ContentType.Equal(oidSignedData):
+		sd, err := ci.signedData()
+		if err != nil || len(sd.EncapContentInfo.Content) == 0 {
+			return ErrSMIMEMalformed
+		}
+		if err := s.addSignature(ci, sd.EncapContentInfo.Content); err != nil {
+			return err
+		}
+		return s.unwrapEntity(msg, sd.EncapContentInfo.Content, level+1)
+	case ci.ContentType.Equal(oidEnvelopedData):
+		if s.key == nil {
+			return ErrSMIMEEncrypted
+		}
+		content, err := s.decrypt(ci)
+		if err != nil {
+			return err
+		}
+		s.Encrypted = true
+		return s.unwrapEntity(msg, content, level+1)
+	}
+	return ErrSMIMEMalformed
+}
+
+// addSignature records a signed layer with the certificates of its signers
+func (s *SMIMEMessage) addSignature(ci *contentInfo, content []byte) error {
+	sd, err := ci.signedData()
+	if err != nil {
+		return ErrSMIMEMalformed
+	}
+	certs, err := sd.certificates()
+	if err != nil {
+		return ErrSMIMEMalformed
+	}
+	s.Content = content
+	s.Certificates = append(s.Certificates, certs...)
+	for _, si := range sd.SignerInfos {
+		if cert := si.signer(certs); cert != nil {
+			s.Signers = append(s.Signers, cert)
+		}
+	}
+	s.signatures = append(s.signatures, smimeSignature{data: sd, content: content, certs: certs})
+	return nil
+}
+
+// splitMultipart returns the raw body parts of a multipart entity, without the line break that precedes each delimiter
+// as RFC 2046 attaches it to the delimiter, so that the parts of multipart/signed keep the exact bytes that were signed
+func splitMultipart(body []byte, boundary string) [][]byte {
+	if boundary == "" {
+		return nil
+	}
+	delimiter := []byte("--" + boundary)
+	var parts [][]byte
+	start := -1
+	for pos := 0; pos < len(body); {
+		end := bytes.IndexByte(body[pos:], '\n')
+		next := len(body)
+		if end >= 0 {
+			next = pos + end + 1
+		}
+		line := bytes.TrimRight(body[pos:next], "\r\n")
+		if bytes.HasPrefix(line, delimiter) {
+			if start >= 0 {
+				part := body[start:pos]
+				part = bytes.TrimSuffix(part, []byte("\n"))
+				part = bytes.TrimSuffix(part, []byte("\r"))
+				parts = append(parts, part)
+			}
+			if bytes.HasPrefix(line[len(delimiter):], []byte("--")) {
+				break
+			}
+			start = next
+		}
+		pos = next
+	}
+	return parts
+}
+
+// SignatureStatus is the outcome of the verification of a signature
+type SignatureStatus int
+
+// Signature statuses
+const (
+	SignatureValid          SignatureStatus = iota // The signature matches the content and the signer chains to a trusted root
+	SignatureInvalid                               // The content or the signed attributes were modified after signing
+	SignatureUntrusted                             // The signature matches but the signer does not chain to a trusted root
+	SignatureExpired                               // The signature matches but the signer certificate was not valid at signing time
+	SignatureSignerNotFound                        // The signature does not carry the certificate of its signer
+	SignatureUnsupported                           // The digest or signature algorithm is not supported
+)
+
+// String returns the name of the status
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureValid:
+		return "valid"
+	case SignatureInvalid:
+		return "invalid"
+	case SignatureUntrusted:
+		return "untrusted"
+	case SignatureExpired:
+		return "expired"
+	case SignatureSignerNotFound:
+		return "signer not found"
+	case SignatureUnsupported:
+		return "unsupported"
+	}
+	return "unknown"
+}
+
+// SignatureResult is the verification result of one signer of a message
+type SignatureResult struct {
+	Status      SignatureStatus
+	Signer      *x509.Certificate // Nil if the signature does not carry it
+	Name        string            // Common name of the signer
+	Email       string            // First email address of the signer certificate
+	SigningTime time.Time         // Signing time attribute, zero if the signer did not include it
+	Err         error             // Why the status is not SignatureValid
+}
+
+// Verify checks every signature of the message against roots and returns one result per signer, outer layers first.
+// It never accesses the network: intermediate certificates must be carried by the signatures or added to roots, and
+// revocation is not checked. Certificates are checked at the signing time when the signature has one. A nil roots
+// trusts no certificate, unlike x509.VerifyOptions: every signer is then SignatureUntrusted.
+func (s *SMIMEMessage) Verify(roots *x509.CertPool) []SignatureResult {
+	if roots == nil {
+		roots = x509.NewCertPool()
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range s.Certificates {
+		intermediates.AddCert(cert)
+	}
+	var results []SignatureResult
+	for _, sig := range s.signatures {
+		for _, si := range sig.data.SignerInfos {
+			results = append(results, verifySigner(si, sig, roots, intermediates))
+		}
+	}
+	return results
+}
+
+// Valid reports whether the message is signed and every signature is valid against roots
+func (s *SMIMEMessage) Valid(roots *x509.CertPool) bool {
+	results := s.Verify(roots)
+	for _, r := range results {
+		if r.Status != SignatureValid {
+			return false
+		}
+	}
+	return len(results) > 0
+}
+
+// verifySigner verifies the signature of one signer info over the content of its layer
+func verifySigner(si signerInfo, sig smimeSignature, roots, intermediates *x509.CertPool) SignatureResult {
+	res := SignatureResult{Signer: si.signer(sig.certs)}
+	if res.Signer == nil {
+		res.Status, res.Err = SignatureSignerNotFound, errors.New("smime: signer certificate not found")
+		return res
+	}
+	res.Name = res.Signer.Subject.CommonName
+	if len(res.Signer.EmailAddresses) > 0 {
+		res.Email = res.Signer.EmailAddresses[0]
+	}
+	hash, ok := digestHash(si.DigestAlgorithm.Algorithm)
+	if !ok {
+		res.Status, res.Err = SignatureUnsupported, ErrSMIMEUnsupported
+		return res
+	}
+
+	signed := sig.content
+	if len(si.SignedAttrs.Bytes) > 0 {
+		var digest []byte
+		for rest := si.SignedAttrs.Bytes; len(rest) > 0; {
+			var attr attribute
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &attr); err != nil || len(attr.Values) == 0 {
+				res.Status, res.Err = SignatureInvalid, ErrSMIMEMalformed
+				return res
+			}
+			switch {
+			case attr.Type.Equal(oidAttrMessageDigest):
+				asn1.Unmarshal(attr.Values[0].FullBytes, &digest)
+			case attr.Type.Equal(oidAttrSigningTime):
+				asn1.Unmarshal(attr.Values[0].FullBytes, &res.SigningTime)
+			}
+		}
+		if !bytes.Equal(digest, digestOf(hash, sig.content)) && !bytes.Equal(digest, digestOf(hash, canonicalLineEndings(sig.content))) {
+			res.Status, res.Err = SignatureInvalid, errors.New("smime: message digest does not match the content")
+			return res
+		}
+		// The signature covers the DER encoding of the attributes as a SET, not with their implicit [0] tag
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	}
+	err := checkSignature(res.Signer, si.SignatureAlgorithm.Algorithm, hash, signed, si.Signature)
+	if err != nil && err != ErrSMIMEUnsupported && len(si.SignedAttrs.Bytes) == 0 {
+		if checkSignature(res.Signer, si.SignatureAlgorithm.Algorithm, hash, canonicalLineEndings(signed), si.Signature) == nil {
+			err = nil
+		}
+	}
+	switch {
+	case err == ErrSMIMEUnsupported:
+		res.Status, res.Err = SignatureUnsupported, err
+		return res
+	case err != nil:
+		res.Status, res.Err = SignatureInvalid, err
+		return res
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   res.SigningTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	if _, err := res.Signer.Verify(opts); err != nil {
+		res.Status, res.Err = SignatureUntrusted, err
+		if invalid, ok := err.(x509.CertificateInvalidError); ok && invalid.Reason == x509.Expired {
+			res.Status = SignatureExpired
+		}
+		return res
+	}
+	res.Status = SignatureValid
+	return res
+}
+
+// digestHash returns the hash function of a digest algorithm
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, true
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// digestOf returns the digest of data
+func digestOf(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// checkSignature verifies an RSA PKCS #1 v1.5 or ECDSA signature made by cert over data.
+// Unlike x509.Certificate.CheckSignature it accepts SHA-1, which older S/MIME clients sign with.
+func checkSignature(cert *x509.Certificate, algorithm asn1.ObjectIdentifier, hash crypto.Hash, data, signature []byte) error {
+	digest := digestOf(hash, data)
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		for _, oid := range []asn1.ObjectIdentifier{oidRSAEncryption, oidRSASHA1, oidRSASHA256, oidRSASHA384, oidRSASHA512} {
+			if algorithm.Equal(oid) {
+				return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+			}
+		}
+	case *ecdsa.PublicKey:
+		for _, oid := range []asn1.ObjectIdentifier{oidECPublicKey, oidECDSASHA1, oidECDSASHA256, oidECDSASHA384, oidECDSASHA512} {
+			if algorithm.Equal(oid) {
+				if !ecdsa.VerifyASN1(pub, digest, signature) {
+					return errors.New("smime: ECDSA verification failure")
+				}
+				return nil
+			}
+		}
+	}
+	return ErrSMIMEUnsupported
+}
+
+// canonicalLineEndings converts bare LF line endings to CRLF, the canonical form S/MIME content is signed in
+func canonicalLineEndings(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// decrypt decrypts the content of an EnvelopedData content info with the key of the recipient
+func (s *SMIMEMessage) decrypt(ci *contentInfo) ([]byte, error) {
+	ed, err := ci.envelopedData()
+	if err != nil {
+		return nil, ErrSMIMEMalformed
+	}
+	var recipient *keyTransRecipientInfo
+	for _, raw := range ed.RecipientInfos {
+		var ktri keyTransRecipientInfo
+		// Key agreement and other kinds of recipient infos are tagged, key transport is a plain SEQUENCE
+		if raw.Class != asn1.ClassUniversal {
+			continue
+		}
+		if _, err := asn1.Unmarshal(raw.FullBytes, &ktri); err == nil && s.cert != nil && identifies(ktri.RID, s.cert) {
+			recipient = &ktri
+			break
+		}
+	}
+	if recipient == nil {
+		return nil, ErrSMIMENotRecipient
+	}
+
+	var opts crypto.DecrypterOpts
+	switch alg := recipient.KeyEncryptionAlgorithm; {
+	case alg.Algorithm.Equal(oidRSAEncryption):
+		opts = &rsa.PKCS1v15DecryptOptions{}
+	case alg.Algorithm.Equal(oidRSAOAEP):
+		var params oaepParams
+		asn1.Unmarshal(alg.Parameters.FullBytes, &params)
+		hash := crypto.SHA1
+		if len(params.Hash.Algorithm) > 0 {
+			if hash, _ = digestHash(params.Hash.Algorithm); hash == 0 {
+				return nil, ErrSMIMEUnsupported
+			}
+		}
+		opts = &rsa.OAEPOptions{Hash: hash}
+	default:
+		return nil, ErrSMIMEUnsupported
+	}
+	key, err := s.key.Decrypt(rand.Reader, recipient.EncryptedKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	eci := ed.EncryptedContentInfo
+	var block cipher.Block
+	switch alg := eci.ContentEncryptionAlgorithm.Algorithm; {
+	case alg.Equal(oidAES128CBC), alg.Equal(oidAES192CBC), alg.Equal(oidAES256CBC):
+		block, err = aes.NewCipher(key)
+	case alg.Equal(oidDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(key)
+	default:
+		return nil, ErrSMIMEUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil || len(iv) != block.BlockSize() {
+		return nil, ErrSMIMEMalformed
+	}
+	data := eci.content()
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, ErrSMIMEMalformed
+	}
+	content := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(content, data)
+	padding := int(content[len(content)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, ErrSMIMEMalformed
+	}
+	return content[:len(content)-padding], nil
+}
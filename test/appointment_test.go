@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// newItem builds a message of the given class carrying the given named properties
+func newItem(class string, named map[models.NamedProperty]interface{}) *models.Message {
+	msg := &models.Message{
+		MessageClass:    class,
+		Properties:      make(map[int64]interface{}),
+		NamedProperties: make(map[int64]models.NamedProperty),
+	}
+	id := int64(0x8000)
+	for np, v := range named {
+		msg.NamedProperties[id] = np
+		msg.Properties[id] = v
+		id++
+	}
+	return msg
+}
+
+// writeAndParse writes msg as a .msg file and parses it back
+func writeAndParse(t *testing.T, msg *models.Message) *models.Message {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := msg.WriteMSG(&buf); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	res, err := msgparser.ParseReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	return res
+}
+
+func appt(lid uint32) models.NamedProperty {
+	return models.NamedProperty{GUID: models.PSETIDAppointment, ID: lid}
+}
+
+func common(lid uint32) models.NamedProperty {
+	return models.NamedProperty{GUID: models.PSETIDCommon, ID: lid}
+}
+
+func TestAppointment(t *testing.T) {
+	start := time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC)
+	msg := newItem("IPM.Appointment", map[models.NamedProperty]interface{}{
+		appt(0x820D):   start,
+		appt(0x820E):   start.Add(time.Hour),
+		appt(0x8213):   int32(60),
+		appt(0x8208):   "Room 4",
+		appt(0x8205):   int32(models.BusyStatusBusy),
+		appt(0x8217):   int32(models.AppointmentMeeting),
+		appt(0x8218):   int32(models.ResponseOrganized),
+		common(0x8503): true,
+		common(0x8501): int32(15),
+	})
+	msg.Subject = "Planning"
+	msg.FromName = "Alice Example"
+	msg.FromEmail = "alice@example.com"
+	msg.Recipients = []models.Recipient{
+		{Type: models.RecipientTo, DisplayName: "Alice Example", SMTPAddress: "alice@example.com", Properties: map[int64]interface{}{0x5FFD: int32(0x3), 0x5FFF: int32(1)}},
+		{Type: models.RecipientTo, DisplayName: "Bob Example", SMTPAddress: "bob@example.com", Properties: map[int64]interface{}{0x5FFD: int32(0x1), 0x5FFF: int32(3)}},
+		{Type: models.RecipientCC, DisplayName: "Carol Example", SMTPAddress: "carol@example.com", Properties: map[int64]interface{}{0x5FFD: int32(0x1)}},
+	}
+
+	a, ok := writeAndParse(t, msg).Appointment()
+	if !ok {
+		t.Fatalf("Message was not recognized as appointment")
+	}
+	if !a.Start.Equal(start) || !a.End.Equal(start.Add(time.Hour)) || a.Duration != time.Hour {
+		t.Errorf("Unexpected times %v - %v (%v)", a.Start, a.End, a.Duration)
+	}
+	if a.Location != "Room 4" || a.BusyStatus != models.BusyStatusBusy || !a.IsMeeting() || a.AllDay {
+		t.Errorf("Unexpected appointment %+v", a)
+	}
+	if a.Organizer.Email != "alice@example.com" {
+		t.Errorf("Unexpected organizer %+v", a.Organizer)
+	}
+	if len(a.Attendees) != 2 || a.Attendees[0].Status != models.ResponseAccepted || a.Attendees[1].Type != models.RecipientCC {
+		t.Errorf("Unexpected attendees %+v", a.Attendees)
+	}
+	if a.Reminder == nil || a.Reminder.MinutesBefore != 15 {
+		t.Errorf("Unexpected reminder %+v", a.Reminder)
+	}
+
+	note, err := msgparser.ParseMsgFile("test.msg")
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	if _, ok := note.Appointment(); ok {
+		t.Errorf("A note was returned as appointment")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/binary"
+	"runtime"
+	"testing"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// uncompressedRTF wraps an RTF document in a PR_RTF_COMPRESSED value without compression
+func uncompressedRTF(rtf string) []byte {
+	data := make([]byte, 16, 16+len(rtf))
+	binary.LittleEndian.PutUint32(data, uint32(len(rtf)+12))
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(rtf)))
+	copy(data[8:], "MELA")
+	return append(data, rtf...)
+}
+
+const encapsulatedHTML = `{\rtf1\ansi\ansicpg1252\fromhtml1 \deff0{\fonttbl{\f0\fswiss Arial;}}
+{\*\htmltag19 <html>}{\*\htmltag34 <head>}{\*\htmltag41 </head>}{\*\htmltag50 <body>}
+{\*\htmltag64 <p>}\htmlrtf {\htmlrtf0 Caf\'e9 \u8364?5 \{ok\}{\*\htmltag84 <br>}\htmlrtf \line
+\htmlrtf0 Bye{\*\htmltag72 </p>}\htmlrtf \par
+\htmlrtf0 {\*\htmltag58 </body>}{\*\htmltag27 </html>}}`
+
+func TestDecompressRTF(t *testing.T) {
+	// Example of MS-OXRTFCP 3.1.1
+	compressed := []byte{
+		0x2d, 0x00, 0x00, 0x00, 0x2b, 0x00, 0x00, 0x00, 0x4c, 0x5a, 0x46, 0x75, 0xf1, 0xc5, 0xc7, 0xa7,
+		0x03, 0x00, 0x0a, 0x00, 0x72, 0x63, 0x70, 0x67, 0x31, 0x32, 0x35, 0x42, 0x32, 0x0a, 0xf3, 0x20,
+		0x68, 0x65, 0x6c, 0x09, 0x00, 0x20, 0x62, 0x77, 0x05, 0xb0, 0x6c, 0x64, 0x7d, 0x0a, 0x80, 0x0f,
+		0xa0,
+	}
+	rtf, err := models.DecompressRTF(compressed)
+	if err != nil {
+		t.Fatalf("Failed to decompress: %v", err)
+	}
+	if string(rtf) != "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n" {
+		t.Errorf("Unexpected RTF %q", rtf)
+	}
+	if text := models.RTFToText(rtf); text != "hello world" {
+		t.Errorf("Unexpected text %q", text)
+	}
+
+	if rtf, err := models.DecompressRTF(uncompressedRTF(encapsulatedHTML)); err != nil || string(rtf) != encapsulatedHTML {
+		t.Errorf("Unexpected uncompressed RTF %q: %v", rtf, err)
+	}
+	// A corrupt header declaring a huge size does not allocate it
+	bogus := append([]byte{0x12, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0}, compressed[8:16]...)
+	bogus = append(bogus, 0x00, 'x')
+	if rtf, err := models.DecompressRTF(bogus); err != nil || string(rtf) != "x" {
+		t.Errorf("Unexpected RTF %q: %v", rtf, err)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	models.DecompressRTF(bogus)
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Decompressing allocated %d bytes", allocated)
+	}
+	if rtf, err := models.DecompressRTF(compressed); err != nil || len(rtf) != 0x2b {
+		t.Errorf("Output should stop at the declared size: %q %v", rtf, err)
+	}
+	if _, err := models.DecompressRTF([]byte("LZFu")); err != models.ErrInvalidRTF {
+		t.Errorf("Expected ErrInvalidRTF, got %v", err)
+	}
+
+	html, ok := models.RTFToHTML([]byte(encapsulatedHTML))
+	if want := "<html><head></head><body><p>Café €5 {ok}<br>Bye</p></body></html>"; !ok || html != want {
+		t.Errorf("Unexpected HTML %q", html)
+	}
+	if _, ok := models.RTFToHTML(rtf); ok {
+		t.Errorf("Plain RTF should not encapsulate HTML")
+	}
+}
+
+func TestBodySelection(t *testing.T) {
+	// The RTF body is in sync, so it is preferred over a stale PR_HTML
+	msg := newItem("IPM.Note", nil)
+	msg.Properties[0x1009] = uncompressedRTF(encapsulatedHTML) // PR_RTF_COMPRESSED
+	msg.Properties[0x0E1F] = true                              // PR_RTF_IN_SYNC
+	msg.Properties[0x1013] = []byte("<p>Old draft</p>")        // PR_HTML
+	got := writeAndParse(t, msg)
+	if got.BodySource != models.BodySourceRTF || got.ConvertedBodyHTML != got.BodyHTML || got.BodyPlainText != "Café €5 {ok}\nBye" {
+		t.Errorf("Unexpected RTF body %v %q / %q", got.BodySource, got.BodyPlainText, got.BodyHTML)
+	}
+
+	// PR_NATIVE_BODY_INFO takes precedence over PR_RTF_IN_SYNC
+	msg.Properties[0x1016] = int32(3)
+	if got := writeAndParse(t, msg); got.BodySource != models.BodySourceHTML || got.BodyHTML != "<p>Old draft</p>" {
+		t.Errorf("Unexpected HTML body %v %q", got.BodySource, got.BodyHTML)
+	}
+
+	// Plain text is not copied to the HTML body
+	msg = newItem("IPM.Note", nil)
+	msg.BodyPlainText = "Just text"
+	if got := writeAndParse(t, msg); got.BodySource != models.BodySourcePlainText || got.BodyHTML != "" || got.BodyPlainText != "Just text" {
+		t.Errorf("Unexpected plain text body %v %q / %q", got.BodySource, got.BodyPlainText, got.BodyHTML)
+	}
+
+	// Properties that are not bodies are not used as one, and no placeholder is set
+	msg = newItem("IPM.Note", nil)
+	msg.Properties[0x0C25] = []byte("Not a body at all, but long enough") // PR_PARENT_KEY
+	if got := writeAndParse(t, msg); got.BodySource != models.BodySourceNone || got.HasBody() {
+		t.Errorf("Unexpected body %v %q / %q", got.BodySource, got.BodyPlainText, got.BodyHTML)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func address(lid uint32) models.NamedProperty {
+	return models.NamedProperty{GUID: models.PSETIDAddress, ID: lid}
+}
+
+func TestContact(t *testing.T) {
+	msg := newItem("IPM.Contact", map[models.NamedProperty]interface{}{
+		address(0x8080): "Bob Example (bob@example.com)",
+		address(0x8082): "SMTP",
+		address(0x8083): "bob@example.com",
+		address(0x8090): "Bob Example (Exchange)",
+		address(0x8092): "EX",
+		address(0x8093): "/o=Example/ou=Exchange/cn=Recipients/cn=bob",
+		address(0x8094): "robert@example.com",
+		address(0x8045): "1 Main Street",
+		address(0x8046): "Springfield",
+		address(0x8049): "USA",
+		address(0x80DE): time.Date(1980, 5, 17, 0, 0, 0, 0, time.UTC),
+		address(0x8015): true,
+		models.NamedProperty{GUID: models.PSPublicStrings, Name: "Keywords"}: []string{"Friends", "Work; misc"},
+	})
+	msg.Subject = "Bob Example"
+	msg.BodyPlainText = "Met at the conference"
+	msg.Properties[0x3001] = "Bob Example"
+	msg.Properties[0x3A06] = "Bob"
+	msg.Properties[0x3A11] = "Example"
+	msg.Properties[0x3A16] = "Example, Inc."
+	msg.Properties[0x3A17] = "Engineer"
+	msg.Properties[0x3A1C] = "+1 555 0100"
+	msg.Properties[0x3A08] = "+1 555 0101"
+	msg.Properties[0x3A5D] = "2 Elm Street"
+	msg.Properties[0x3A59] = "Shelbyville"
+	msg.Attachments = []models.Attachment{{FileName: "ContactPicture.jpg", Method: models.AttachByValue, Data: []byte{0xFF, 0xD8, 0xFF}, Properties: map[int64]interface{}{}}}
+
+	c, ok := writeAndParse(t, msg).Contact()
+	if !ok {
+		t.Fatalf("Message was not recognized as contact")
+	}
+	if c.GivenName != "Bob" || c.Surname != "Example" || c.Company != "Example, Inc." || c.JobTitle != "Engineer" {
+		t.Errorf("Unexpected contact %+v", c)
+	}
+	if len(c.Emails) != 2 || c.Emails[0].Address != "bob@example.com" || c.Emails[1].Address != "robert@example.com" || c.Emails[1].AddressType != "EX" {
+		t.Errorf("Unexpected emails %+v", c.Emails)
+	}
+	if len(c.Phones) != 2 || c.Phones[0].Kind != "business" || c.Phones[1].Kind != "mobile" {
+		t.Errorf("Unexpected phones %+v", c.Phones)
+	}
+	if len(c.Addresses) != 2 || c.Addresses[0].Kind != "home" || c.Addresses[1].City != "Springfield" {
+		t.Errorf("Unexpected addresses %+v", c.Addresses)
+	}
+	if !c.Birthday.Equal(time.Date(1980, 5, 17, 0, 0, 0, 0, time.UTC)) || c.Photo == nil || len(c.Categories) != 2 {
+		t.Errorf("Unexpected birthday %v, photo %v or categories %v", c.Birthday, c.Photo, c.Categories)
+	}
+
+	var buf bytes.Buffer
+	if err := c.WriteVCard(&buf); err != nil {
+		t.Fatalf("Failed to write vCard: %v", err)
+	}
+	vcard := strings.ReplaceAll(buf.String(), "\r\n ", "")
+	for _, line := range []string{
+		"BEGIN:VCARD\r\nVERSION:4.0\r\n",
+		"FN:Bob Example\r\n",
+		"N:Example;Bob;;;\r\n",
+		`ORG:Example\, Inc.;` + "\r\n",
+		"EMAIL;PREF=1:bob@example.com\r\n",
+		"EMAIL:robert@example.com\r\n",
+		`TEL;TYPE="cell,voice":+1 555 0100` + "\r\n",
+		"ADR;TYPE=home:;;2 Elm Street;Shelbyville;;;\r\n",
+		"ADR;TYPE=work:;;1 Main Street;Springfield;;;USA\r\n",
+		"BDAY:19800517\r\n",
+		`CATEGORIES:Friends,Work\; misc` + "\r\n",
+		"NOTE:Met at the conference\r\n",
+		"PHOTO:data:image/jpeg;base64,/9j/\r\n",
+		"END:VCARD\r\n",
+	} {
+		if !strings.Contains(vcard, line) {
+			t.Errorf("vCard lacks %q:\n%s", line, vcard)
+		}
+	}
+}
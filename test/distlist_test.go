@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// oneOffEntryID builds a Unicode one-off entry id
+func oneOffEntryID(name, addrType, address string) []byte {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4))
+	buf.Write([]byte{0x81, 0x2B, 0x1F, 0xA4, 0xBE, 0xA3, 0x10, 0x19, 0x9D, 0x6E, 0x00, 0xDD, 0x01, 0x0F, 0x54, 0x02})
+	binary.Write(&buf, binary.LittleEndian, []uint16{0, 0x9001})
+	for _, s := range []string{name, addrType, address} {
+		binary.Write(&buf, binary.LittleEndian, append(utf16.Encode([]rune(s)), 0))
+	}
+	return buf.Bytes()
+}
+
+// wrappedEntryID wraps an entry id the way PidLidDistributionListMembers stores contacts and lists of the mailbox
+func wrappedEntryID(kind models.DistListMemberKind, embedded []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4))
+	buf.Write([]byte{0xC0, 0x91, 0xAD, 0xD3, 0x51, 0x9D, 0xCF, 0x11, 0xA4, 0xA9, 0x00, 0xAA, 0x00, 0x47, 0xFA, 0xA4})
+	buf.WriteByte(0x80 | byte(kind))
+	buf.Write(embedded)
+	return buf.Bytes()
+}
+
+func TestDistList(t *testing.T) {
+	bob := oneOffEntryID("Bob Example", "SMTP", "bob@example.com")
+	team := oneOffEntryID("Team", "MAPIPDL", "Unknown")
+	carol := oneOffEntryID("Carol Example", "SMTP", "carol@example.com")
+	msg := newItem("IPM.DistList", map[models.NamedProperty]interface{}{
+		address(0x8053): "Friends",
+		address(0x8055): [][]byte{wrappedEntryID(models.MemberContact, make([]byte, 46)), wrappedEntryID(models.MemberDistList, make([]byte, 46)), carol},
+		address(0x8054): [][]byte{bob, team, carol},
+	})
+
+	d, ok := writeAndParse(t, msg).DistList()
+	if !ok {
+		t.Fatalf("Message was not recognized as distribution list")
+	}
+	if d.Name != "Friends" || len(d.Members) != 3 {
+		t.Fatalf("Unexpected list %+v", d)
+	}
+	if m := d.Members[0]; m.DisplayName != "Bob Example" || m.Address != "bob@example.com" || m.AddressType != "SMTP" || m.Kind != models.MemberContact || m.IsList() {
+		t.Errorf("Unexpected contact member %+v", m)
+	}
+	if m := d.Members[1]; m.DisplayName != "Team" || !m.IsList() {
+		t.Errorf("Unexpected nested list %+v", m)
+	}
+	if m := d.Members[2]; m.Address != "carol@example.com" || m.Kind != models.MemberOneOff {
+		t.Errorf("Unexpected one-off member %+v", m)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+)
+
+func TestDumpMsgFile(t *testing.T) {
+	dump, err := msgparser.DumpMsgFile("test_2.msg")
+	if err != nil {
+		t.Fatalf("Failed to dump file: %v", err)
+	}
+	if dump.Kind != "storage" || len(dump.Children) == 0 {
+		t.Fatalf("Unexpected root %+v", dump)
+	}
+
+	var buf bytes.Buffer
+	if err := dump.WriteText(&buf); err != nil {
+		t.Fatalf("Failed to render dump: %v", err)
+	}
+	text := buf.String()
+	for _, want := range []string{
+		"__properties_version1.0 (stream",
+		"0x0037001F PidTagSubject PT_UNICODE = \"original\"",
+		"0x00390040 PidTagClientSubmitTime PT_SYSTIME flags=0x6 = 2024-09-06T09:45:32Z",
+		"0x8001001F {00020386-0000-0000-c000-000000000046} \"content-type\" PT_UNICODE",
+		"__substg1.0_3701000D (storage",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Dump does not contain %q", want)
+		}
+	}
+
+	data, err := json.Marshal(dump)
+	if err != nil {
+		t.Fatalf("Failed to marshal dump: %v", err)
+	}
+	if !strings.Contains(string(data), `"tag":"0x0037001F","name":"PidTagSubject","type":"PT_UNICODE"`) {
+		t.Errorf("JSON dump does not contain the subject property")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestParseEML(t *testing.T) {
+	f, err := os.Open("test.eml")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	msg, err := msgparser.ParseEML(f)
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	if msg.Subject != "Quarterly report – final" {
+		t.Errorf("Unexpected subject %q", msg.Subject)
+	}
+	if msg.FromName != "Alice Example" || msg.FromEmail != "alice@example.com" {
+		t.Errorf("Unexpected sender %q <%s>", msg.FromName, msg.FromEmail)
+	}
+	if len(msg.Recipients) != 3 {
+		t.Fatalf("Expected 3 recipients, got %d", len(msg.Recipients))
+	}
+	if msg.Recipients[2].Type != models.RecipientCC || msg.Recipients[2].DisplayName != "Daniél Example" {
+		t.Errorf("Unexpected CC recipient %+v", msg.Recipients[2])
+	}
+	if !strings.Contains(msg.BodyPlainText, "Grüße") {
+		t.Errorf("Plain text body was not decoded from iso-8859-1: %q", msg.BodyPlainText)
+	}
+	if len(msg.Attachments) != 2 {
+		t.Fatalf("Expected 2 attachments, got %d", len(msg.Attachments))
+	}
+	if string(msg.Attachments[0].Data) != "quarter,revenue\n1,100\n2,120\n" {
+		t.Errorf("Unexpected attachment content %q", msg.Attachments[0].Data)
+	}
+	if msg.Attachments[1].ContentID != "logo@example.com" {
+		t.Errorf("Unexpected content id %q", msg.Attachments[1].ContentID)
+	}
+	if len(msg.NamedProperties) != 2 {
+		t.Errorf("Expected X- headers to become 2 named properties, got %d", len(msg.NamedProperties))
+	}
+}
+
+func TestConvertEMLToMsg(t *testing.T) {
+	in, err := os.Open("test.eml")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer in.Close()
+
+	out := filepath.Join(t.TempDir(), "converted.msg")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := msgparser.ConvertEMLToMsg(in, f); err != nil {
+		t.Fatalf("Failed to convert file: %v", err)
+	}
+	f.Close()
+
+	msg, err := msgparser.ParseMsgFile(out)
+	if err != nil {
+		t.Fatalf("Failed to parse converted file: %v", err)
+	}
+	if msg.Subject != "Quarterly report – final" {
+		t.Errorf("Unexpected subject %q", msg.Subject)
+	}
+	if msg.FromEmail != "alice@example.com" {
+		t.Errorf("Unexpected sender %q", msg.FromEmail)
+	}
+	if msg.MessageID != "<20240105123456.1234@example.com>" {
+		t.Errorf("Unexpected message id %q", msg.MessageID)
+	}
+	if !strings.Contains(msg.BodyHTML, "cid:logo@example.com") {
+		t.Errorf("HTML body was not preserved: %q", msg.BodyHTML)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestRegisterPropertyHandler(t *testing.T) {
+	// PR_IMPORTANCE has no built-in handler
+	models.RegisterPropertyHandler(0x0017, func(msg *models.Message, value models.Value) error {
+		if msg.Extensions == nil {
+			msg.Extensions = make(map[string]interface{})
+		}
+		msg.Extensions["importance"] = value
+		return nil
+	})
+	defer models.RegisterPropertyHandler(0x0017, nil)
+
+	keywords := models.NamedProperty{GUID: models.PSPublicStrings, Name: "Keywords"}
+	models.RegisterNamedPropertyHandler(keywords, func(msg *models.Message, value models.Value) error {
+		if msg.Extensions == nil {
+			msg.Extensions = make(map[string]interface{})
+		}
+		msg.Extensions["keywords"] = value
+		return models.ErrKeepProperty
+	})
+	defer models.RegisterNamedPropertyHandler(keywords, nil)
+
+	msg, err := msgparser.ParseMsgFile("test_3.msg")
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	if msg.Extensions["importance"] != int32(1) {
+		t.Errorf("Unexpected importance %#v", msg.Extensions["importance"])
+	}
+	if _, ok := msg.Properties[0x0017]; ok {
+		t.Errorf("Consumed property was stored in Properties")
+	}
+	if _, ok := msg.Extensions["keywords"].([]string); !ok {
+		t.Errorf("Named property handler was not called: %#v", msg.Extensions["keywords"])
+	}
+	found := false
+	for id, np := range msg.NamedProperties {
+		if np == keywords {
+			_, found = msg.Properties[id]
+		}
+	}
+	if !found {
+		t.Errorf("Kept named property is missing from Properties")
+	}
+}
+
+func TestOverrideBuiltinHandler(t *testing.T) {
+	builtin := models.LookupPropertyHandler(0x0037)
+	models.RegisterPropertyHandler(0x0037, func(msg *models.Message, value models.Value) error {
+		if s, ok := value.(string); ok {
+			return builtin(msg, "[external] "+s)
+		}
+		return builtin(msg, value)
+	})
+	defer models.RegisterPropertyHandler(0x0037, builtin)
+
+	msg, err := msgparser.ParseMsgFile("test_2.msg")
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	if msg.Subject != "[external] original" {
+		t.Errorf("Unexpected subject %q", msg.Subject)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestHTMLToText(t *testing.T) {
+	body := `<html><head><style>p {color:red}</style><title>Ignored</title></head><body>
+<p class=MsoNormal>Hi Bob,<o:p></o:p></p>
+<p class=MsoNormal>The   figures are&nbsp;in &amp; <b>ready</b>.<br>Second line</p>
+<!--[if gte mso 9]><p>Only in Outlook</p><![endif]-->
+<span style="display: none">Preheader</span>
+<h2>Agenda</h2>
+<ol><li>Budget<ul><li>Travel</li><li>Hardware</li></ul></li><li>Hiring</li></ol>
+<table><tr><th>Item</th><th>Cost</th></tr><tr><td><p class=MsoNormal>Laptop</p></td><td>1 200 &euro;</td></tr></table>
+<p>See <a href="https://example.com/report">the report</a>, <a href="https://example.com">https://example.com</a>
+or <a href="mailto:bob@example.com">bob@example.com</a>.</p>
+<blockquote>Quoted<br>text</blockquote>
+<script>alert("no")</script>
+<pre>  keep
+    spacing</pre>
+</body></html>`
+	want := `Hi Bob,
+The figures are in & ready.
+Second line
+
+Agenda
+
+1. Budget
+  * Travel
+  * Hardware
+2. Hiring
+
+Item | Cost
+Laptop | 1 200 €
+
+See the report[1], https://example.com or bob@example.com.
+
+> Quoted
+> text
+
+  keep
+    spacing
+
+[1] https://example.com/report`
+	if got := models.HTMLToText(body); got != want {
+		t.Errorf("Unexpected text:\n%s", got)
+	}
+
+	msg := newItem("IPM.Note", nil)
+	msg.Properties[0x1013] = []byte(`<html><body><p>Only an <i>HTML</i> body here.</p></body></html>`) // PR_HTML
+	if got := writeAndParse(t, msg); got.BodyPlainText != "Only an HTML body here." {
+		t.Errorf("Unexpected plain text body %q", got.BodyPlainText)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestWriteICS(t *testing.T) {
+	start := time.Date(2024, 3, 4, 8, 30, 0, 0, time.UTC)
+	msg := newItem("IPM.Schedule.Meeting.Request", map[models.NamedProperty]interface{}{
+		appt(0x820D):    start,
+		appt(0x820E):    start.Add(time.Hour),
+		appt(0x8208):    "Room 4; second floor",
+		appt(0x8205):    int32(models.BusyStatusBusy),
+		appt(0x8217):    int32(models.AppointmentMeeting | models.AppointmentReceived),
+		appt(0x8201):    int32(2),
+		appt(0x8216):    recurrenceBlob(models.EndAfterOccurrences),
+		appt(0x8260):    tzDefinition("W. Europe Standard Time"),
+		common(0x8503):  true,
+		common(0x8501):  int32(10),
+		meeting(0x0003): globalObjectID(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), []byte("vCal-Uid\x01\x00\x00\x00planning@example.com\x00")),
+	})
+	msg.Subject = "Weekly planning, with a subject long enough to be folded across several content lines"
+	msg.FromName = "Alice Example"
+	msg.FromEmail = "alice@example.com"
+	msg.Recipients = []models.Recipient{
+		{Type: models.RecipientTo, DisplayName: "Example, Bob", SMTPAddress: "bob@example.com", Properties: map[int64]interface{}{0x5FFD: int32(0x1)}},
+		{Type: models.RecipientBCC, DisplayName: "Room 4", SMTPAddress: "room4@example.com", Properties: map[int64]interface{}{0x5FFD: int32(0x1)}},
+	}
+
+	a, ok := writeAndParse(t, msg).Appointment()
+	if !ok {
+		t.Fatalf("Meeting request was not recognized as appointment")
+	}
+	var buf bytes.Buffer
+	if err := a.WriteICS(&buf); err != nil {
+		t.Fatalf("Failed to write ICS: %v", err)
+	}
+	ics := buf.String()
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	for _, line := range []string{
+		"METHOD:REQUEST",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin",
+		"UID:planning@example.com\r\n",
+		"SEQUENCE:2",
+		`LOCATION:Room 4\; second floor`,
+		"DTSTART;TZID=Europe/Berlin:20240304T093000",
+		"DTEND;TZID=Europe/Berlin:20240304T103000",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10",
+		"EXDATE;TZID=Europe/Berlin:20240306T093000",
+		"ORGANIZER;CN=Alice Example:mailto:alice@example.com",
+		"ATTENDEE;CN=\"Example, Bob\";CUTYPE=INDIVIDUAL;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.com",
+		"ATTENDEE;CN=Room 4;CUTYPE=RESOURCE;ROLE=NON-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:room4@example.com",
+		"TRIGGER:-PT10M",
+		"RECURRENCE-ID;TZID=Europe/Berlin:20240311T093000",
+		"DTSTART;TZID=Europe/Berlin:20240311T103000",
+		"SUMMARY:New ✓",
+		"LOCATION:Room 9",
+	} {
+		if !strings.Contains(unfolded, line) {
+			t.Errorf("ICS lacks %q", line)
+		}
+	}
+	if strings.Count(ics, "BEGIN:VEVENT") != 2 {
+		t.Errorf("Expected the series and one exception:\n%s", ics)
+	}
+	for _, line := range strings.Split(ics, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line is not folded: %q", line)
+		}
+	}
+
+	msg.MessageClass = "IPM.Schedule.Meeting.Resp.Tent"
+	msg.FromName, msg.FromEmail = "Bob Example", "bob@example.com"
+	a, _ = writeAndParse(t, msg).Appointment()
+	buf.Reset()
+	if err := a.WriteICS(&buf); err != nil {
+		t.Fatalf("Failed to write ICS: %v", err)
+	}
+	if ics := buf.String(); !strings.Contains(ics, "METHOD:REPLY") || !strings.Contains(ics, "ATTENDEE;CN=Bob Example;PARTSTAT=TENTATIVE:mailto:bob@example.com") {
+		t.Errorf("Unexpected reply:\n%s", ics)
+	}
+}
+
+func TestWriteICSAllDay(t *testing.T) {
+	// An all-day event of an organizer in UTC+2, without time zone definition, and a reminder after its start
+	start := time.Date(2024, 3, 3, 22, 0, 0, 0, time.UTC)
+	msg := newItem("IPM.Appointment", map[models.NamedProperty]interface{}{
+		appt(0x820D):   start,
+		appt(0x820E):   start.Add(24 * time.Hour),
+		appt(0x8215):   true,
+		common(0x8503): true,
+		common(0x8501): int32(-5),
+	})
+	a, ok := writeAndParse(t, msg).Appointment()
+	if !ok || !a.AllDay {
+		t.Fatalf("Unexpected appointment %+v", a)
+	}
+	var buf bytes.Buffer
+	if err := a.WriteICS(&buf); err != nil {
+		t.Fatalf("Failed to write ICS: %v", err)
+	}
+	ics := buf.String()
+	for _, line := range []string{
+		"DTSTART;VALUE=DATE:20240304\r\n",
+		"DTEND;VALUE=DATE:20240305\r\n",
+		"TRIGGER:PT5M\r\n",
+	} {
+		if !strings.Contains(ics, line) {
+			t.Errorf("ICS lacks %q:\n%s", line, ics)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestResolveInlineImages(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	msg := newItem("IPM.Note", nil)
+	msg.BodyHTML = `<p style="background:url(cid:logo)"><img src="cid:image001.png@01DA6E2F.3C1B0A20"><img src="CID:image001.png%4001DA6E2F.3C1B0A20"><img src="cid:missing"></p>`
+	msg.Attachments = []models.Attachment{
+		{FileName: "image001.png", ContentID: "<image001.png@01DA6E2F.3C1B0A20>", Data: png, Properties: map[int64]interface{}{}},
+		{FileName: "logo.gif", Data: []byte("GIF89a"), Properties: map[int64]interface{}{0x3713: "logo"}},
+		{FileName: "report.pdf", MimeType: "application/pdf", Data: []byte("%PDF"), Properties: map[int64]interface{}{}},
+	}
+
+	var calls []string
+	body := msg.ResolveInlineImages(func(att *models.Attachment) string {
+		calls = append(calls, att.FileName)
+		return "/files/" + att.FileName + "?inline=1&v=2"
+	})
+	want := `<p style="background:url(/files/logo.gif?inline=1&amp;v=2)"><img src="/files/image001.png?inline=1&amp;v=2"><img src="/files/image001.png?inline=1&amp;v=2"><img src="cid:missing"></p>`
+	if body != want {
+		t.Errorf("Unexpected body %s", body)
+	}
+	if strings.Join(calls, ",") != "logo.gif,image001.png" {
+		t.Errorf("Unexpected callbacks %v", calls)
+	}
+
+	got := writeAndParse(t, msg)
+	for i, inline := range []bool{true, true, false} {
+		if got.Attachments[i].IsInline() != inline {
+			t.Errorf("Attachment %s has inline %v", got.Attachments[i].FileName, !inline)
+		}
+	}
+	if flags, _ := got.Attachments[0].Properties[0x3714].(int32); flags != models.AttachMHTMLRef {
+		t.Errorf("Unexpected attachment flags %d", flags)
+	}
+
+	got.BodyHTML = `<img src="cid:image001.png@01DA6E2F.3C1B0A20">`
+	if body := got.ResolveInlineImages(nil); body != `<img src="data:image/png;base64,iVBORw0KGgo=">` {
+		t.Errorf("Unexpected data URL %s", body)
+	}
+}
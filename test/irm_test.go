@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/yuphing-ong/outlook-msg-parser/cfb"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+const publishingLicense = `<XrML version="1.2" xmlns=""><BODY type="Microsoft Rights Label" version="3.0">` +
+	`<ISSUEDTIME>2024-03-04T09:30</ISSUEDTIME>` +
+	`<DESCRIPTOR><OBJECT><ID type="MS-GUID">{CF5CF348-A8D7-40D5-91EF-A600B88A395D}</ID>` +
+	`<NAME>LCID 1033:NAME Do Not Forward:DESCRIPTION Recipients can read this message, but cannot forward it.;LCID 1036:NAME Ne pas transférer:DESCRIPTION Lecture seule.;</NAME></OBJECT></DESCRIPTOR>` +
+	`<ISSUER><OBJECT type="MS-DRM-Server"><ID type="MS-GUID">{6A1F5F3B-0000-0000-0000-000000000000}</ID><NAME>RMS Example</NAME>` +
+	`<ADDRESS type="URL">https://rms.example.com/_wmcs/licensing</ADDRESS></OBJECT></ISSUER>` +
+	`<WORK><OBJECT type="Microsoft Office Document"><ID type="MS-GUID">{8E2D9C51-1111-2222-3333-444455556666}</ID></OBJECT>` +
+	`<METADATA><OWNER><OBJECT><ID type="Windows">S-1-5-21</ID><NAME>alice@example.com</NAME></OBJECT></OWNER></METADATA></WORK>` +
+	`</BODY><SIGNATURE><DIGEST/></SIGNATURE></XrML>`
+
+// rpmsg builds a compressed container whose DRM transform carries the publishing license
+func rpmsg(t *testing.T) []byte {
+	t.Helper()
+	root := cfb.New()
+	transform := root.AddStorage("\x06DataSpaces").AddStorage("TransformInfo").AddStorage("DRMTransform")
+	transform.AddStream("\x06Primary", append([]byte{0x58, 0, 0, 0, 1, 0, 0, 0}, publishingLicense...))
+	root.AddStream("\tDRMContent", bytes.Repeat([]byte{0xA5, 0x5A}, 3000))
+	var storage bytes.Buffer
+	if _, err := root.WriteTo(&storage); err != nil {
+		t.Fatalf("Failed to write compound file: %v", err)
+	}
+
+	res := []byte{0x76, 0xE8, 0x04, 0x60, 0xC4, 0x11, 0xE3, 0x86}
+	for data := storage.Bytes(); len(data) > 0; {
+		chunk := data[:min(4096, len(data))]
+		data = data[len(chunk):]
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(chunk)
+		zw.Close()
+		res = binary.LittleEndian.AppendUint32(res, 0x0FA0)
+		res = binary.LittleEndian.AppendUint32(res, uint32(len(chunk)))
+		res = binary.LittleEndian.AppendUint32(res, uint32(compressed.Len()))
+		res = append(res, compressed.Bytes()...)
+	}
+	return res
+}
+
+func TestRightsProtection(t *testing.T) {
+	msg := newItem("IPM.Note.rpmsg.Microsoft.Voicemail", nil)
+	msg.Subject = "Protected"
+	msg.Attachments = []models.Attachment{{FileName: "message.rpmsg", MimeType: "application/x-microsoft-rpmsg-message", Method: models.AttachByValue, Data: rpmsg(t), Properties: map[int64]interface{}{}}}
+
+	rp, ok := writeAndParse(t, msg).RightsProtection()
+	if !ok {
+		t.Fatalf("Message was not recognized as rights protected")
+	}
+	if rp.Err != nil || rp.License == nil {
+		t.Fatalf("Failed to decode license: %v", rp.Err)
+	}
+	if len(rp.Container.Content) != 6000 {
+		t.Errorf("Unexpected encrypted content of %d bytes", len(rp.Container.Content))
+	}
+	l := rp.License
+	if l.TemplateID != "{CF5CF348-A8D7-40D5-91EF-A600B88A395D}" || l.TemplateName != "Do Not Forward" || l.TemplateDescription != "Recipients can read this message, but cannot forward it." {
+		t.Errorf("Unexpected template %q %q %q", l.TemplateID, l.TemplateName, l.TemplateDescription)
+	}
+	if l.Owner != "alice@example.com" || l.IssuerName != "RMS Example" || l.IssuerURL != "https://rms.example.com/_wmcs/licensing" {
+		t.Errorf("Unexpected owner %q or issuer %q %q", l.Owner, l.IssuerName, l.IssuerURL)
+	}
+	if !l.IssuedTime.Equal(time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC)) || l.ContentID != "{8E2D9C51-1111-2222-3333-444455556666}" {
+		t.Errorf("Unexpected issued time %v or content id %q", l.IssuedTime, l.ContentID)
+	}
+
+	// Chunks that expand beyond their declared size, or declare a huge one, are rejected
+	var bomb bytes.Buffer
+	zw := zlib.NewWriter(&bomb)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+	for _, size := range []uint32{4096, 0xFFFFFFFF} {
+		data := []byte{0x76, 0xE8, 0x04, 0x60, 0xC4, 0x11, 0xE3, 0x86}
+		data = binary.LittleEndian.AppendUint32(data, 0x0FA0)
+		data = binary.LittleEndian.AppendUint32(data, size)
+		data = binary.LittleEndian.AppendUint32(data, uint32(bomb.Len()))
+		if _, err := models.ParseRPMSG(append(data, bomb.Bytes()...)); err == nil {
+			t.Errorf("Chunk declaring %d bytes was accepted", size)
+		}
+	}
+
+	if _, err := models.ParseRPMSG([]byte("not a container")); err != models.ErrNotRPMSG {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, ok := newItem("IPM.Note", nil).RightsProtection(); ok {
+		t.Errorf("IPM.Note was recognized as rights protected")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestMessageJSONRoundTrip(t *testing.T) {
+	for _, file := range []string{"test.msg", "test_2.msg", "test_3.msg"} {
+		msg, err := msgparser.ParseMsgFile(file)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", file, err)
+		}
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatalf("Failed to marshal %s: %v", file, err)
+		}
+		var again models.Message
+		if err := json.Unmarshal(data, &again); err != nil {
+			t.Fatalf("Failed to unmarshal %s: %v", file, err)
+		}
+		if !reflect.DeepEqual(msg, &again) {
+			compareMessages(t, file, msg, &again)
+		}
+
+		// Encoding is stable, so cached results can be diffed
+		data2, err := json.Marshal(&again)
+		if err != nil {
+			t.Fatalf("Failed to marshal %s again: %v", file, err)
+		}
+		if !bytes.Equal(data, data2) {
+			t.Errorf("%s: encoding the decoded message gave different JSON", file)
+		}
+	}
+}
+
+func TestMessageJSONSchema(t *testing.T) {
+	msg, err := msgparser.ParseMsgFile("test.msg")
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	msg.Attachments = append(msg.Attachments, models.Attachment{Name: "a.bin", Method: models.AttachByValue, Data: []byte{1, 2, 3}})
+	msg.Properties[0x0E08] = int32(1234)
+
+	data, err := msg.MarshalJSONWithOptions(models.JSONOptions{OmitAttachmentData: true})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `{"tag":"0x0E080003","name":"PidTagMessageSize","type":"PT_LONG","value":1234}`) {
+		t.Errorf("Property was not encoded with its tag, name and type: %s", data)
+	}
+	if !strings.Contains(string(data), `"size":3`) || strings.Contains(string(data), `"data":"AQID"`) {
+		t.Errorf("Attachment content was not omitted: %s", data)
+	}
+
+	data, err = json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"data":"AQID"`) {
+		t.Errorf("Attachment content was not encoded as base64: %s", data)
+	}
+
+	msg.Extensions = map[string]interface{}{"dlp": "confidential", "score": 3}
+	data, err = json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var again models.Message
+	if err := json.Unmarshal(data, &again); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if want := map[string]interface{}{"dlp": "confidential", "score": 3.0}; !reflect.DeepEqual(again.Extensions, want) {
+		t.Errorf("Unexpected extensions %#v", again.Extensions)
+	}
+}
+
+func TestPropertyTypesKept(t *testing.T) {
+	msg := newItem("IPM.Note", nil)
+	msg.Subject = "Typed"
+	values := map[int64]interface{}{
+		0x3FF8: "Creator",                                        // PT_STRING8
+		0x0E07: int64(125000),                                    // PT_CURRENCY
+		0x0E08: 43831.5,                                          // PT_APPTIME
+		0x0E09: "00062008-0000-0000-c000-000000000046",           // PT_CLSID
+		0x0E0A: int32(-2147221233),                               // PT_ERROR
+		0x0E0B: []string{"one", "two"},                           // PT_MV_STRING8
+		0x0E0C: []string{"00062002-0000-0000-c000-000000000046"}, // PT_MV_CLSID
+	}
+	types := map[int64]uint16{0x3FF8: 0x001E, 0x0E07: 0x0006, 0x0E08: 0x0007, 0x0E09: 0x0048, 0x0E0A: 0x000A, 0x0E0B: 0x101E, 0x0E0C: 0x1048}
+	msg.PropertyTypes = make(map[int64]uint16)
+	for id, v := range values {
+		msg.Properties[id] = v
+		msg.PropertyTypes[id] = types[id]
+	}
+
+	got := writeAndParse(t, msg)
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	for _, tag := range []string{"0x3FF8001E", "0x0E070006", "0x0E080007", "0x0E090048", "0x0E0A000A", "0x0E0B101E", "0x0E0C1048"} {
+		if !strings.Contains(string(data), `"tag":"`+tag+`"`) {
+			t.Errorf("Property %s was not written with its type: %s", tag, data)
+		}
+	}
+	var decoded models.Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	for id, v := range values {
+		if !reflect.DeepEqual(got.Properties[id], v) || got.PropertyTypes[id] != types[id] {
+			t.Errorf("Property %04x read back as %v of type %04x", id, got.Properties[id], got.PropertyTypes[id])
+		}
+		if !reflect.DeepEqual(decoded.Properties[id], v) || decoded.PropertyTypes[id] != types[id] {
+			t.Errorf("Property %04x decoded as %v of type %04x", id, decoded.Properties[id], decoded.PropertyTypes[id])
+		}
+	}
+
+	// Values without a MAPI type are reported rather than dropped
+	msg.Properties[0x0E0D] = struct{}{}
+	if _, err := json.Marshal(msg); err == nil {
+		t.Errorf("Marshaling a value without MAPI type did not fail")
+	}
+	var buf bytes.Buffer
+	if err := msg.WriteMSG(&buf); err == nil {
+		t.Errorf("Writing a value without MAPI type did not fail")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func meeting(lid uint32) models.NamedProperty {
+	return models.NamedProperty{GUID: models.PSETIDMeeting, ID: lid}
+}
+
+// globalObjectID builds a PidLidGlobalObjectId, with an instance date unless it is zero
+func globalObjectID(instance time.Time, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x04, 0x00, 0x00, 0x00, 0x82, 0x00, 0xE0, 0x00, 0x74, 0xC5, 0xB7, 0x10, 0x1A, 0x82, 0xE0, 0x08})
+	if instance.IsZero() {
+		buf.Write(make([]byte, 4))
+	} else {
+		buf.Write([]byte{byte(instance.Year() >> 8), byte(instance.Year()), byte(instance.Month()), byte(instance.Day())})
+	}
+	binary.Write(&buf, binary.LittleEndian, models.TimeToFiletime(time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)))
+	buf.Write(make([]byte, 8))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestMeetingMessage(t *testing.T) {
+	proposed := time.Date(2024, 3, 11, 14, 0, 0, 0, time.UTC)
+	instance := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)
+	msg := newItem("IPM.Schedule.Meeting.Resp.Tent", map[models.NamedProperty]interface{}{
+		meeting(0x0003): globalObjectID(instance, []byte{0xDE, 0xAD, 0xBE, 0xEF}),
+		meeting(0x000A): true,
+		meeting(0x0005): true,
+		appt(0x8201):    int32(3),
+		appt(0x8257):    true,
+		appt(0x8250):    proposed,
+		appt(0x8251):    proposed.Add(time.Hour),
+	})
+	m, ok := writeAndParse(t, msg).MeetingMessage()
+	if !ok {
+		t.Fatalf("Response was not recognized as meeting message")
+	}
+	if m.Kind != models.MeetingResponse || m.ResponseType != models.ResponseTentative || m.Sequence != 3 {
+		t.Errorf("Unexpected meeting message %+v", m)
+	}
+	if m.GlobalObjectID == nil || !m.InstanceDate().Equal(instance) || !m.UpdatesInstance() || !m.IsRecurring {
+		t.Fatalf("Unexpected global object id %+v", m.GlobalObjectID)
+	}
+	if uid := m.GlobalObjectID.UID(); uid != "040000008200E00074C5B7101A82E00800000000"+"00E08C2E0655DA01"+"0000000000000000"+"04000000DEADBEEF" {
+		t.Errorf("Unexpected UID %s", uid)
+	}
+	if !m.HasProposedTime() || !m.ProposedStart.Equal(proposed) || !m.ProposedEnd.Equal(proposed.Add(time.Hour)) {
+		t.Errorf("Unexpected proposed time %v - %v", m.ProposedStart, m.ProposedEnd)
+	}
+
+	msg = newItem("IPM.Schedule.Meeting.Request", map[models.NamedProperty]interface{}{
+		meeting(0x0003): globalObjectID(time.Time{}, []byte{0x01}),
+		meeting(0x0026): int32(models.MeetingTypeFull),
+	})
+	m, _ = writeAndParse(t, msg).MeetingMessage()
+	if m.Kind != models.MeetingRequest || m.UpdatesInstance() || !m.IsUpdate() || m.HasProposedTime() {
+		t.Errorf("Unexpected request %+v", m)
+	}
+	if _, ok := newItem("IPM.Appointment", nil).MeetingMessage(); ok {
+		t.Errorf("An appointment was returned as meeting message")
+	}
+}
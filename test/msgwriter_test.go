@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestWriteMSGRoundTrip(t *testing.T) {
+	for _, file := range []string{"test.msg", "test_2.msg", "test_3.msg"} {
+		msg, err := msgparser.ParseMsgFile(file)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", file, err)
+		}
+
+		var buf bytes.Buffer
+		if err := msg.WriteMSG(&buf); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+		again, err := msgparser.ParseReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Failed to parse written %s: %v", file, err)
+		}
+
+		if !reflect.DeepEqual(msg, again) {
+			compareMessages(t, file, msg, again)
+		}
+	}
+}
+
+func TestWriteMSGRedactBody(t *testing.T) {
+	msg, err := msgparser.ParseMsgFile("test_3.msg")
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	msg.BodyPlainText = "[redacted]"
+	msg.BodyHTML = "<p>[redacted]</p>"
+
+	var buf bytes.Buffer
+	if err := msg.WriteMSG(&buf); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	again, err := msgparser.ParseReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to parse written file: %v", err)
+	}
+	if again.BodyPlainText != "[redacted]" || again.BodyHTML != "<p>[redacted]</p>" {
+		t.Errorf("Body was not replaced: %q / %q", again.BodyPlainText, again.BodyHTML)
+	}
+	if again.Subject != msg.Subject || len(again.Recipients) != len(msg.Recipients) {
+		t.Errorf("Redacting the body changed other fields")
+	}
+}
+
+func TestWriteMSGFromEML(t *testing.T) {
+	f, err := os.Open("test.eml")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+	msg, err := msgparser.ParseEML(f)
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := msg.WriteMSG(&buf); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	again, err := msgparser.ParseReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to parse written file: %v", err)
+	}
+
+	if !again.Date.Equal(msg.Date) {
+		t.Errorf("Date changed from %v to %v", msg.Date, again.Date)
+	}
+	if !reflect.DeepEqual(again.Recipients, msg.Recipients) {
+		t.Errorf("Recipients changed from %+v to %+v", msg.Recipients, again.Recipients)
+	}
+	if !reflect.DeepEqual(again.Attachments, msg.Attachments) {
+		t.Errorf("Attachments changed from %+v to %+v", msg.Attachments, again.Attachments)
+	}
+	if !reflect.DeepEqual(again.NamedProperties, msg.NamedProperties) {
+		t.Errorf("Named properties changed from %+v to %+v", msg.NamedProperties, again.NamedProperties)
+	}
+	// The parser trims bodies, so only compare the content
+	if again.To != msg.To || again.CC != msg.CC || again.Subject != msg.Subject || again.BodyHTML != strings.TrimSpace(msg.BodyHTML) {
+		t.Errorf("Message fields changed")
+	}
+}
+
+func TestWriteMSGSenderAddresses(t *testing.T) {
+	msg := newItem("IPM.Note", nil)
+	msg.Properties[0x0C1F] = "alice@example.com"  // PR_SENDER_EMAIL_ADDRESS
+	msg.Properties[0x0065] = "malice@example.com" // PR_SENT_REPRESENTING_EMAIL_ADDRESS
+
+	res := writeAndParse(t, writeAndParse(t, msg))
+	if res.Properties[0x0C1F] != "alice@example.com" || res.Properties[0x0065] != "malice@example.com" {
+		t.Errorf("Unexpected sender addresses %v and %v", res.Properties[0x0C1F], res.Properties[0x0065])
+	}
+	if senders := strings.Split(res.FromEmail, ", "); len(senders) != 2 {
+		t.Errorf("Unexpected FromEmail %q", res.FromEmail)
+	}
+}
+
+func TestFiletimeFarFuture(t *testing.T) {
+	// Outlook stores 4501-01-01 for dates that are not set
+	const none = 0x0CB34557A3DD4000
+	want := time.Date(4501, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := models.FiletimeToTime(none); !got.Equal(want) {
+		t.Errorf("Unexpected time %v", got)
+	}
+	if got := models.TimeToFiletime(want); got != none {
+		t.Errorf("Unexpected FILETIME %x", got)
+	}
+	if got := models.TimeToFiletime(models.FiletimeToTime(0x01D9A0B1C2D3E4F5)); got != 0x01D9A0B1C2D3E4F5 {
+		t.Errorf("Unexpected FILETIME %x", got)
+	}
+
+	msg := newItem("IPM.Note", map[models.NamedProperty]interface{}{
+		common(0x8502): want, // PidLidReminderTime
+	})
+	res := writeAndParse(t, msg)
+	if v, _ := res.NamedValue(models.PSETIDCommon, 0x8502); v == nil || !want.Equal(v.(time.Time)) {
+		t.Errorf("Unexpected reminder time %v", v)
+	}
+}
+
+// compareMessages reports which part of two messages differs
+func compareMessages(t *testing.T, file string, want, got *models.Message) {
+	t.Helper()
+	wv, gv := reflect.ValueOf(want).Elem(), reflect.ValueOf(got).Elem()
+	for i := 0; i < wv.NumField(); i++ {
+		field := wv.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(wv.Field(i).Interface(), gv.Field(i).Interface()) {
+			t.Errorf("%s: %s changed after writing", file, field.Name)
+		}
+	}
+	for id, v := range want.Properties {
+		if !reflect.DeepEqual(v, got.Properties[id]) {
+			t.Errorf("%s: property %x changed from %#v to %#v", file, id, v, got.Properties[id])
+		}
+	}
+	for id, v := range got.Properties {
+		if _, ok := want.Properties[id]; !ok {
+			t.Errorf("%s: property %x = %#v added after writing", file, id, v)
+		}
+	}
+}
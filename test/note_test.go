@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestStickyNote(t *testing.T) {
+	msg := newItem("IPM.StickyNote", map[models.NamedProperty]interface{}{
+		{GUID: models.PSETIDNote, ID: 0x8B00}: int32(models.NoteYellow),
+		{GUID: models.PSETIDNote, ID: 0x8B02}: int32(200),
+		{GUID: models.PSETIDNote, ID: 0x8B03}: int32(166),
+	})
+	msg.Subject = "Call the plumber"
+	msg.BodyPlainText = "Call the plumber\r\nbefore Friday"
+
+	n, ok := writeAndParse(t, msg).StickyNote()
+	if !ok {
+		t.Fatalf("Message was not recognized as sticky note")
+	}
+	if n.Color != models.NoteYellow || n.Color.String() != "yellow" || n.Width != 200 || n.Height != 166 {
+		t.Errorf("Unexpected note %+v", n)
+	}
+	if n.Body != "Call the plumber\r\nbefore Friday" {
+		t.Errorf("Unexpected body %q", n.Body)
+	}
+
+	// A note without body keeps its text in the subject only
+	msg.BodyPlainText = ""
+	if n, _ := writeAndParse(t, msg).StickyNote(); n.Body != "Call the plumber" {
+		t.Errorf("Unexpected body %q", n.Body)
+	}
+}
+
+func TestJournalEntry(t *testing.T) {
+	start := time.Date(2024, 3, 4, 14, 0, 0, 0, time.UTC)
+	msg := newItem("IPM.Activity", map[models.NamedProperty]interface{}{
+		{GUID: models.PSETIDLog, ID: 0x8700}: "Phone call",
+		{GUID: models.PSETIDLog, ID: 0x8706}: start,
+		{GUID: models.PSETIDLog, ID: 0x8708}: start.Add(25 * time.Minute),
+		{GUID: models.PSETIDLog, ID: 0x8707}: int32(25),
+		common(0x8539):                       []string{"Example, Inc."},
+		common(0x853A):                       []string{"Bob Example", "Carol Example"},
+	})
+	msg.Subject = "Call with Bob"
+
+	j, ok := writeAndParse(t, msg).JournalEntry()
+	if !ok {
+		t.Fatalf("Message was not recognized as journal entry")
+	}
+	if j.Type != "Phone call" || !j.Start.Equal(start) || !j.End.Equal(start.Add(25*time.Minute)) || j.Duration != 25*time.Minute {
+		t.Errorf("Unexpected journal entry %+v", j)
+	}
+	if len(j.Companies) != 1 || j.Companies[0] != "Example, Inc." || len(j.Contacts) != 2 || j.Contacts[1] != "Carol Example" {
+		t.Errorf("Unexpected companies %v or contacts %v", j.Companies, j.Contacts)
+	}
+	if _, ok := newItem("IPM.Note", nil).JournalEntry(); ok {
+		t.Errorf("IPM.Note was recognized as journal entry")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// minutes returns the minutes since 1601 recurrence patterns store times as
+func minutes(t time.Time) uint32 {
+	return uint32((t.Unix() + 11644473600) / 60)
+}
+
+// recurrenceBlob builds a weekly AppointmentRecurrencePattern on Mondays and Wednesdays at 9:30,
+// with one deleted instance and one instance moved by an hour with a new subject and location
+func recurrenceBlob(endType models.RecurEndType) []byte {
+	var buf bytes.Buffer
+	w := func(values ...interface{}) {
+		for _, v := range values {
+			binary.Write(&buf, binary.LittleEndian, v)
+		}
+	}
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	deleted := time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)
+	moved := time.Date(2024, 3, 11, 9, 30, 0, 0, time.UTC)
+	end := time.Date(2024, 6, 26, 0, 0, 0, 0, time.UTC)
+
+	w(uint16(0x3004), uint16(0x3004), uint16(models.RecurWeekly), uint16(models.PatternWeek), uint16(0))
+	w(uint32(0), uint32(2), uint32(0)) // FirstDateTime, Period, SlidingFlag
+	w(uint32(0x02 | 0x08))             // Monday and Wednesday
+	w(uint32(endType), uint32(10), uint32(1))
+	w(uint32(2), minutes(deleted), minutes(moved.Truncate(24*time.Hour)))
+	w(uint32(1), minutes(moved.Truncate(24*time.Hour)))
+	w(minutes(start), minutes(end))
+
+	w(uint32(0x3006), uint32(0x3009), uint32(570), uint32(630))
+	w(uint16(1))
+	w(minutes(moved.Add(time.Hour)), minutes(moved.Add(2*time.Hour)), minutes(moved), uint16(0x0001|0x0010))
+	w(uint16(4), uint16(3), []byte("New"))
+	w(uint16(7), uint16(6), []byte("Room 9"))
+	w(uint32(0))
+
+	w(uint32(4), uint32(0), uint32(0)) // ChangeHighlight, ReservedBlockEE1
+	w(minutes(moved.Add(time.Hour)), minutes(moved.Add(2*time.Hour)), minutes(moved))
+	w(uint16(5), utf16.Encode([]rune("New ✓")))
+	w(uint16(6), utf16.Encode([]rune("Room 9")))
+	w(uint32(0), uint32(0))
+	return buf.Bytes()
+}
+
+func TestRecurrence(t *testing.T) {
+	msg := newItem("IPM.Appointment", map[models.NamedProperty]interface{}{
+		appt(0x8216): recurrenceBlob(models.EndAfterDate),
+		appt(0x8223): true,
+	})
+	a, ok := writeAndParse(t, msg).Appointment()
+	if !ok || a.Recurrence == nil {
+		t.Fatalf("Recurrence was not decoded")
+	}
+	p := a.Recurrence
+	if p.StartTimeOffset != 570*time.Minute || p.EndTimeOffset != 630*time.Minute {
+		t.Errorf("Unexpected offsets %v %v", p.StartTimeOffset, p.EndTimeOffset)
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("No time zone database: %v", err)
+	}
+	rule, err := p.RRule(berlin, false)
+	if err != nil {
+		t.Fatalf("RRule failed: %v", err)
+	}
+	if expected := "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20240626T073000Z"; rule != expected {
+		t.Errorf("Expected %s, got %s", expected, rule)
+	}
+
+	deleted := p.DeletedInstances()
+	if len(deleted) != 1 || !deleted[0].Equal(time.Date(2024, 3, 6, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected deleted instances %v", deleted)
+	}
+	if len(p.Exceptions) != 1 {
+		t.Fatalf("Expected 1 exception, got %d", len(p.Exceptions))
+	}
+	ex := p.Exceptions[0]
+	if ex.Subject == nil || *ex.Subject != "New ✓" || ex.Location == nil || *ex.Location != "Room 9" || ex.BusyStatus != nil {
+		t.Errorf("Unexpected exception %+v", ex)
+	}
+	if !ex.Start.Equal(time.Date(2024, 3, 11, 10, 30, 0, 0, time.UTC)) || !ex.OriginalStart.Equal(time.Date(2024, 3, 11, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected exception times %v (was %v)", ex.Start, ex.OriginalStart)
+	}
+
+	p, err = models.ParseRecurrencePattern(recurrenceBlob(models.EndAfterOccurrences))
+	if err != nil {
+		t.Fatalf("Failed to parse pattern: %v", err)
+	}
+	if rule, _ := p.RRule(nil, false); rule != "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10" {
+		t.Errorf("Unexpected rule %s", rule)
+	}
+	p.Frequency, p.PatternType, p.Period, p.DaysOfWeek, p.WeekOfMonth = models.RecurYearly, models.PatternMonthNth, 12, 0x20, 5
+	if rule, _ := p.RRule(nil, false); rule != "FREQ=YEARLY;BYMONTH=3;BYDAY=FR;BYSETPOS=-1;COUNT=10" {
+		t.Errorf("Unexpected rule %s", rule)
+	}
+
+	if _, err := models.ParseRecurrencePattern(recurrenceBlob(models.EndNever)[:40]); err == nil {
+		t.Errorf("A truncated pattern was accepted")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestSegmentText(t *testing.T) {
+	body := "Hi Anna,\r\n\r\nThe ticket is fixed.\r\n\r\nBest regards,\r\nBob Smith\r\nSupport | Example Ltd\r\n\r\n" +
+		"________________________________\r\n" +
+		"From: Anna Jones <anna@example.com>\r\n" +
+		"Sent: Friday, January 4, 2019 1:25 PM\r\n" +
+		"To: Support <support@example.com>; Carl <carl@example.com>;\r\n" +
+		"    Dora <dora@example.com>\r\n" +
+		"Subject: RE: Printer\r\n\r\n" +
+		"It still fails.\r\n\r\n" +
+		"On Fri, Jan 4, 2019 at 9:02 AM Bob Smith <bob@example.com> wrote:\r\n" +
+		"> Please restart it.\r\n" +
+		">\r\n" +
+		"> > The printer is jammed.\r\n"
+	segments := models.SegmentText(body)
+	if got := segments.Reply(); got != "Hi Anna,\n\nThe ticket is fixed.\n\nBest regards," {
+		t.Errorf("Unexpected reply %q", got)
+	}
+	if got := segments.Signature(); got != "Bob Smith\nSupport | Example Ltd" {
+		t.Errorf("Unexpected signature %q", got)
+	}
+
+	quoted := segments.Quoted()
+	if len(quoted) != 3 {
+		t.Fatalf("Expected 3 quoted messages, got %+v", quoted)
+	}
+	want := models.QuotedHeader{
+		From:    "Anna Jones <anna@example.com>",
+		Sent:    "Friday, January 4, 2019 1:25 PM",
+		Date:    time.Date(2019, 1, 4, 13, 25, 0, 0, time.UTC),
+		To:      "Support <support@example.com>; Carl <carl@example.com>; Dora <dora@example.com>",
+		Subject: "RE: Printer",
+	}
+	if quoted[0].Header == nil || *quoted[0].Header != want || quoted[0].Text != "It still fails." {
+		t.Errorf("Unexpected first quoted message %+v %+v", quoted[0].Header, quoted[0])
+	}
+	if h := quoted[1].Header; h == nil || h.From != "Bob Smith <bob@example.com>" || h.Sent != "Fri, Jan 4, 2019 at 9:02 AM" ||
+		h.Date.Hour() != 9 || quoted[1].Text != "Please restart it." {
+		t.Errorf("Unexpected second quoted message %+v %+v", quoted[1].Header, quoted[1])
+	}
+	if quoted[2].Header != nil || quoted[2].Text != "The printer is jammed." {
+		t.Errorf("Unexpected third quoted message %+v", quoted[2])
+	}
+
+	// A separator without a header is part of the reply, and a mobile footer is a signature
+	segments = models.SegmentText("Figures below\n\n________________________________\n\nTotal: 12\n\nSent from my iPhone")
+	if segments.Reply() != "Figures below\n\n________________________________\n\nTotal: 12" || segments.Signature() != "Sent from my iPhone" {
+		t.Errorf("Unexpected segments %+v", segments)
+	}
+}
+
+func TestSegmentHTML(t *testing.T) {
+	body := `<html><body>
+<div>Thanks, that works.</div>
+<div id="Signature"><p>Bob</p></div>
+<hr style="display:inline-block;width:98%">
+<div id="divRplyFwdMsg" dir="ltr"><font face="Calibri"><b>From:</b> Anna Jones &lt;anna@example.com&gt;<br>
+<b>Sent:</b> Monday, March 4, 2024 9:30 AM<br><b>To:</b> Bob<br><b>Subject:</b> Printer</font></div>
+<div>Try <a href="https://example.com/kb">this article</a>.</div>
+<div class="gmail_quote"><div class="gmail_attr">El lun, 4 mar 2024 a las 9:00, Carl (&lt;carl@example.com&gt;) escribió:<br></div>
+<blockquote class="gmail_quote">It is broken.</blockquote></div>
+</body></html>`
+	segments := models.SegmentHTML(body)
+	if segments.Reply() != "Thanks, that works." || segments.Signature() != "Bob" {
+		t.Errorf("Unexpected reply %+v", segments)
+	}
+	quoted := segments.Quoted()
+	if len(quoted) != 2 {
+		t.Fatalf("Expected 2 quoted messages, got %+v", quoted)
+	}
+	if h := quoted[0].Header; h == nil || h.From != "Anna Jones <anna@example.com>" || h.Subject != "Printer" ||
+		h.Date.IsZero() || quoted[0].Text != "Try this article." {
+		t.Errorf("Unexpected first quoted message %+v %+v", quoted[0].Header, quoted[0])
+	}
+	if h := quoted[1].Header; h == nil || h.From != "Carl (<carl@example.com>)" || h.Sent != "lun, 4 mar 2024 a las 9:00" ||
+		quoted[1].Text != "It is broken." {
+		t.Errorf("Unexpected second quoted message %+v %+v", quoted[1].Header, quoted[1])
+	}
+
+	msg, err := msgparser.ParseMsgFile("test.msg")
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	segments = msg.SegmentBody()
+	if segments.Reply() != "Buenos dias, Javier\n\nYa tienes datos de la sumaria y falua?\n\nSaludos" || len(segments.Quoted()) != 2 {
+		t.Errorf("Unexpected segments of test.msg %+v", segments)
+	}
+	if h := segments.Quoted()[0].Header; h == nil || h.From != "Javier Hernandez Gonzalez" {
+		t.Errorf("Unexpected header %+v", h)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func TestDeliveryReport(t *testing.T) {
+	submitted := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	msg := newItem("REPORT.IPM.Note.NDR", nil)
+	msg.Subject = "Undeliverable: Quarterly report"
+	msg.Properties[0x0049] = "Quarterly report"
+	msg.Properties[0x1046] = "<report@example.com>"
+	msg.Properties[0x004E] = submitted
+	msg.Properties[0x1001] = "Your message did not reach some or all of the intended recipients."
+	msg.Recipients = []models.Recipient{
+		{Type: models.RecipientTo, DisplayName: "Bob Example", SMTPAddress: "bob@example.com", Properties: map[int64]interface{}{
+			0x0C04: int32(models.NDRTransferFailed),
+			0x0C05: int32(35),
+			0x0C1B: "< #5.1.1 smtp;550 5.1.1 User unknown>",
+		}},
+		{Type: models.RecipientCC, DisplayName: "Carol Example", SMTPAddress: "carol@example.com", Properties: map[int64]interface{}{
+			0x0010: submitted.Add(time.Minute),
+		}},
+	}
+
+	r, ok := writeAndParse(t, msg).DeliveryReport()
+	if !ok {
+		t.Fatalf("Message was not recognized as report")
+	}
+	if r.Kind != models.ReportNonDelivery || r.OriginalClass != "IPM.Note" || r.OriginalSubject != "Quarterly report" {
+		t.Errorf("Unexpected kind %v, class %q or subject %q", r.Kind, r.OriginalClass, r.OriginalSubject)
+	}
+	if r.OriginalMessageID != "<report@example.com>" || !r.OriginalSubmitTime.Equal(submitted) || r.ReportText == "" {
+		t.Errorf("Unexpected report %+v", r)
+	}
+
+	// Report text stored as PT_BINARY keeps its type
+	msg.Properties[0x1001] = []byte("Delivery has failed.")
+	res := writeAndParse(t, msg)
+	if r, _ := res.DeliveryReport(); r == nil || r.ReportText != "Delivery has failed." {
+		t.Errorf("Unexpected binary report text %+v", r)
+	}
+	if _, ok := res.Properties[0x1001].([]byte); !ok {
+		t.Errorf("Report text changed to %#v", res.Properties[0x1001])
+	}
+
+	failed := r.Failed()
+	if len(r.Recipients) != 2 || len(failed) != 1 || failed[0].Recipient.SMTPAddress != "bob@example.com" {
+		t.Fatalf("Unexpected recipients %+v", r.Recipients)
+	}
+	if failed[0].Status != "5.1.1" || failed[0].Diagnostic.String() != "the recipient is unknown" {
+		t.Errorf("Unexpected status %q or diagnostic %q", failed[0].Status, failed[0].Diagnostic)
+	}
+	if want := "the recipient is unknown; status 5.1.1; < #5.1.1 smtp;550 5.1.1 User unknown>"; failed[0].Description() != want {
+		t.Errorf("Unexpected description %q", failed[0].Description())
+	}
+	if r.Recipients[1].Failed() || r.Recipients[1].DeliverTime.IsZero() {
+		t.Errorf("Unexpected delivered recipient %+v", r.Recipients[1])
+	}
+
+	for class, kind := range map[string]models.ReportKind{
+		"REPORT.IPM.Note.DR":                         models.ReportDelivery,
+		"REPORT.IPM.Note.Delayed.DR":                 models.ReportDelayed,
+		"Report.IPM.Note.IPNRN":                      models.ReportRead,
+		"REPORT.IPM.Schedule.Meeting.Request.IPNNRN": models.ReportNotRead,
+	} {
+		r, ok := newItem(class, nil).DeliveryReport()
+		if !ok || r.Kind != kind {
+			t.Errorf("Unexpected kind of %s: %v", class, r)
+		}
+	}
+	if _, ok := newItem("IPM.Note", nil).DeliveryReport(); ok {
+		t.Errorf("IPM.Note was recognized as report")
+	}
+}
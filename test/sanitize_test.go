@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+const outlookHTML = `<html xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="urn:schemas-microsoft-com:office:office">
+<head><style><!--
+p.MsoNormal, li.MsoNormal {margin:0cm; font-size:11.0pt; mso-fareast-language:EN-US}
+@media print {p {color:black}}
+.red {color:red}
+div p {color:blue}
+--></style><script>alert(1)</script></head>
+<body lang="EN-GB" onload="track()"><div class="WordSection1">
+<p class="MsoNormal" style="mso-margin-top-alt:auto">Hello<o:p>&nbsp;</o:p></p>
+<!--[if gte vml 1]><v:shape style="width:100pt"><v:imagedata src="image001.png"/></v:shape><![endif]-->
+<![if !vml]><img src="cid:image001.png" width="100"><![endif]>
+<p class="red" onclick="steal()"><a href="javascript:alert(1)">bad</a> <a href="https://example.com/?a=1&amp;b=2" target="_blank">good</a></p>
+<img src="https://tracker.example.com/open.gif" width="1" height="1">
+<img src="https://cdn.example.com/logo.png" style="width:120px">
+<img src="data:text/html;base64,PHNjcmlwdD4=">
+<span style="background:url(javascript:alert(1)); color: green; width: expression(alert(1))">text</span>
+<form action="https://evil.example.com"><input name="password"></form>
+</div></body></html>`
+
+func TestSanitizeHTML(t *testing.T) {
+	got, err := models.SanitizeHTML(outlookHTML, nil)
+	if err != nil {
+		t.Fatalf("Failed to sanitize: %v", err)
+	}
+	want := `<div>
+<p>Hello` + "\u00a0" + `</p>
+
+<img src="cid:image001.png" width="100"/>
+<p><a>bad</a> <a href="https://example.com/?a=1&amp;b=2">good</a></p>
+
+<img src="https://cdn.example.com/logo.png" style="width: 120px"/>
+
+<span style="color: green">text</span>
+
+</div>`
+	if got != want {
+		t.Errorf("Unexpected sanitized body:\n%s", got)
+	}
+
+	policy := models.DefaultSanitizePolicy()
+	policy.BlockRemoteImages = true
+	policy.InlineCSS = true
+	msg := &models.Message{BodyHTML: outlookHTML}
+	got, err = msg.SanitizedHTML(policy)
+	if err != nil {
+		t.Fatalf("Failed to sanitize: %v", err)
+	}
+	want = `<div>
+<p style="margin: 0cm; font-size: 11.0pt">Hello` + "\u00a0" + `</p>
+
+<img src="cid:image001.png" width="100"/>
+<p style="color: red"><a>bad</a> <a href="https://example.com/?a=1&amp;b=2">good</a></p>
+
+
+
+<span style="color: green">text</span>
+
+</div>`
+	if got != want {
+		t.Errorf("Unexpected sanitized body with inlined CSS:\n%s", got)
+	}
+}
+
+func TestSanitizeCSSURLs(t *testing.T) {
+	body := `<p style="background-image:image-set('https://t.example/p.gif' 1x); color: red">a</p>` +
+		`<p style="background:-webkit-image-set(url(&quot;//t.example/p.gif&quot;) 1x)">b</p>` +
+		`<p style="background:cross-fade('cid:a.png', &quot;https://t.example/p.gif&quot;, 50%)">c</p>` +
+		`<p style="color: blue; background:url(https://t.example/p.gif">d</p>` +
+		`<p style="background:image-set('https://t.example/p.gif">e</p>` +
+		`<p style="background: url('cid:logo.png') no-repeat">f</p>`
+
+	policy := models.DefaultSanitizePolicy()
+	policy.BlockRemoteImages = true
+	got, err := models.SanitizeHTML(body, policy)
+	if err != nil {
+		t.Fatalf("Failed to sanitize: %v", err)
+	}
+	want := `<p style="color: red">a</p><p>b</p><p>c</p><p style="color: blue">d</p><p>e</p>` +
+		`<p style="background: url(&#39;cid:logo.png&#39;) no-repeat">f</p>`
+	if got != want {
+		t.Errorf("Unexpected sanitized body with remote images blocked:\n%s", got)
+	}
+
+	// Without the policy, remote images are kept but the schemes are still checked
+	body = `<p style="background:image-set('https://cdn.example.com/a.png' 1x)">a</p>` +
+		`<p style="background:image-set('vbscript-like:x' 1x)">b</p>`
+	got, err = models.SanitizeHTML(body, nil)
+	if err != nil {
+		t.Fatalf("Failed to sanitize: %v", err)
+	}
+	want = `<p style="background: image-set(&#39;https://cdn.example.com/a.png&#39; 1x)">a</p><p>b</p>`
+	if got != want {
+		t.Errorf("Unexpected sanitized body:\n%s", got)
+	}
+}
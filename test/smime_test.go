@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidECDSASHA256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+const signedEntity = "Content-Type: multipart/mixed; boundary=inner\r\n\r\n" +
+	"--inner\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nSigned hello\r\n" +
+	"--inner\r\nContent-Type: text/csv\r\nContent-Disposition: attachment; filename=figures.csv\r\n\r\nq,r\r\n1,100\r\n" +
+	"--inner--\r\n"
+
+// signer is a self-signed certificate with its key
+type signer struct {
+	cert        *x509.Certificate
+	key         *ecdsa.PrivateKey
+	signingTime time.Time
+}
+
+func newSigner(t *testing.T, name string) signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(42),
+		Subject:        pkix.Name{CommonName: name},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		EmailAddresses: []string{"alice@example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return signer{cert, key, time.Now().Add(-time.Minute).UTC().Truncate(time.Second)}
+}
+
+// tlv encodes a DER element with a definite length
+func tlv(tag byte, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	n := len(body)
+	var length []byte
+	for ; n > 0; n >>= 8 {
+		length = append([]byte{byte(n)}, length...)
+	}
+	if len(body) < 0x80 {
+		length = []byte{byte(len(body))}
+	} else {
+		length = append([]byte{0x80 | byte(len(length))}, length...)
+	}
+	return append(append([]byte{tag}, length...), body...)
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// sign builds a PKCS #7 SignedData over content, which is encapsulated unless detached.
+// The encapsulated content is BER encoded in two chunks of indefinite length, as Outlook writes it.
+func (s signer) sign(t *testing.T, content []byte, detached bool) []byte {
+	t.Helper()
+	digest := sha256.Sum256(content)
+	attrs := [][]byte{
+		tlv(0x30, mustMarshal(oidContentType), tlv(0x31, mustMarshal(oidData))),
+		tlv(0x30, mustMarshal(oidMessageDigest), tlv(0x31, mustMarshal(digest[:]))),
+		tlv(0x30, mustMarshal(oidSigningTime), tlv(0x31, mustMarshal(s.signingTime))),
+	}
+	setDigest := sha256.Sum256(tlv(0x31, attrs...))
+	signature, err := s.key.Sign(rand.Reader, setDigest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	encap := tlv(0x30, mustMarshal(oidData))
+	if !detached {
+		half := len(content) / 2
+		encap = append([]byte{0x30, 0x80}, mustMarshal(oidData)...)
+		encap = append(encap, 0xA0, 0x80, 0x24, 0x80)
+		encap = append(encap, mustMarshal(content[:half])...)
+		encap = append(encap, mustMarshal(content[half:])...)
+		encap = append(encap, 0, 0, 0, 0, 0, 0)
+	}
+	issuerAndSerial := tlv(0x30, s.cert.RawIssuer, mustMarshal(s.cert.SerialNumber))
+	signerInfo := tlv(0x30, mustMarshal(1), issuerAndSerial, mustMarshal(pkix.AlgorithmIdentifier{Algorithm: oidSHA256}),
+		tlv(0xA0, attrs...), mustMarshal(pkix.AlgorithmIdentifier{Algorithm: oidECDSASHA256}), mustMarshal(signature))
+	sd := tlv(0x30, mustMarshal(1), tlv(0x31, mustMarshal(pkix.AlgorithmIdentifier{Algorithm: oidSHA256})), encap,
+		tlv(0xA0, s.cert.Raw), tlv(0x31, signerInfo))
+	return tlv(0x30, mustMarshal(oidSignedData), tlv(0xA0, sd))
+}
+
+// encrypt builds a PKCS #7 EnvelopedData of content for the RSA key of cert, with AES-256-CBC
+func encrypt(t *testing.T, content []byte, cert *x509.Certificate) []byte {
+	t.Helper()
+	key, iv := make([]byte, 32), make([]byte, aes.BlockSize)
+	rand.Read(key)
+	rand.Read(iv)
+	padding := aes.BlockSize - len(content)%aes.BlockSize
+	padded := append(append([]byte{}, content...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	block, _ := aes.NewCipher(key)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+	encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, cert.PublicKey.(*rsa.PublicKey), key)
+	if err != nil {
+		t.Fatalf("Failed to encrypt key: %v", err)
+	}
+
+	recipient := tlv(0x30, mustMarshal(0), tlv(0x30, cert.RawIssuer, mustMarshal(cert.SerialNumber)),
+		mustMarshal(pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption}), mustMarshal(encryptedKey))
+	encrypted := tlv(0x30, mustMarshal(oidData), tlv(0x30, mustMarshal(oidAES256CBC), mustMarshal(iv)), tlv(0x80, padded))
+	ed := tlv(0x30, mustMarshal(0), tlv(0x31, recipient), encrypted)
+	return tlv(0x30, mustMarshal(oidEnvelopedData), tlv(0xA0, ed))
+}
+
+func smimeMessage(class string, att models.Attachment) *models.Message {
+	msg := newItem(class, nil)
+	msg.Subject = "Signed report"
+	msg.FromName = "Alice Example"
+	msg.FromEmail = "alice@example.com"
+	att.Properties = map[int64]interface{}{}
+	msg.Attachments = []models.Attachment{att}
+	return msg
+}
+
+func TestUnwrapSMIME(t *testing.T) {
+	alice := newSigner(t, "Alice Example")
+	multipart := multipartSigned(t, alice, signedEntity)
+
+	for name, msg := range map[string]*models.Message{
+		"multipart/signed": smimeMessage("IPM.Note.SMIME.MultipartSigned", models.Attachment{FileName: "smime.p7m", MimeType: "multipart/signed", Method: models.AttachByValue, Data: []byte(multipart)}),
+		"opaque":           smimeMessage("IPM.Note.SMIME", models.Attachment{FileName: "smime.p7m", MimeType: "application/pkcs7-mime", Method: models.AttachByValue, Data: alice.sign(t, []byte(signedEntity), false)}),
+	} {
+		s, err := msgparser.UnwrapSMIME(writeAndParse(t, msg))
+		if err != nil {
+			t.Fatalf("%s: failed to unwrap: %v", name, err)
+		}
+		if s.Detached != (name == "multipart/signed") || string(s.Content) != signedEntity {
+			t.Errorf("%s: unexpected signed content %q", name, s.Content)
+		}
+		if len(s.Signers) != 1 || s.Signers[0].Subject.CommonName != "Alice Example" {
+			t.Errorf("%s: unexpected signers %v", name, s.Signers)
+		}
+		inner := s.Message
+		if inner.Subject != "Signed report" || inner.FromEmail != "alice@example.com" || inner.BodyPlainText != "Signed hello" {
+			t.Errorf("%s: unexpected inner message %q from %s: %q", name, inner.Subject, inner.FromEmail, inner.BodyPlainText)
+		}
+		if len(inner.Attachments) != 1 || inner.Attachments[0].FileName != "figures.csv" || !bytes.Equal(inner.Attachments[0].Data, []byte("q,r\r\n1,100")) {
+			t.Errorf("%s: unexpected attachments %+v", name, inner.Attachments)
+		}
+	}
+
+	if _, err := msgparser.UnwrapSMIME(newItem("IPM.Note", nil)); err != msgparser.ErrNotSMIME {
+		t.Errorf("Unexpected error for a plain message: %v", err)
+	}
+}
+
+// multipartSigned returns the MIME entity Outlook keeps for a clear signed message
+func multipartSigned(t *testing.T, s signer, content string) string {
+	sig := base64.StdEncoding.EncodeToString(s.sign(t, []byte(content), true))
+	return "Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; micalg=sha-256; boundary=outer\r\n\r\n" +
+		"--outer\r\n" + content + "\r\n" +
+		"--outer\r\nContent-Type: application/pkcs7-signature; name=smime.p7s\r\nContent-Transfer-Encoding: base64\r\n\r\n" + sig + "\r\n" +
+		"--outer--\r\n"
+}
+
+func TestVerifySMIME(t *testing.T) {
+	alice := newSigner(t, "Alice Example")
+	trusted := x509.NewCertPool()
+	trusted.AddCert(alice.cert)
+	unwrap := func(class, mimeType string, data []byte) *msgparser.SMIMEMessage {
+		t.Helper()
+		s, err := msgparser.UnwrapSMIME(smimeMessage(class, models.Attachment{FileName: "smime.p7m", MimeType: mimeType, Data: data}))
+		if err != nil {
+			t.Fatalf("Failed to unwrap: %v", err)
+		}
+		return s
+	}
+
+	detached := unwrap("IPM.Note.SMIME.MultipartSigned", "multipart/signed", []byte(multipartSigned(t, alice, signedEntity)))
+	results := detached.Verify(trusted)
+	if len(results) != 1 || results[0].Status != msgparser.SignatureValid || results[0].Status.String() != "valid" {
+		t.Fatalf("Unexpected results %+v", results)
+	}
+	if r := results[0]; r.Name != "Alice Example" || r.Email != "alice@example.com" || !r.SigningTime.Equal(alice.signingTime) {
+		t.Errorf("Unexpected signer %q <%s> at %v", r.Name, r.Email, r.SigningTime)
+	}
+	if !detached.Valid(trusted) {
+		t.Errorf("Detached signature is not valid")
+	}
+	if r := detached.Verify(x509.NewCertPool()); r[0].Status != msgparser.SignatureUntrusted {
+		t.Errorf("Unexpected status %v with an empty pool", r[0].Status)
+	}
+	if r := detached.Verify(nil); r[0].Status != msgparser.SignatureUntrusted || detached.Valid(nil) {
+		t.Errorf("Unexpected status %v without a pool", r[0].Status)
+	}
+
+	tampered := strings.Replace(multipartSigned(t, alice, signedEntity), "Signed hello", "Signed hullo", 1)
+	if r := unwrap("IPM.Note.SMIME.MultipartSigned", "multipart/signed", []byte(tampered)).Verify(trusted); r[0].Status != msgparser.SignatureInvalid {
+		t.Errorf("Unexpected status %v for a modified message", r[0].Status)
+	}
+
+	opaque := unwrap("IPM.Note.SMIME", "application/pkcs7-mime", alice.sign(t, []byte(signedEntity), false))
+	if !opaque.Valid(trusted) {
+		t.Errorf("Opaque signature is not valid: %+v", opaque.Verify(trusted))
+	}
+
+	alice.signingTime = alice.signingTime.Add(-3 * time.Hour)
+	if r := unwrap("IPM.Note.SMIME.MultipartSigned", "multipart/signed", []byte(multipartSigned(t, alice, signedEntity))).Verify(trusted); r[0].Status != msgparser.SignatureExpired {
+		t.Errorf("Unexpected status %v for a signature made before the certificate was valid", r[0].Status)
+	}
+}
+
+func TestDecryptSMIME(t *testing.T) {
+	alice := newSigner(t, "Alice Example")
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(7), Subject: pkix.Name{CommonName: "Bob Example"}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	bob, _ := x509.ParseCertificate(der)
+
+	// Outlook signs, then encrypts the signed message
+	signed := "Content-Type: application/pkcs7-mime; smime-type=signed-data; name=smime.p7m\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(alice.sign(t, []byte(signedEntity), false)) + "\r\n"
+	msg := writeAndParse(t, smimeMessage("IPM.Note.SMIME", models.Attachment{FileName: "smime.p7m", MimeType: "application/pkcs7-mime", Data: encrypt(t, []byte(signed), bob)}))
+
+	if _, err := msgparser.UnwrapSMIME(msg); err != msgparser.ErrSMIMEEncrypted {
+		t.Errorf("Unexpected error without key: %v", err)
+	}
+	if _, err := msgparser.DecryptSMIME(msg, alice.cert, key); err != msgparser.ErrSMIMENotRecipient {
+		t.Errorf("Unexpected error for another certificate: %v", err)
+	}
+	s, err := msgparser.DecryptSMIME(msg, bob, key)
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if !s.Encrypted || s.Message.BodyPlainText != "Signed hello" || len(s.Message.Attachments) != 1 {
+		t.Errorf("Unexpected decrypted message %+v", s.Message)
+	}
+	trusted := x509.NewCertPool()
+	trusted.AddCert(alice.cert)
+	if !s.Valid(trusted) {
+		t.Errorf("Signature of the decrypted message is not valid: %+v", s.Verify(trusted))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func task(lid uint32) models.NamedProperty {
+	return models.NamedProperty{GUID: models.PSETIDTask, ID: lid}
+}
+
+func TestTask(t *testing.T) {
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	due := time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+	msg := newItem("IPM.Task", map[models.NamedProperty]interface{}{
+		task(0x8101):   int32(models.TaskInProgress),
+		task(0x8102):   0.5,
+		task(0x8104):   start,
+		task(0x8105):   due,
+		task(0x8111):   int32(90),
+		task(0x811F):   "Alice Example",
+		task(0x8129):   int32(models.TaskAssigneesCopy),
+		task(0x8116):   recurrenceBlob(models.EndAfterDate),
+		task(0x8126):   true,
+		common(0x8503): true,
+		common(0x8502): due.Add(9 * time.Hour),
+	})
+	msg.Subject = "Quarterly report"
+	msg.BodyPlainText = "Collect the figures"
+	msg.Properties[0x0017] = int32(2) // PR_IMPORTANCE high
+
+	task, ok := writeAndParse(t, msg).Task()
+	if !ok {
+		t.Fatalf("Message was not recognized as task")
+	}
+	if task.Status != models.TaskInProgress || task.PercentComplete != 0.5 || task.EstimatedEffort != 90*time.Minute {
+		t.Errorf("Unexpected status %v, percent %v or effort %v", task.Status, task.PercentComplete, task.EstimatedEffort)
+	}
+	if !task.StartDate.Equal(start) || !task.DueDate.Equal(due) || task.Owner != "Alice Example" || task.Ownership != models.TaskAssigneesCopy {
+		t.Errorf("Unexpected task %+v", task)
+	}
+	if !task.Recurring || task.Recurrence == nil || task.Recurrence.Frequency != models.RecurWeekly {
+		t.Errorf("Unexpected recurrence %+v", task.Recurrence)
+	}
+	if task.Reminder == nil || !task.Reminder.Time.Equal(due.Add(9*time.Hour)) {
+		t.Errorf("Unexpected reminder %+v", task.Reminder)
+	}
+
+	var buf bytes.Buffer
+	if err := task.WriteICS(&buf); err != nil {
+		t.Fatalf("Failed to write iCalendar: %v", err)
+	}
+	ics := strings.ReplaceAll(buf.String(), "\r\n ", "")
+	for _, line := range []string{
+		"BEGIN:VTODO\r\n",
+		"SUMMARY:Quarterly report\r\n",
+		"DESCRIPTION:Collect the figures\r\n",
+		"DTSTART;VALUE=DATE:20240304\r\n",
+		"DUE;VALUE=DATE:20240308\r\n",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20240626\r\n",
+		"STATUS:IN-PROCESS\r\n",
+		"PERCENT-COMPLETE:50\r\n",
+		"PRIORITY:1\r\n",
+		"X-OUTLOOK-TASK-OWNER:Alice Example\r\n",
+		"TRIGGER;VALUE=DATE-TIME:20240308T090000Z\r\n",
+	} {
+		if !strings.Contains(ics, line) {
+			t.Errorf("Missing %q in\n%s", line, ics)
+		}
+	}
+
+	// Outlook stores 4501-01-01 for the dates of a task that has none
+	none := time.Date(4501, 1, 1, 0, 0, 0, 0, time.UTC)
+	undated, _ := writeAndParse(t, newItem("IPM.Task", map[models.NamedProperty]interface{}{
+		models.NamedProperty{GUID: models.PSETIDTask, ID: 0x8104}: none,
+		models.NamedProperty{GUID: models.PSETIDTask, ID: 0x8105}: none,
+	})).Task()
+	if undated == nil || !undated.StartDate.IsZero() || !undated.DueDate.IsZero() {
+		t.Fatalf("Unexpected dates of a task without dates %+v", undated)
+	}
+	buf.Reset()
+	if err := undated.WriteICS(&buf); err != nil {
+		t.Fatalf("Failed to write iCalendar: %v", err)
+	}
+	if ics := buf.String(); strings.Contains(ics, "DTSTART") || strings.Contains(ics, "DUE") {
+		t.Errorf("Unexpected dates in\n%s", ics)
+	}
+
+	if _, ok := newItem("IPM.Note", nil).Task(); ok {
+		t.Errorf("IPM.Note was recognized as task")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// europeRule writes the biases and transitions of central European time: daylight saving time from the last Sunday of March at 2:00
+// to the last Sunday of October at 3:00
+func europeRule(w func(...interface{})) {
+	w(int32(-60), int32(0), int32(-60))
+	w([8]uint16{0, 10, 0, 5, 3, 0, 0, 0})
+	w([8]uint16{0, 3, 0, 5, 2, 0, 0, 0})
+}
+
+// tzDefinition builds a TimeZoneDefinition with a single central European rule
+func tzDefinition(keyName string) []byte {
+	var buf bytes.Buffer
+	w := func(values ...interface{}) {
+		for _, v := range values {
+			binary.Write(&buf, binary.LittleEndian, v)
+		}
+	}
+	key := utf16.Encode([]rune(keyName))
+	w(uint8(2), uint8(1), uint16(6+2*len(key)), uint16(2), uint16(len(key)), key, uint16(1))
+	w(uint8(2), uint8(1), uint16(0x3E), uint16(models.TZRuleEffective), uint16(2007), [14]byte{})
+	europeRule(w)
+	return buf.Bytes()
+}
+
+func TestTimeZone(t *testing.T) {
+	start := time.Date(2024, 7, 1, 7, 0, 0, 0, time.UTC)
+	msg := newItem("IPM.Appointment", map[models.NamedProperty]interface{}{
+		appt(0x820D): start,
+		appt(0x825E): tzDefinition("W. Europe Standard Time"),
+		appt(0x8234): "(UTC+01:00) Amsterdam, Berlin, Bern, Rome, Stockholm, Vienna",
+	})
+	a, _ := writeAndParse(t, msg).Appointment()
+	if a.StartTimeZone == nil || a.EndTimeZone != a.StartTimeZone || a.RecurrenceTimeZone != a.StartTimeZone {
+		t.Fatalf("Unexpected time zones %+v %+v %+v", a.StartTimeZone, a.EndTimeZone, a.RecurrenceTimeZone)
+	}
+	tz := a.StartTimeZone
+	if tz.KeyName != "W. Europe Standard Time" || tz.IANAName() != "Europe/Berlin" || len(tz.Rules) != 1 || tz.Rules[0].Year != 2007 {
+		t.Errorf("Unexpected definition %+v", tz)
+	}
+	if a.TimeZoneDescription == "" {
+		t.Errorf("Time zone description is missing")
+	}
+	if local := a.LocalStart(); local.Hour() != 9 {
+		t.Errorf("Expected 9:00 local time, got %v", local)
+	}
+
+	var ics bytes.Buffer
+	if err := tz.WriteVTimezone(&ics); err != nil {
+		t.Fatalf("Failed to write VTIMEZONE: %v", err)
+	}
+	for _, line := range []string{
+		"TZID:Europe/Berlin",
+		"BEGIN:STANDARD\r\nDTSTART:16011028T030000\r\nRRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nEND:STANDARD",
+		"BEGIN:DAYLIGHT\r\nDTSTART:16010325T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nEND:DAYLIGHT",
+	} {
+		if !strings.Contains(ics.String(), line) {
+			t.Errorf("VTIMEZONE lacks %q:\n%s", line, ics.String())
+		}
+	}
+
+	// Zones without an IANA name follow the rule of the definition
+	custom, err := models.ParseTimeZoneDefinition(tzDefinition("Custom Standard Time"))
+	if err != nil {
+		t.Fatalf("Failed to parse definition: %v", err)
+	}
+	loc := custom.Location()
+	if _, offset := start.In(loc).Zone(); offset != 2*3600 {
+		t.Errorf("Expected daylight saving time in July, got offset %d", offset)
+	}
+	if _, offset := start.AddDate(0, 6, 0).In(loc).Zone(); offset != 3600 {
+		t.Errorf("Expected standard time in January, got offset %d", offset)
+	}
+	if custom.TZID() != "Custom Standard Time" {
+		t.Errorf("Unexpected TZID %s", custom.TZID())
+	}
+
+	var tzStruct bytes.Buffer
+	w := func(values ...interface{}) {
+		for _, v := range values {
+			binary.Write(&tzStruct, binary.LittleEndian, v)
+		}
+	}
+	w(int32(-60), int32(0), int32(-60), uint16(0), [8]uint16{0, 10, 0, 5, 3, 0, 0, 0}, uint16(0), [8]uint16{0, 3, 0, 5, 2, 0, 0, 0})
+	single, err := models.ParseTimeZoneStruct(tzStruct.Bytes())
+	if err != nil || single.EffectiveRule().DaylightOffset() != 2*time.Hour || single.TZID() != "UTC+01:00" {
+		t.Errorf("Unexpected TZSTRUCT %+v (%v)", single, err)
+	}
+}
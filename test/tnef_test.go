@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+func le32(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+func utf16z(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// tnefAttr encodes one attribute of a TNEF stream with its checksum
+func tnefAttr(level byte, id uint32, data []byte) []byte {
+	res := append([]byte{level}, le32(id)...)
+	res = append(append(res, le32(uint32(len(data)))...), data...)
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	return binary.LittleEndian.AppendUint16(res, sum)
+}
+
+// tnefStream encodes a TNEF stream holding the given attributes
+func tnefStream(attrs ...[]byte) []byte {
+	return bytes.Join(append([][]byte{{0x78, 0x9F, 0x3E, 0x22, 0x01, 0x00}}, attrs...), nil)
+}
+
+// tnefProps encodes a property list
+func tnefProps(props ...[]byte) []byte {
+	return bytes.Join(append([][]byte{le32(uint32(len(props)))}, props...), nil)
+}
+
+// tnefProp encodes a property of a fixed length type, or one of a variable length type when value comes from tnefVar
+func tnefProp(typ, id uint16, value []byte) []byte {
+	res := binary.LittleEndian.AppendUint16(nil, typ)
+	return append(binary.LittleEndian.AppendUint16(res, id), value...)
+}
+
+// tnefNamed encodes a property with a string name
+func tnefNamed(typ uint16, np models.NamedProperty, value []byte) []byte {
+	g, _ := hex.DecodeString(strings.ReplaceAll(np.GUID, "-", ""))
+	guid := binary.LittleEndian.AppendUint32(nil, binary.BigEndian.Uint32(g))
+	guid = binary.LittleEndian.AppendUint16(guid, binary.BigEndian.Uint16(g[4:]))
+	guid = binary.LittleEndian.AppendUint16(guid, binary.BigEndian.Uint16(g[6:]))
+	guid = append(guid, g[8:]...)
+	res := tnefProp(typ, 0x8000, append(guid, le32(1)...))
+	return append(res, append(tnefVar(utf16z(np.Name)), value...)[4:]...)
+}
+
+// tnefVar encodes the values of a variable length property
+func tnefVar(values ...[]byte) []byte {
+	res := le32(uint32(len(values)))
+	for _, v := range values {
+		res = append(append(res, le32(uint32(len(v)))...), v...)
+		res = append(res, make([]byte, (4-len(v)%4)%4)...)
+	}
+	return res
+}
+
+// winmail builds the TNEF stream of a rich text message with a file and a forwarded message attached
+func winmail() []byte {
+	rtf := []byte{0x2d, 0, 0, 0, 0x2b, 0, 0, 0, 'L', 'Z', 'F', 'u'}
+	forwarded := tnefStream(
+		tnefAttr(1, 0x00078008, []byte("IPM.Microsoft Mail.Note\x00")),
+		tnefAttr(1, 0x00018004, []byte("Inner\x00")),
+		tnefAttr(1, 0x0002800C, []byte("Only a legacy body\x00")),
+	)
+	return tnefStream(
+		tnefAttr(1, 0x00089006, le32(0x00010000)),
+		tnefAttr(1, 0x00069007, append(le32(1252), le32(437)...)),
+		tnefAttr(1, 0x00078008, []byte("IPM.Microsoft Mail.Note\x00")),
+		tnefAttr(1, 0x00018004, []byte("Legacy subject\x00")),
+		tnefAttr(1, 0x00038005, []byte{0xE8, 0x07, 3, 0, 4, 0, 9, 0, 30, 0, 0, 0, 1, 0}),
+		tnefAttr(1, 0x0002800C, []byte("Caf\x82 legacy copy of the body\x00")),
+		tnefAttr(1, 0x00069003, tnefProps(
+			tnefProp(0x001F, 0x0037, tnefVar(utf16z("Quarterly report"))),
+			tnefProp(0x001E, 0x1000, tnefVar([]byte("Caf\xe9 numbers are attached.\x00"))),
+			tnefProp(0x0102, 0x1009, tnefVar(rtf)),
+			tnefNamed(0x001F, models.NamedProperty{GUID: models.PSPublicStrings, Name: "Project"}, tnefVar(utf16z("Apollo"))),
+		)),
+		tnefAttr(1, 0x00069004, append(le32(1), tnefProps(
+			tnefProp(0x0003, 0x0C15, le32(1)),
+			tnefProp(0x001F, 0x3001, tnefVar(utf16z("Bob"))),
+			tnefProp(0x001F, 0x3002, tnefVar(utf16z("SMTP"))),
+			tnefProp(0x001F, 0x3003, tnefVar(utf16z("bob@example.com"))),
+		)...)),
+		tnefAttr(2, 0x00069002, make([]byte, 14)),
+		tnefAttr(2, 0x00018010, []byte("REPORT~1.CSV\x00")),
+		tnefAttr(2, 0x0006800F, []byte("a,b\n1,2\n")),
+		tnefAttr(2, 0x00069005, tnefProps(
+			tnefProp(0x001F, 0x3707, tnefVar(utf16z("report.csv"))),
+			tnefProp(0x0003, 0x3705, le32(models.AttachByValue)),
+		)),
+		tnefAttr(2, 0x00069002, make([]byte, 14)),
+		tnefAttr(2, 0x00069005, tnefProps(
+			tnefProp(0x001F, 0x3001, tnefVar(utf16z("Forwarded"))),
+			tnefProp(0x0003, 0x3705, le32(models.AttachEmbeddedMsg)),
+			tnefProp(0x000D, 0x3701, tnefVar(append(make([]byte, 16), forwarded...))),
+		)),
+	)
+}
+
+func TestParseTNEF(t *testing.T) {
+	msg, err := msgparser.ParseTNEF(bytes.NewReader(winmail()))
+	if err != nil {
+		t.Fatalf("Failed to parse TNEF: %v", err)
+	}
+	if msg.MessageClass != "IPM.Note" || msg.Subject != "Quarterly report" {
+		t.Errorf("Unexpected class %q or subject %q", msg.MessageClass, msg.Subject)
+	}
+	// The legacy body only stands in for a missing PR_BODY
+	if msg.BodyPlainText != "Café numbers are attached." {
+		t.Errorf("Unexpected body %q", msg.BodyPlainText)
+	}
+	if !msg.ClientSubmitTime.Equal(time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected submit time %v", msg.ClientSubmitTime)
+	}
+	if rtf, _ := msg.Properties[0x1009].([]byte); len(rtf) != 12 {
+		t.Errorf("Unexpected compressed RTF %x", rtf)
+	}
+	if v, _ := msg.NamedValueByName(models.PSPublicStrings, "Project"); v != "Apollo" {
+		t.Errorf("Unexpected named property %v", v)
+	}
+	if len(msg.Recipients) != 1 || msg.Recipients[0].EmailAddress != "bob@example.com" || msg.Recipients[0].Type != models.RecipientTo || msg.To != "bob@example.com; " {
+		t.Errorf("Unexpected recipients %+v", msg.Recipients)
+	}
+
+	if len(msg.Attachments) != 2 {
+		t.Fatalf("Unexpected %d attachments", len(msg.Attachments))
+	}
+	if att := msg.Attachments[0]; att.FileName != "report.csv" || string(att.Data) != "a,b\n1,2\n" {
+		t.Errorf("Unexpected attachment %q %q", att.FileName, att.Data)
+	}
+	if att := msg.Attachments[1]; att.Embedded == nil || att.Embedded.Subject != "Inner" || att.Embedded.MessageClass != "IPM.Note" {
+		t.Errorf("Unexpected embedded message %+v", att.Embedded)
+	}
+	if att := msg.Attachments[1]; att.Embedded != nil && att.Embedded.BodyPlainText != "Only a legacy body" {
+		t.Errorf("Unexpected legacy body %q", att.Embedded.BodyPlainText)
+	}
+
+	if _, err := msgparser.ParseTNEF(strings.NewReader("not TNEF")); err != msgparser.ErrNotTNEF {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := msgparser.ParseTNEF(bytes.NewReader(winmail()[:100])); err == nil {
+		t.Errorf("Truncated stream was accepted")
+	}
+}
+
+func TestExpandWinmailDat(t *testing.T) {
+	msg := newItem("IPM.Note", nil)
+	msg.Subject = "Quarterly report"
+	msg.Attachments = []models.Attachment{
+		{FileName: "notes.txt", Method: models.AttachByValue, Data: []byte("kept"), Properties: map[int64]interface{}{}},
+		{FileName: "winmail.dat", MimeType: "application/ms-tnef", Method: models.AttachByValue, Data: winmail(), Properties: map[int64]interface{}{}},
+	}
+
+	got := writeAndParse(t, msg)
+	var names []string
+	for _, att := range got.Attachments {
+		names = append(names, att.FileName+att.Name)
+	}
+	if strings.Join(names, ",") != "notes.txt,report.csv,Forwarded" {
+		t.Errorf("Unexpected attachments %v", names)
+	}
+	if got.BodyPlainText != "Café numbers are attached." {
+		t.Errorf("Unexpected body %q", got.BodyPlainText)
+	}
+	if _, ok := got.Properties[0x1009]; !ok {
+		t.Errorf("Compressed RTF body was not copied")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/richardlehane/mscfb"
+
+	msgparser "github.com/yuphing-ong/outlook-msg-parser"
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// countingVisitor counts what Walk reports
+type countingVisitor struct {
+	names       int
+	storages    int
+	recipients  int
+	attachments int
+	messages    map[string]bool
+	unknown     int
+}
+
+func (v *countingVisitor) OnNamedPropertyMap(names map[int64]models.NamedProperty) error {
+	v.names = len(names)
+	return nil
+}
+
+func (v *countingVisitor) OnStorage(path []string, entry *mscfb.File) error {
+	v.storages++
+	return nil
+}
+
+func (v *countingVisitor) OnRecipient(loc msgparser.Location, entry *mscfb.File) error {
+	v.recipients++
+	return nil
+}
+
+func (v *countingVisitor) OnAttachment(loc msgparser.Location, entry *mscfb.File) error {
+	v.attachments++
+	return nil
+}
+
+func (v *countingVisitor) OnPropertyStream(loc msgparser.Location, entry *mscfb.File) error {
+	if loc.Kind == msgparser.ObjectMessage {
+		v.messages[loc.Key()] = true
+	}
+	return nil
+}
+
+func (v *countingVisitor) OnUnknownStream(path []string, entry *mscfb.File) error {
+	v.unknown++
+	return nil
+}
+
+func TestWalk(t *testing.T) {
+	f, err := os.Open("test_2.msg")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	v := &countingVisitor{messages: make(map[string]bool)}
+	if err := msgparser.Walk(f, v); err != nil {
+		t.Fatalf("Failed to walk file: %v", err)
+	}
+
+	msg, err := msgparser.ParseMsgFile("test_2.msg")
+	if err != nil {
+		t.Fatalf("Failed to parse file: %v", err)
+	}
+	if v.names != len(msg.NamedProperties) {
+		t.Errorf("Expected %d named properties, got %d", len(msg.NamedProperties), v.names)
+	}
+	if v.recipients != len(msg.Recipients)+len(msg.Attachments[0].Embedded.Recipients) {
+		t.Errorf("Unexpected number of recipients %d", v.recipients)
+	}
+	if v.attachments != len(msg.Attachments)+len(msg.Attachments[0].Embedded.Attachments) {
+		t.Errorf("Unexpected number of attachments %d", v.attachments)
+	}
+	if len(v.messages) != 2 || !v.messages["__attach_version1.0_#00000000/__substg1.0_3701000D"] {
+		t.Errorf("Expected the top level and the embedded message, got %v", v.messages)
+	}
+}
@@ -0,0 +1,431 @@
+package msgparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// tnefSignature starts every TNEF stream (MS-OXTNEF 2.1.3.1)
+const tnefSignature = 0x223E9F78
+
+// Levels of TNEF attributes
+const (
+	tnefLevelMessage    = 0x01
+	tnefLevelAttachment = 0x02
+)
+
+// TNEF attribute ids, with the attribute type in the high word
+const (
+	attSubject        = 0x00018004
+	attDateSent       = 0x00038005
+	attDateRecd       = 0x00038006
+	attMessageClass   = 0x00078008
+	attBody           = 0x0002800C
+	attAttachData     = 0x0006800F
+	attAttachTitle    = 0x00018010
+	attAttachRenddata = 0x00069002
+	attMsgProps       = 0x00069003
+	attRecipTable     = 0x00069004
+	attAttachment     = 0x00069005
+	attOemCodepage    = 0x00069007
+)
+
+// ErrNotTNEF is returned by ParseTNEF for data that does not start with the TNEF signature
+var ErrNotTNEF = errors.New("tnef: not a TNEF stream")
+
+// errTNEF is returned for TNEF streams that are truncated or hold a property of an unknown type
+var errTNEF = errors.New("tnef: invalid stream")
+
+// legacyClasses maps the message classes of attMessageClass that predate MAPI to their MAPI names
+var legacyClasses = map[string]string{
+	"IPM.Microsoft Mail.Note":         "IPM.Note",
+	"IPM.Microsoft Mail.Read Receipt": "Report.IPM.Note.IPNRN",
+	"IPM.Microsoft Mail.Non-Delivery": "Report.IPM.Note.NDR",
+	"IPM.Microsoft Schedule.MtgReq":   "IPM.Schedule.Meeting.Request",
+	"IPM.Microsoft Schedule.MtgRespP": "IPM.Schedule.Meeting.Resp.Pos",
+	"IPM.Microsoft Schedule.MtgRespN": "IPM.Schedule.Meeting.Resp.Neg",
+	"IPM.Microsoft Schedule.MtgRespA": "IPM.Schedule.Meeting.Resp.Tent",
+	"IPM.Microsoft Schedule.MtgCncl":  "IPM.Schedule.Meeting.Canceled",
+}
+
+// ParseTNEF parses a TNEF stream (winmail.dat, application/ms-tnef) into a message, the same way ParseReader
+// parses a msg file: the MAPI properties of the message, its recipients and attachments are set with SetProperties,
+// so the compressed RTF body stays in Properties[0x1009] and an attached message becomes Attachment.Embedded
+func ParseTNEF(r io.Reader) (*models.Message, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseTNEF(data)
+}
+
+// tnefState collects the objects of one TNEF stream
+type tnefState struct {
+	msg         *models.Message
+	attachments []*models.Attachment
+	ids         map[models.NamedProperty]int64 // named property -> id assigned in the message
+	codepage    int32                          // attOemCodepage, used for PT_STRING8 values
+	body        bool                           // attMsgProps carried PR_BODY
+}
+
+// parseTNEF decodes the attributes of a TNEF stream. Their checksums are not verified.
+func parseTNEF(data []byte) (*models.Message, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint32(data) != tnefSignature {
+		return nil, ErrNotTNEF
+	}
+	state := &tnefState{
+		msg: &models.Message{Properties: make(map[int64]interface{})},
+		ids: make(map[models.NamedProperty]int64),
+	}
+	// Attributes of the message that predate MAPI, used when the MAPI properties lack them
+	legacy := make(map[uint32][]byte)
+
+	c := &tnefCursor{data: data[6:]}
+	for len(c.data) > 0 && c.err == nil {
+		level := c.next(1)
+		id := c.uint32()
+		value := c.next(int(c.uint32()))
+		c.next(2) // checksum
+		if c.err != nil {
+			break
+		}
+
+		if level[0] == tnefLevelAttachment {
+			if id == attAttachRenddata {
+				state.attachments = append(state.attachments, &models.Attachment{Method: models.AttachByValue, Properties: make(map[int64]interface{})})
+				continue
+			}
+			if len(state.attachments) == 0 {
+				continue
+			}
+			att := state.attachments[len(state.attachments)-1]
+			switch id {
+			case attAttachData:
+				if att.Data == nil {
+					att.Data = value
+				}
+			case attAttachTitle:
+				if att.FileName == "" {
+					att.FileName = state.string8(value)
+				}
+			case attAttachment:
+				props := &tnefCursor{data: value}
+				for _, p := range state.properties(props) {
+					att.SetProperties(p)
+				}
+				c.err = props.err
+			}
+			continue
+		}
+
+		switch id {
+		case attOemCodepage:
+			if len(value) >= 4 {
+				state.codepage = int32(binary.LittleEndian.Uint32(value))
+			}
+		case attMsgProps:
+			props := &tnefCursor{data: value}
+			for _, p := range state.properties(props) {
+				state.body = state.body || p.Class == "1000"
+				state.msg.SetProperties(p)
+			}
+			c.err = props.err
+		case attRecipTable:
+			c.err = state.recipients(value)
+		case attMessageClass, attSubject, attBody, attDateSent, attDateRecd:
+			legacy[id] = value
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	msg := state.msg
+	if msg.MessageClass == "" {
+		msg.MessageClass = state.string8(legacy[attMessageClass])
+		if class, ok := legacyClasses[msg.MessageClass]; ok {
+			msg.MessageClass = class
+		}
+	}
+	if msg.Subject == "" {
+		msg.Subject = state.string8(legacy[attSubject])
+	}
+	if body := state.string8(legacy[attBody]); body != "" && !state.body {
+		msg.SetProperties(models.MessageEntryProperty{Class: "1000", Mapi: 0x001E, Data: body})
+	}
+	if msg.ClientSubmitTime.IsZero() {
+		msg.ClientSubmitTime = tnefDate(legacy[attDateSent])
+	}
+	if msg.Date.IsZero() {
+		msg.Date = tnefDate(legacy[attDateRecd])
+	}
+
+	for _, att := range state.attachments {
+		if att.Method == models.AttachEmbeddedMsg {
+			// The attached message is a TNEF stream of its own
+			if embedded, err := parseTNEF(att.Data); err == nil {
+				att.Embedded, att.Data = embedded, nil
+			}
+		}
+		msg.Attachments = append(msg.Attachments, *att)
+	}
+	if len(state.ids) > 0 {
+		msg.NamedProperties = make(map[int64]models.NamedProperty, len(state.ids))
+		for np, id := range state.ids {
+			msg.NamedProperties[id] = np
+		}
+	}
+	msg.ApplyNamedPropertyHandlers()
+	msg.CalculateAddresses()
+	msg.CalculateFinalBody()
+	return msg, nil
+}
+
+// recipients decodes the rows of attRecipTable
+func (state *tnefState) recipients(data []byte) error {
+	c := &tnefCursor{data: data}
+	rows := int(c.uint32())
+	for i := 0; i < rows && c.err == nil; i++ {
+		recip := models.Recipient{Properties: make(map[int64]interface{})}
+		for _, p := range state.properties(c) {
+			recip.SetProperties(p)
+		}
+		state.msg.Recipients = append(state.msg.Recipients, recip)
+	}
+	return c.err
+}
+
+// properties decodes a property list (MS-OXTNEF 2.1.3.4), giving named properties the next free id of the message
+func (state *tnefState) properties(c *tnefCursor) []models.MessageEntryProperty {
+	var props []models.MessageEntryProperty
+	count := int(c.uint32())
+	for i := 0; i < count && c.err == nil; i++ {
+		typ, tag := uint32(c.uint16()), int64(c.uint16())
+		if tag >= 0x8000 {
+			guid := c.next(16)
+			if guid == nil {
+				break
+			}
+			np := models.NamedProperty{GUID: models.FormatGUID(guid)}
+			if c.uint32() == 0 {
+				np.ID = c.uint32()
+			} else {
+				np.Name = decodeUTF16(c.padded(int(c.uint32())))
+			}
+			tag = state.namedID(np)
+		}
+		value := state.value(c, typ)
+		if c.err != nil {
+			break
+		}
+		props = append(props, models.MessageEntryProperty{Class: fmt.Sprintf("%04x", tag), Mapi: int64(typ), Data: value})
+	}
+	return props
+}
+
+// namedID returns the id of a named property in the message, assigning the next free one on first use
+func (state *tnefState) namedID(np models.NamedProperty) int64 {
+	id, ok := state.ids[np]
+	if !ok {
+		id = 0x8000 + int64(len(state.ids))
+		state.ids[np] = id
+	}
+	return id
+}
+
+// value decodes the value of a property. Variable length and multi-valued types start with the number of values.
+func (state *tnefState) value(c *tnefCursor, typ uint32) interface{} {
+	base := typ &^ 0x1000
+	variable := base == 0x001E || base == 0x001F || base == 0x000D || base == 0x0102
+	if typ&0x1000 == 0 && !variable {
+		return state.single(c, base)
+	}
+	var values []interface{}
+	for i, n := 0, int(c.uint32()); i < n && c.err == nil; i++ {
+		values = append(values, state.single(c, base))
+	}
+	if typ&0x1000 == 0 {
+		if len(values) == 0 {
+			return nil
+		}
+		return values[0]
+	}
+	return multiValue(base, values)
+}
+
+// single decodes one value, padded to a multiple of 4 bytes
+func (state *tnefState) single(c *tnefCursor, typ uint32) interface{} {
+	var data []byte
+	switch typ {
+	case 0x0002, 0x0003, 0x0004, 0x000A, 0x000B: // PT_I2, PT_LONG, PT_R4, PT_ERROR, PT_BOOLEAN
+		data = c.next(4)
+	case 0x0005, 0x0006, 0x0007, 0x0014, 0x0040: // PT_DOUBLE, PT_CURRENCY, PT_APPTIME, PT_I8, PT_SYSTIME
+		data = c.next(8)
+	case 0x0048: // PT_CLSID
+		data = c.next(16)
+	case 0x001E: // PT_STRING8, in the OEM codepage of the stream
+		return state.string8(c.padded(int(c.uint32())))
+	case 0x001F, 0x0102: // PT_UNICODE, PT_BINARY
+		data = c.padded(int(c.uint32()))
+	case 0x000D: // PT_OBJECT, which starts with the IID of its interface
+		if data = c.padded(int(c.uint32())); len(data) >= 16 {
+			return data[16:]
+		}
+		return data
+	default:
+		c.err = errTNEF
+	}
+	if data == nil {
+		return nil
+	}
+	return extractDataFromBytes(data, typ)
+}
+
+// multiValue converts the values of a multi-valued property to the slice type ParseReader produces for it
+func multiValue(typ uint32, values []interface{}) interface{} {
+	switch typ {
+	case 0x0002:
+		res := make([]int16, len(values))
+		for i, v := range values {
+			res[i], _ = v.(int16)
+		}
+		return res
+	case 0x0003:
+		res := make([]int32, len(values))
+		for i, v := range values {
+			res[i], _ = v.(int32)
+		}
+		return res
+	case 0x0004:
+		res := make([]float32, len(values))
+		for i, v := range values {
+			res[i], _ = v.(float32)
+		}
+		return res
+	case 0x0005, 0x0007:
+		res := make([]float64, len(values))
+		for i, v := range values {
+			res[i], _ = v.(float64)
+		}
+		return res
+	case 0x0006, 0x0014:
+		res := make([]int64, len(values))
+		for i, v := range values {
+			res[i], _ = v.(int64)
+		}
+		return res
+	case 0x0040:
+		res := make([]time.Time, len(values))
+		for i, v := range values {
+			res[i], _ = v.(time.Time)
+		}
+		return res
+	case 0x001E, 0x001F, 0x0048:
+		res := make([]string, len(values))
+		for i, v := range values {
+			res[i], _ = v.(string)
+		}
+		return res
+	default:
+		res := make([][]byte, len(values))
+		for i, v := range values {
+			res[i], _ = v.([]byte)
+		}
+		return res
+	}
+}
+
+// string8 decodes a null terminated string in the OEM codepage of the stream
+func (state *tnefState) string8(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return models.DecodeCodepage(data, state.codepage)
+}
+
+// tnefDate decodes the DTR structure of attDateSent and attDateRecd
+func tnefDate(data []byte) time.Time {
+	if len(data) < 12 {
+		return time.Time{}
+	}
+	v := func(i int) int { return int(binary.LittleEndian.Uint16(data[2*i:])) }
+	return time.Date(v(0), time.Month(v(1)), v(2), v(3), v(4), v(5), 0, time.UTC)
+}
+
+// tnefCursor reads a TNEF stream, remembering the first read past its end
+type tnefCursor struct {
+	data []byte
+	err  error
+}
+
+// next returns the next n bytes, or nil when the stream is shorter
+func (c *tnefCursor) next(n int) []byte {
+	if c.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(c.data) {
+		c.err = errTNEF
+		return nil
+	}
+	b := c.data[:n:n]
+	c.data = c.data[n:]
+	return b
+}
+
+// padded returns the next n bytes and skips the padding to the next multiple of 4
+func (c *tnefCursor) padded(n int) []byte {
+	b := c.next(n)
+	c.next((4 - n%4) % 4)
+	return b
+}
+
+func (c *tnefCursor) uint16() uint16 {
+	if b := c.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (c *tnefCursor) uint32() uint32 {
+	if b := c.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// expandTNEF replaces the winmail.dat attachments of msg with the attachments they carry. A message sent as
+// rich text has its body there too, which msg takes when it has none of its own.
+func expandTNEF(msg *models.Message) {
+	var atts []models.Attachment
+	for _, att := range msg.Attachments {
+		if att.Embedded != nil || len(att.Data) < 4 || binary.LittleEndian.Uint32(att.Data) != tnefSignature {
+			atts = append(atts, att)
+			continue
+		}
+		inner, err := parseTNEF(att.Data)
+		if err != nil {
+			atts = append(atts, att)
+			continue
+		}
+		atts = append(atts, inner.Attachments...)
+		if !msg.HasBody() && inner.HasBody() {
+			msg.BodyPlainText, msg.BodyHTML, msg.BodySource = inner.BodyPlainText, inner.BodyHTML, inner.BodySource
+		}
+		if rtf, ok := inner.Properties[0x1009]; ok { // PR_RTF_COMPRESSED
+			if msg.Properties == nil {
+				msg.Properties = make(map[int64]interface{})
+			}
+			if _, exists := msg.Properties[0x1009]; !exists {
+				msg.Properties[0x1009] = rtf
+			}
+		}
+	}
+	msg.Attachments = atts
+}
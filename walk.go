@@ -0,0 +1,146 @@
+package msgparser
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/richardlehane/mscfb"
+
+	"github.com/yuphing-ong/outlook-msg-parser/models"
+)
+
+// ObjectKind tells whether a storage of a msg file holds a message, a recipient or an attachment
+type ObjectKind int
+
+// Kinds of objects stored in a msg file
+const (
+	ObjectMessage ObjectKind = iota
+	ObjectRecipient
+	ObjectAttachment
+)
+
+// Location identifies the message, recipient or attachment that a storage or stream belongs to
+type Location struct {
+	Path       []string   // Storage path of the object, empty for the top level message
+	Kind       ObjectKind // Kind of the object
+	HeaderSize int        // Size of the header of the object's __properties_version1.0 stream
+}
+
+// Key returns the storage path of the object joined by "/", which is unique within a file
+func (loc Location) Key() string {
+	return strings.Join(loc.Path, "/")
+}
+
+// Visitor receives the raw structure of a msg file from Walk.
+// Entries are visited in directory order, a storage always before its content.
+// An error returned by any method stops the walk and is returned by Walk.
+type Visitor interface {
+	// OnNamedPropertyMap is called once before any other method with the named property map of the file, which is empty if the file has none
+	OnNamedPropertyMap(names map[int64]models.NamedProperty) error
+	// OnStorage is called for every storage with the path of its parent storage
+	OnStorage(path []string, entry *mscfb.File) error
+	// OnRecipient is called when a __recip_version1.0_ storage is entered, after OnStorage
+	OnRecipient(loc Location, entry *mscfb.File) error
+	// OnAttachment is called when an __attach_version1.0_ storage is entered, after OnStorage
+	OnAttachment(loc Location, entry *mscfb.File) error
+	// OnPropertyStream is called for the __properties_version1.0 and __substg1.0_ streams of a message, recipient or attachment
+	OnPropertyStream(loc Location, entry *mscfb.File) error
+	// OnUnknownStream is called for any other stream, such as the content of an OLE attachment
+	OnUnknownStream(path []string, entry *mscfb.File) error
+}
+
+// Walk reads the compound file from r and reports its storages and streams to v
+func Walk(r io.Reader, v Visitor) error {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		ra = bytes.NewReader(data)
+	}
+	doc, err := mscfb.New(ra)
+	if err != nil {
+		return err
+	}
+	return walk(doc, v)
+}
+
+// walk visits the entries of doc, resolving the object each of them belongs to from its path
+func walk(doc *mscfb.Reader, v Visitor) error {
+	// The named property map is read up front so visitors can resolve named properties as they go
+	nameID := make(map[string][]byte)
+	for _, entry := range doc.File {
+		if len(entry.Path) == 1 && entry.Path[0] == NameIDStorage && !entry.FileInfo().IsDir() {
+			data := make([]byte, entry.Size)
+			if entry.Size > 0 {
+				if _, err := entry.ReadAt(data, 0); err != nil && err != io.EOF {
+					return err
+				}
+			}
+			nameID[entry.Name] = data
+		}
+	}
+	if err := v.OnNamedPropertyMap(parseNameID(nameID)); err != nil {
+		return err
+	}
+
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		path := append([]string{}, entry.Path...)
+		if entry.FileInfo().IsDir() {
+			if err := v.OnStorage(path, entry); err != nil {
+				return err
+			}
+			loc, ok := locate(append(path, entry.Name))
+			if !ok {
+				continue
+			}
+			switch loc.Kind {
+			case ObjectRecipient:
+				err = v.OnRecipient(loc, entry)
+			case ObjectAttachment:
+				err = v.OnAttachment(loc, entry)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if len(path) == 1 && path[0] == NameIDStorage {
+			continue
+		}
+		loc, ok := locate(path)
+		if ok && (entry.Name == PropsKey || strings.HasPrefix(entry.Name, PropertyStreamPrefix)) {
+			err = v.OnPropertyStream(loc, entry)
+		} else {
+			err = v.OnUnknownStream(path, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// locate returns the object stored in the storage at path, if the msg format describes it
+func locate(path []string) (Location, bool) {
+	loc := Location{Path: path, Kind: ObjectMessage, HeaderSize: 32}
+	for _, name := range path {
+		switch {
+		case strings.HasPrefix(name, RecepientStreamPrefix) && loc.Kind == ObjectMessage:
+			loc.Kind = ObjectRecipient
+			loc.HeaderSize = 8
+		case strings.HasPrefix(name, AttachmentStoragePrefix) && loc.Kind == ObjectMessage:
+			loc.Kind = ObjectAttachment
+			loc.HeaderSize = 8
+		case name == EmbeddedMessageStorage && loc.Kind == ObjectAttachment:
+			loc.Kind = ObjectMessage
+			loc.HeaderSize = 24
+		default:
+			return Location{}, false
+		}
+	}
+	return loc, true
+}